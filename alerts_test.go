@@ -0,0 +1,53 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAlertStreamReplaysEveryMissedAlert(t *testing.T) {
+	defer func(n int) { alertReplayPage = n }(alertReplayPage)
+	alertReplayPage = 2
+
+	m := NewMemoryRepo()
+	ctx := context.Background()
+	c, _ := m.CreateCategory(ctx, models.Category{Name: "Filters"})
+	var want []string
+	for i := 0; i < 5; i++ {
+		// no stock, so each is at the default reorder point
+		p, err := m.CreatePart(ctx, models.SparePart{CategoryID: c.ID, Brand: "Mann", Price: 5, IsActive: true})
+		if err != nil {
+			t.Fatalf("create part: %v", err)
+		}
+		a, err := m.SyncLowStockAlert(ctx, p.ID)
+		if err != nil || a == nil {
+			t.Fatalf("sync alert: %v, %v", a, err)
+		}
+		want = append(want, "id: "+a.ID.Hex())
+	}
+
+	// the stream runs until the client goes away
+	reqCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/alerts/stream", nil).WithContext(reqCtx)
+	req.Header.Set("Last-Event-ID", primitive.NewObjectIDFromTimestamp(time.Now().Add(-time.Hour)).Hex())
+	rec := httptest.NewRecorder()
+	AlertStreamHandler(m, NewEventHub())(rec, req)
+
+	var got []string
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if strings.HasPrefix(line, "id: ") {
+			got = append(got, line)
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("replayed %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	CustomerID primitive.ObjectID
+	SessionID  primitive.ObjectID
+	Role       models.Role
+}
+
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the caller put into the context by Authenticate.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// TokenIssuer signs and verifies HS256 JWT access tokens and mints opaque
+// refresh tokens.
+type TokenIssuer struct {
+	secret     []byte
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+func NewTokenIssuer(secret []byte) *TokenIssuer {
+	return &TokenIssuer{
+		secret:     secret,
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: 30 * 24 * time.Hour,
+	}
+}
+
+type accessClaims struct {
+	Sub  string      `json:"sub"`
+	Sid  string      `json:"sid"`
+	Role models.Role `json:"role"`
+	Iat  int64       `json:"iat"`
+	Exp  int64       `json:"exp"`
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func (t *TokenIssuer) AccessToken(p Principal, now time.Time) (string, error) {
+	payload, err := json.Marshal(accessClaims{
+		Sub:  p.CustomerID.Hex(),
+		Sid:  p.SessionID.Hex(),
+		Role: p.Role,
+		Iat:  now.Unix(),
+		Exp:  now.Add(t.AccessTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signing := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signing + "." + t.sign(signing), nil
+}
+
+// ParseAccessToken checks the signature and expiry; it does not look at the
+// session, which is the middleware's job.
+func (t *TokenIssuer) ParseAccessToken(tok string, now time.Time) (Principal, error) {
+	parts := strings.Split(tok, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return Principal{}, ErrInvalidToken
+	}
+	want := t.sign(parts[0] + "." + parts[1])
+	if subtle.ConstantTimeCompare([]byte(want), []byte(parts[2])) != 1 {
+		return Principal{}, ErrInvalidToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Principal{}, ErrInvalidToken
+	}
+	var c accessClaims
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return Principal{}, ErrInvalidToken
+	}
+	if now.Unix() >= c.Exp {
+		return Principal{}, ErrInvalidToken
+	}
+	cid, err1 := primitive.ObjectIDFromHex(c.Sub)
+	sid, err2 := primitive.ObjectIDFromHex(c.Sid)
+	if err1 != nil || err2 != nil {
+		return Principal{}, ErrInvalidToken
+	}
+	if !c.Role.Valid() {
+		return Principal{}, ErrInvalidToken
+	}
+	return Principal{CustomerID: cid, SessionID: sid, Role: c.Role}, nil
+}
+
+func (t *TokenIssuer) sign(s string) string {
+	m := hmac.New(sha256.New, t.secret)
+	m.Write([]byte(s))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// NewRefreshToken returns "<session id>.<random>" and the hash to store.
+// Only the hash is persisted, so a leaked sessions collection cannot be
+// replayed.
+func NewRefreshToken(sessionID primitive.ObjectID) (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = sessionID.Hex() + "." + base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// SplitRefreshToken extracts the session id from a refresh token.
+func SplitRefreshToken(tok string) (primitive.ObjectID, bool) {
+	sid, _, ok := strings.Cut(tok, ".")
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+	id, err := primitive.ObjectIDFromHex(sid)
+	return id, err == nil
+}
+
+func hashToken(tok string) string {
+	sum := sha256.Sum256([]byte(tok))
+	return hex.EncodeToString(sum[:])
+}
+
+type authFailureKey struct{}
+
+// authFailure is why Authenticate turned the request's credentials down,
+// if it did.
+func authFailure(ctx context.Context) (string, bool) {
+	msg, ok := ctx.Value(authFailureKey{}).(string)
+	return msg, ok
+}
+
+// Authenticate resolves a "Bearer" access token into a Principal. Requests
+// without a token pass through anonymously, and so do those whose token is
+// bad or whose session is revoked: a public route, refreshing the token
+// among them, still works for them, and Authorize answers 401 with the
+// reason on a route that needs a caller.
+func Authenticate(tokens *TokenIssuer, sessions SessionStore, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := r.Header.Get("Authorization")
+		if h == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		anonymous := func(reason string) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authFailureKey{}, reason)))
+		}
+		tok, ok := strings.CutPrefix(h, "Bearer ")
+		if !ok {
+			anonymous("invalid authorization header")
+			return
+		}
+
+		p, err := tokens.ParseAccessToken(tok, time.Now())
+		if err != nil {
+			anonymous(err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		s, err := sessions.GetSession(ctx, p.SessionID)
+		if err != nil || !s.Active(time.Now()) || s.CustomerID != p.CustomerID {
+			anonymous("session expired")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+	})
+}
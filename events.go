@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sync"
+)
+
+// Event types pushed on /alerts/stream.
+const (
+	EventAlertOpened = "alert.opened"
+)
+
+// Event is one message for stream subscribers. Events with an ID can be
+// resumed after a reconnect through Last-Event-ID.
+type Event struct {
+	ID   string
+	Type string
+	Data any
+}
+
+// subscriberBuffer is how far a subscriber may fall behind before it is
+// dropped; it then reconnects and resumes from its last event ID.
+const subscriberBuffer = 64
+
+// EventHub fans events produced by the workers out to every subscriber.
+// Publish never blocks the producer.
+type EventHub struct {
+	mu     sync.Mutex
+	subs   map[chan Event]struct{}
+	closed bool
+}
+
+func NewEventHub() *EventHub {
+	return &EventHub{subs: map[chan Event]struct{}{}}
+}
+
+// Subscribe returns the subscriber's channel and the function that ends the
+// subscription. The channel is closed when the subscription ends, when the
+// subscriber falls behind, or when the hub closes.
+func (h *EventHub) Subscribe() (<-chan Event, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	h.subs[ch] = struct{}{}
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.dropLocked(ch)
+	}
+}
+
+func (h *EventHub) Publish(ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+			h.dropLocked(ch)
+		}
+	}
+}
+
+// Close ends every subscription so open streams return, e.g. on shutdown.
+func (h *EventHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for ch := range h.subs {
+		h.dropLocked(ch)
+	}
+}
+
+func (h *EventHub) dropLocked(ch chan Event) {
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
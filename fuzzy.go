@@ -0,0 +1,184 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Weights of the ways a query word can match a term, relative to an exact
+// stem match.
+const (
+	weightExact    = 1.0
+	weightSynonym  = 0.9
+	weightTranslit = 0.9
+	weightFuzzy    = 0.7
+	weightPrefix   = 0.6
+)
+
+// maxExpansions caps how many vocabulary terms one query word may stand for.
+const maxExpansions = 20
+
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "h", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "sh", 'ъ': "", 'ы': "i", 'ь': "", 'э': "e", 'ю': "iu",
+	'я': "ia",
+	// Kazakh
+	'ә': "a", 'ғ': "g", 'қ': "k", 'ң': "n", 'ө': "o", 'ұ': "u", 'ү': "u", 'һ': "h",
+	'і': "i",
+}
+
+// latinFold spells Latin the way Cyrillic transliterates, so both scripts
+// meet: "camry" and "камри" both become "kamri", "toyota" and "тойота"
+// "toiota".
+var latinFold = strings.NewReplacer(
+	"kh", "h", "ck", "k", "ph", "f", "ce", "se", "ci", "si", "cy", "si",
+	"ch", "ch", "c", "k", "q", "k", "x", "ks", "w", "v", "y", "i", "j", "i",
+)
+
+// foldWord transliterates a lower-case word to Latin and smooths over the
+// spellings transliteration varies on, then collapses doubled letters.
+func foldWord(w string) string {
+	var b strings.Builder
+	for _, r := range w {
+		if s, ok := cyrillicToLatin[r]; ok {
+			b.WriteString(s)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	rs := []rune(latinFold.Replace(b.String()))
+	out := rs[:0]
+	for i, r := range rs {
+		if i > 0 && r == rs[i-1] {
+			continue
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+// fuzzyLimit is how many edits a folded word of n letters may be away from
+// a term: none for short words, where one edit is another word.
+func fuzzyLimit(n int) int {
+	switch {
+	case n <= 3:
+		return 0
+	case n <= 5:
+		return 1
+	}
+	return 2
+}
+
+// editDistance is the optimal string alignment distance between a and b,
+// counting a swap of neighbours as one edit. It gives up and returns
+// limit+1 once the distance is sure to exceed limit.
+func editDistance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > limit || -d > limit {
+		return limit + 1
+	}
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j] + 1
+			if v := cur[j-1] + 1; v < cur[j] {
+				cur[j] = v
+			}
+			if v := prev[j-1] + cost; v < cur[j] {
+				cur[j] = v
+			}
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				if v := prev2[j-2] + 1; v < cur[j] {
+					cur[j] = v
+				}
+			}
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+// vocabTerm is an indexed term with its folded spelling.
+type vocabTerm struct {
+	term, fold string
+}
+
+func newVocabulary(terms []string) []vocabTerm {
+	out := make([]vocabTerm, 0, len(terms))
+	for _, t := range terms {
+		out = append(out, vocabTerm{term: t, fold: foldWord(t)})
+	}
+	return out
+}
+
+// expandWord lists the terms a query word may stand for: its own stem, and
+// the vocabulary terms it transliterates to, is a typo of or, with prefix,
+// starts. Closer matches come first.
+func expandWord(word string, vocab []vocabTerm, prefix bool) []termAlt {
+	own := stem(word)
+	alts := []termAlt{{Terms: []string{own}, Weight: weightExact}}
+	folds := []string{foldWord(word)}
+	if f := foldWord(own); f != folds[0] {
+		folds = append(folds, f)
+	}
+
+	type hit struct {
+		term   string
+		weight float64
+		dist   int
+	}
+	var hits []hit
+	for _, v := range vocab {
+		if v.term == own {
+			continue
+		}
+		best := hit{dist: -1}
+		for _, f := range folds {
+			limit := fuzzyLimit(utf8.RuneCountInString(f))
+			switch d := editDistance(f, v.fold, limit); {
+			case d == 0:
+				best = hit{v.term, weightTranslit, 0}
+			case d <= limit && (best.dist < 0 || d < best.dist):
+				best = hit{v.term, weightFuzzy, d}
+			case prefix && best.dist < 0 && utf8.RuneCountInString(f) >= 3 && strings.HasPrefix(v.fold, f):
+				best = hit{v.term, weightPrefix, len(v.fold) - len(f)}
+			}
+		}
+		if best.dist >= 0 {
+			hits = append(hits, best)
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].weight != hits[j].weight {
+			return hits[i].weight > hits[j].weight
+		}
+		return hits[i].dist < hits[j].dist
+	})
+	if len(hits) > maxExpansions {
+		hits = hits[:maxExpansions]
+	}
+	for _, h := range hits {
+		alts = append(alts, termAlt{Terms: []string{h.term}, Weight: h.weight})
+	}
+	return alts
+}
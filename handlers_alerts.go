@@ -1,13 +1,22 @@
 package main
 
 import (
+	"carparts/models"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func AlertsHandler(rp *Repo) http.HandlerFunc {
+func AlertsHandler(rp AlertStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			WriteError(w, 405, "method not allowed")
@@ -21,11 +30,16 @@ func AlertsHandler(rp *Repo) http.HandlerFunc {
 				limit = int64(n)
 			}
 		}
+		status := r.URL.Query().Get("status")
+		if status != "" && !models.ValidAlertStatus(status) {
+			WriteError(w, 400, "unknown status")
+			return
+		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
 		defer cancel()
 
-		alerts, err := rp.ListAlerts(ctx, limit)
+		alerts, err := rp.ListAlerts(ctx, status, limit)
 		if err != nil {
 			WriteError(w, 500, "db error")
 			return
@@ -33,3 +47,185 @@ func AlertsHandler(rp *Repo) http.HandlerFunc {
 		WriteJSON(w, 200, alerts)
 	}
 }
+
+func AlertByIDHandler(rp AlertStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		segs := pathSegments(r.URL.Path, "/alerts/")
+		if len(segs) == 0 {
+			WriteError(w, 400, "missing id")
+			return
+		}
+		if len(segs) > 1 {
+			WriteError(w, 404, "not found")
+			return
+		}
+		idStr := segs[0]
+		id, err := primitive.ObjectIDFromHex(idStr)
+		if err != nil {
+			WriteError(w, 400, "invalid id")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			a, err := rp.GetAlert(ctx, id)
+			if err != nil {
+				writeAlertError(w, err)
+				return
+			}
+			WriteJSON(w, 200, a)
+
+		case http.MethodPatch:
+			// acknowledge, resolve or reopen; see models.alertTransitions
+			var in struct {
+				Status string `json:"status"`
+			}
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+			if strings.TrimSpace(in.Status) == "" {
+				WriteError(w, 400, "status is required")
+				return
+			}
+			if !models.ValidAlertStatus(in.Status) {
+				WriteError(w, 400, "unknown status")
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			p, _ := PrincipalFrom(r.Context())
+			a, err := rp.UpdateAlertStatus(ctx, id, in.Status, p.CustomerID.Hex())
+			if err != nil {
+				writeAlertError(w, err)
+				return
+			}
+			WriteJSON(w, 200, a)
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+// streamHeartbeat keeps idle streams from being cut by proxies and lets a
+// client notice a dead connection.
+var streamHeartbeat = 15 * time.Second
+
+// alertReplayPage is how many missed alerts a resuming client is sent per
+// read; the replay reads on until it has sent them all.
+var alertReplayPage = 500
+
+// AlertStreamHandler pushes newly opened low-stock alerts as Server-Sent
+// Events. A client reconnecting with Last-Event-ID first receives every
+// alert opened since that one.
+func AlertStreamHandler(rp AlertStore, events *EventHub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, 405, "method not allowed")
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			WriteError(w, 500, "streaming unsupported")
+			return
+		}
+		var last primitive.ObjectID
+		if v := r.Header.Get("Last-Event-ID"); v != "" {
+			id, err := primitive.ObjectIDFromHex(v)
+			if err != nil {
+				WriteError(w, 400, "invalid Last-Event-ID")
+				return
+			}
+			last = id
+		}
+
+		// subscribe before replaying so nothing opened in between is missed;
+		// the ID check below drops what the replay already sent
+		ch, unsubscribe := events.Subscribe()
+		defer unsubscribe()
+
+		h := w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("Connection", "keep-alive")
+		h.Set("X-Accel-Buffering", "no")
+		w.WriteHeader(200)
+
+		for replay := !last.IsZero(); replay; {
+			ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+			missed, err := rp.ListAlertsSince(ctx, last, int64(alertReplayPage))
+			cancel()
+			if err != nil {
+				log.Printf("replaying alerts after %s: %v", last.Hex(), err)
+				return // the client retries from the last alert it got
+			}
+			for _, a := range missed {
+				if err := writeEvent(w, Event{ID: a.ID.Hex(), Type: EventAlertOpened, Data: a}); err != nil {
+					return
+				}
+				last = a.ID
+			}
+			flusher.Flush()
+			replay = len(missed) == alertReplayPage
+		}
+		flusher.Flush()
+
+		tick := time.NewTicker(streamHeartbeat)
+		defer tick.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case ev, ok := <-ch:
+				if !ok {
+					return // fell behind or shutting down; the client resumes
+				}
+				if id, err := primitive.ObjectIDFromHex(ev.ID); err == nil {
+					if !idLess(last, id) {
+						continue
+					}
+					last = id
+				}
+				if err := writeEvent(w, ev); err != nil {
+					return
+				}
+			case <-tick.C:
+				if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev Event) error {
+	data, err := json.Marshal(ev.Data)
+	if err != nil {
+		return err
+	}
+	if ev.ID != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", ev.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+	return err
+}
+
+func writeAlertError(w http.ResponseWriter, err error) {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		WriteError(w, 404, "not found")
+	case errors.Is(err, ErrInvalidTransition), errors.Is(err, ErrConflict):
+		WriteError(w, 409, err.Error())
+	default:
+		WriteError(w, 500, "db error")
+	}
+}
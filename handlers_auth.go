@@ -0,0 +1,191 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// dummyCustomer makes failed lookups cost one bcrypt comparison too, so
+// response timing does not reveal which emails are registered.
+var dummyCustomer = func() models.Customer {
+	var c models.Customer
+	_ = c.SetPassword("not-a-real-password")
+	return c
+}()
+
+// POST /auth/login {email, password}
+func LoginHandler(rp Store, tokens *TokenIssuer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, 405, "method not allowed")
+			return
+		}
+		var in struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
+		if err := ReadJSON(r, &in); err != nil {
+			WriteError(w, 400, "invalid json")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+
+		c, err := rp.GetCustomerByEmail(ctx, models.NormalizeEmail(in.Email))
+		if err != nil && err != mongo.ErrNoDocuments {
+			WriteError(w, 500, "db error")
+			return
+		}
+		if err == mongo.ErrNoDocuments {
+			dummyCustomer.Login(in.Password)
+			WriteError(w, 401, "invalid email or password")
+			return
+		}
+		if !c.Login(in.Password) {
+			WriteError(w, 401, "invalid email or password")
+			return
+		}
+
+		now := time.Now()
+		s := models.Session{
+			ID:         primitive.NewObjectID(),
+			CustomerID: c.ID,
+			CreatedAt:  now,
+			ExpiresAt:  now.Add(tokens.RefreshTTL),
+		}
+		refresh, hash, err := NewRefreshToken(s.ID)
+		if err != nil {
+			WriteError(w, 500, "token error")
+			return
+		}
+		s.RefreshHash = hash
+		if _, err := rp.CreateSession(ctx, s); err != nil {
+			WriteError(w, 500, "db error")
+			return
+		}
+
+		access, err := tokens.AccessToken(Principal{CustomerID: c.ID, SessionID: s.ID, Role: c.AccountRole()}, now)
+		if err != nil {
+			WriteError(w, 500, "token error")
+			return
+		}
+		WriteJSON(w, 200, tokenResponse{
+			AccessToken:  access,
+			TokenType:    "Bearer",
+			ExpiresIn:    int64(tokens.AccessTTL.Seconds()),
+			RefreshToken: refresh,
+		})
+	}
+}
+
+// POST /auth/refresh {refresh_token}
+// The refresh token is rotated: the old one stops working once redeemed.
+func RefreshHandler(rp Store, tokens *TokenIssuer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, 405, "method not allowed")
+			return
+		}
+		var in struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := ReadJSON(r, &in); err != nil {
+			WriteError(w, 400, "invalid json")
+			return
+		}
+		sid, ok := SplitRefreshToken(in.RefreshToken)
+		if !ok {
+			WriteError(w, 401, ErrInvalidToken.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+
+		s, err := rp.GetSession(ctx, sid)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				WriteError(w, 401, ErrInvalidToken.Error())
+				return
+			}
+			WriteError(w, 500, "db error")
+			return
+		}
+		now := time.Now()
+		if !s.Active(now) || s.RefreshHash != hashToken(in.RefreshToken) {
+			WriteError(w, 401, ErrInvalidToken.Error())
+			return
+		}
+
+		refresh, hash, err := NewRefreshToken(s.ID)
+		if err != nil {
+			WriteError(w, 500, "token error")
+			return
+		}
+		if err := rp.RotateSession(ctx, s.ID, s.RefreshHash, hash, now.Add(tokens.RefreshTTL)); err != nil {
+			if err == mongo.ErrNoDocuments {
+				// redeemed concurrently by someone else
+				WriteError(w, 401, ErrInvalidToken.Error())
+				return
+			}
+			WriteError(w, 500, "db error")
+			return
+		}
+
+		// re-read the account so role changes apply from the next refresh
+		c, err := rp.GetCustomer(ctx, s.CustomerID)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				WriteError(w, 401, ErrInvalidToken.Error())
+				return
+			}
+			WriteError(w, 500, "db error")
+			return
+		}
+
+		access, err := tokens.AccessToken(Principal{CustomerID: s.CustomerID, SessionID: s.ID, Role: c.AccountRole()}, now)
+		if err != nil {
+			WriteError(w, 500, "token error")
+			return
+		}
+		WriteJSON(w, 200, tokenResponse{
+			AccessToken:  access,
+			TokenType:    "Bearer",
+			ExpiresIn:    int64(tokens.AccessTTL.Seconds()),
+			RefreshToken: refresh,
+		})
+	}
+}
+
+// POST /auth/logout revokes the caller's session and every token issued for it.
+func LogoutHandler(rp SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, 405, "method not allowed")
+			return
+		}
+		p, _ := PrincipalFrom(r.Context())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+
+		if err := rp.RevokeSession(ctx, p.SessionID); err != nil {
+			WriteError(w, 500, "db error")
+			return
+		}
+		WriteJSON(w, 200, map[string]string{"status": "logged out"})
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// cartSessionHeader carries the token of an anonymous cart. The token is
+// handed out once, on the response that created the cart; only its hash is
+// stored.
+const cartSessionHeader = "X-Cart-Session"
+
+// CartHandler serves the caller's cart, the signed-in customer's or the
+// anonymous one named by X-Cart-Session:
+//
+//	GET    /cart                  prices and stock revalidated
+//	DELETE /cart                  empties it
+//	POST   /cart/items            {part_id, quantity, warehouse_id?} adds to a line
+//	PUT    /cart/items/{part_id}  {quantity} sets a line, 0 removes it
+//	DELETE /cart/items/{part_id}
+//	POST   /cart/checkout         turns it into an order
+func CartHandler(rp Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/cart"), "/")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 12*time.Second)
+		defer cancel()
+
+		c, ok := loadCart(ctx, w, r, rp)
+		if !ok {
+			return
+		}
+
+		switch {
+		case path == "" && r.Method == http.MethodGet:
+			view, changed, err := revalidateCart(ctx, rp, &c)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			if changed {
+				if c, ok = saveCart(ctx, w, rp, c); !ok {
+					return
+				}
+			}
+			WriteJSON(w, 200, view)
+
+		case path == "" && r.Method == http.MethodDelete:
+			if !c.ID.IsZero() {
+				c.Items = nil
+				if c, ok = saveCart(ctx, w, rp, c); !ok {
+					return
+				}
+			}
+			view, _, err := revalidateCart(ctx, rp, &c)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, view)
+
+		case path == "items" && r.Method == http.MethodPost:
+			var in struct {
+				PartID      string `json:"part_id"`
+				Quantity    int    `json:"quantity"`
+				WarehouseID string `json:"warehouse_id"`
+			}
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+			pid, err := primitive.ObjectIDFromHex(in.PartID)
+			if err != nil {
+				WriteError(w, 400, "invalid part_id")
+				return
+			}
+			if in.Quantity <= 0 {
+				WriteError(w, 400, "quantity must be > 0")
+				return
+			}
+			it := models.CartItem{PartID: pid, Quantity: in.Quantity}
+			if in.WarehouseID != "" {
+				wid, err := primitive.ObjectIDFromHex(in.WarehouseID)
+				if err != nil {
+					WriteError(w, 400, "invalid warehouse_id")
+					return
+				}
+				it.WarehouseID = &wid
+			}
+			if i := c.Line(pid); i >= 0 {
+				it.Quantity += c.Items[i].Quantity
+				if it.WarehouseID == nil {
+					it.WarehouseID = c.Items[i].WarehouseID
+				}
+			}
+			updateCartLine(ctx, w, rp, c, it, 201)
+
+		case strings.HasPrefix(path, "items/"):
+			pid, err := primitive.ObjectIDFromHex(strings.TrimPrefix(path, "items/"))
+			if err != nil {
+				WriteError(w, 400, "invalid part_id")
+				return
+			}
+			i := c.Line(pid)
+			if i < 0 {
+				WriteError(w, 404, "part is not in the cart")
+				return
+			}
+			it := c.Items[i]
+
+			switch r.Method {
+			case http.MethodPut:
+				var in struct {
+					Quantity int `json:"quantity"`
+				}
+				if err := ReadJSON(r, &in); err != nil {
+					WriteError(w, 400, "invalid json")
+					return
+				}
+				if in.Quantity < 0 {
+					WriteError(w, 400, "quantity must be >= 0")
+					return
+				}
+				it.Quantity = in.Quantity
+				updateCartLine(ctx, w, rp, c, it, 200)
+
+			case http.MethodDelete:
+				it.Quantity = 0
+				updateCartLine(ctx, w, rp, c, it, 200)
+
+			default:
+				WriteError(w, 405, "method not allowed")
+			}
+
+		case path == "checkout" && r.Method == http.MethodPost:
+			checkoutCart(ctx, w, r, rp, c)
+
+		case path == "" || path == "items" || path == "checkout":
+			WriteError(w, 405, "method not allowed")
+
+		default:
+			WriteError(w, 404, "not found")
+		}
+	}
+}
+
+// loadCart resolves the caller's cart. A cart that does not exist yet comes
+// back with a zero ID and is created by the first saveCart. A signed-in
+// caller still sending X-Cart-Session gets that anonymous cart merged into
+// their own.
+func loadCart(ctx context.Context, w http.ResponseWriter, r *http.Request, rp CartStore) (models.Cart, bool) {
+	var anon models.Cart
+	if tok := r.Header.Get(cartSessionHeader); tok != "" {
+		c, err := rp.GetSessionCart(ctx, hashToken(tok))
+		if err != nil && err != mongo.ErrNoDocuments {
+			WriteError(w, 500, "db error")
+			return models.Cart{}, false
+		}
+		anon = c // zero when the token is unknown or the cart expired
+	}
+
+	p, signed := PrincipalFrom(r.Context())
+	if !signed {
+		return anon, true
+	}
+
+	c, err := rp.GetCustomerCart(ctx, p.CustomerID)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			WriteError(w, 500, "db error")
+			return models.Cart{}, false
+		}
+		cid := p.CustomerID
+		c = models.Cart{CustomerID: &cid}
+	}
+	if anon.ID.IsZero() {
+		return c, true
+	}
+
+	for _, it := range anon.Items {
+		if i := c.Line(it.PartID); i >= 0 {
+			it.Quantity += c.Items[i].Quantity
+		}
+		c.SetLine(it)
+	}
+	c, ok := saveCart(ctx, w, rp, c)
+	if !ok {
+		return models.Cart{}, false
+	}
+	if err := rp.DeleteCart(ctx, anon.ID); err != nil {
+		WriteError(w, 500, "db error")
+		return models.Cart{}, false
+	}
+	return c, true
+}
+
+// saveCart stores c, handing a new anonymous cart its session token. It
+// writes the error response itself and reports success.
+func saveCart(ctx context.Context, w http.ResponseWriter, rp CartStore, c models.Cart) (models.Cart, bool) {
+	now := time.Now()
+	if c.ID.IsZero() {
+		c.CreatedAt = now
+		if c.CustomerID == nil {
+			b := make([]byte, 24)
+			if _, err := rand.Read(b); err != nil {
+				WriteError(w, 500, "internal error")
+				return models.Cart{}, false
+			}
+			tok := base64.RawURLEncoding.EncodeToString(b)
+			c.SessionHash = hashToken(tok)
+			w.Header().Set(cartSessionHeader, tok)
+		}
+	}
+	c.UpdatedAt = now
+
+	out, err := rp.SaveCart(ctx, c)
+	if err != nil {
+		if errors.Is(err, ErrDuplicate) {
+			WriteError(w, 409, "cart was created concurrently, try again")
+			return models.Cart{}, false
+		}
+		WriteError(w, 500, "db error")
+		return models.Cart{}, false
+	}
+	return out, true
+}
+
+// updateCartLine checks a new or changed line against the part's current
+// price and stock, saves the cart and writes it.
+func updateCartLine(ctx context.Context, w http.ResponseWriter, rp Store, c models.Cart, it models.CartItem, status int) {
+	if it.Quantity > 0 {
+		p, err := rp.GetPart(ctx, it.PartID)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				WriteError(w, 404, "part not found")
+				return
+			}
+			WriteError(w, 500, "db error")
+			return
+		}
+		if !p.IsActive {
+			WriteError(w, 409, "part is no longer sold")
+			return
+		}
+		avail, err := availableToPromise(ctx, rp, p, it.WarehouseID)
+		if err != nil {
+			WriteError(w, 500, "db error")
+			return
+		}
+		if it.Quantity > avail {
+			WriteError(w, 409, fmt.Sprintf("only %d available", avail))
+			return
+		}
+		it.Price = p.Price
+	}
+	c.SetLine(it)
+
+	view, _, err := revalidateCart(ctx, rp, &c)
+	if err != nil {
+		WriteError(w, 500, "db error")
+		return
+	}
+	saved, ok := saveCart(ctx, w, rp, c)
+	if !ok {
+		return
+	}
+	view.ID = &saved.ID
+	WriteJSON(w, status, view)
+}
+
+// checkoutCart places the cart as an order through the same path as
+// POST /orders. A cart whose prices moved or whose stock ran short since the
+// customer last saw it is refused with 409 and the revalidated cart, so the
+// second attempt goes through at the prices they have now seen.
+func checkoutCart(ctx context.Context, w http.ResponseWriter, r *http.Request, rp Store, c models.Cart) {
+	if len(c.Items) == 0 {
+		WriteError(w, 400, "cart is empty")
+		return
+	}
+
+	view, changed, err := revalidateCart(ctx, rp, &c)
+	if err != nil {
+		WriteError(w, 500, "db error")
+		return
+	}
+	if changed {
+		var ok bool
+		if c, ok = saveCart(ctx, w, rp, c); !ok {
+			return
+		}
+	}
+	if !view.ReadyForCheckout {
+		WriteJSON(w, 409, map[string]any{
+			"error": "cart changed, review it before checkout",
+			"cart":  view,
+		})
+		return
+	}
+
+	items := make([]models.OrderItem, 0, len(c.Items))
+	for _, it := range c.Items {
+		items = append(items, models.OrderItem{PartID: it.PartID, Quantity: it.Quantity, WarehouseID: it.WarehouseID})
+	}
+	p, _ := PrincipalFrom(r.Context())
+	o, ok := placeOrder(ctx, w, rp, p, p.CustomerID, items)
+	if !ok {
+		return
+	}
+	// the order is placed; a cart left behind is only an inconvenience
+	_ = rp.DeleteCart(ctx, c.ID)
+	WriteJSON(w, 201, o)
+}
+
+type cartLine struct {
+	models.CartItem
+	PreviousPrice *float64 `json:"previous_price,omitempty"`
+	Available     int      `json:"available"`
+	Subtotal      float64  `json:"subtotal"`
+	Problem       string   `json:"problem,omitempty"`
+}
+
+type cartView struct {
+	ID               *primitive.ObjectID `json:"id,omitempty"`
+	Items            []cartLine          `json:"items"`
+	Total            float64             `json:"total"`
+	ReadyForCheckout bool                `json:"ready_for_checkout"`
+}
+
+// revalidateCart refreshes every line's price from its part and checks it
+// against available-to-promise stock. It reports whether a stored price
+// changed, in which case the caller should save c.
+func revalidateCart(ctx context.Context, rp Store, c *models.Cart) (cartView, bool, error) {
+	view := cartView{Items: make([]cartLine, 0, len(c.Items)), ReadyForCheckout: len(c.Items) > 0}
+	if !c.ID.IsZero() {
+		view.ID = &c.ID
+	}
+
+	changed := false
+	for i := range c.Items {
+		it := &c.Items[i]
+		line := cartLine{}
+
+		p, err := rp.GetPart(ctx, it.PartID)
+		switch {
+		case err == mongo.ErrNoDocuments || (err == nil && !p.IsActive):
+			line.Problem = "part is no longer sold"
+		case err != nil:
+			return cartView{}, false, err
+		default:
+			if p.Price != it.Price {
+				old := it.Price
+				line.PreviousPrice = &old
+				line.Problem = "price changed"
+				it.Price = p.Price
+				changed = true
+			}
+			avail, err := availableToPromise(ctx, rp, p, it.WarehouseID)
+			if err != nil {
+				return cartView{}, false, err
+			}
+			line.Available = avail
+			if it.Quantity > avail {
+				line.Problem = fmt.Sprintf("only %d available", avail)
+			}
+		}
+
+		line.CartItem = *it
+		line.Subtotal = it.Price * float64(it.Quantity)
+		view.Total += line.Subtotal
+		if line.Problem != "" {
+			view.ReadyForCheckout = false
+		}
+		view.Items = append(view.Items, line)
+	}
+	return view, changed, nil
+}
+
+// availableToPromise is how much of p can still be sold, from one warehouse
+// when warehouseID is set.
+func availableToPromise(ctx context.Context, rp WarehouseStore, p models.SparePart, warehouseID *primitive.ObjectID) (int, error) {
+	if warehouseID == nil {
+		return p.Available(), nil
+	}
+	levels, err := rp.PartInventory(ctx, p.ID)
+	if err != nil {
+		return 0, err
+	}
+	for _, l := range levels {
+		if l.WarehouseID == *warehouseID {
+			return l.Available(), nil
+		}
+	}
+	return 0, nil
+}
@@ -11,7 +11,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func CategoriesHandler(rp *Repo) http.HandlerFunc {
+func CategoriesHandler(rp CategoryStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 
@@ -28,8 +28,10 @@ func CategoriesHandler(rp *Repo) http.HandlerFunc {
 
 		case http.MethodPost:
 			var in struct {
-				Name        string `json:"name"`
-				Description string `json:"description"`
+				Name         string `json:"name"`
+				Description  string `json:"description"`
+				ReorderPoint *int   `json:"reorder_point"`
+				SafetyStock  *int   `json:"safety_stock"`
 			}
 			if err := ReadJSON(r, &in); err != nil {
 				WriteError(w, 400, "invalid json")
@@ -39,11 +41,20 @@ func CategoriesHandler(rp *Repo) http.HandlerFunc {
 				WriteError(w, 400, "name is required")
 				return
 			}
+			thresholds := models.StockThresholds{ReorderPoint: in.ReorderPoint, SafetyStock: in.SafetyStock}
+			if !validThresholds(w, thresholds) {
+				return
+			}
 
 			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
 			defer cancel()
 
-			c := models.Category{Name: in.Name, Description: in.Description, PartsList: []primitive.ObjectID{}}
+			c := models.Category{
+				Name:            in.Name,
+				Description:     in.Description,
+				PartsList:       []primitive.ObjectID{},
+				StockThresholds: thresholds,
+			}
 			out, err := rp.CreateCategory(ctx, c)
 			if err != nil {
 				WriteError(w, 500, "db error")
@@ -57,13 +68,18 @@ func CategoriesHandler(rp *Repo) http.HandlerFunc {
 	}
 }
 
-func CategoryByIDHandler(rp *Repo) http.HandlerFunc {
+func CategoryByIDHandler(rp CategoryStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idStr := strings.TrimPrefix(r.URL.Path, "/categories/")
-		if idStr == "" {
+		segs := pathSegments(r.URL.Path, "/categories/")
+		if len(segs) == 0 {
 			WriteError(w, 400, "missing id")
 			return
 		}
+		if len(segs) > 1 {
+			WriteError(w, 404, "not found")
+			return
+		}
+		idStr := segs[0]
 		id, err := primitive.ObjectIDFromHex(idStr)
 		if err != nil {
 			WriteError(w, 400, "invalid id")
@@ -88,18 +104,38 @@ func CategoryByIDHandler(rp *Repo) http.HandlerFunc {
 
 		case http.MethodPut:
 			var in struct {
-				Name        string `json:"name"`
-				Description string `json:"description"`
+				Name         string `json:"name"`
+				Description  string `json:"description"`
+				ReorderPoint *int   `json:"reorder_point"`
+				SafetyStock  *int   `json:"safety_stock"`
 			}
 			if err := ReadJSON(r, &in); err != nil {
 				WriteError(w, 400, "invalid json")
 				return
 			}
+			// thresholds are replaced together: sending one clears the other
+			thresholds := models.StockThresholds{ReorderPoint: in.ReorderPoint, SafetyStock: in.SafetyStock}
+			if !validThresholds(w, thresholds) {
+				return
+			}
+			setThresholds := thresholds.ReorderPoint != nil || thresholds.SafetyStock != nil
+
 			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
 			defer cancel()
 
-			c, err := rp.UpdateCategory(ctx, id, in.Name, in.Description)
+			var c models.Category
+			var err error
+			if in.Name != "" || in.Description != "" || !setThresholds {
+				c, err = rp.UpdateCategory(ctx, id, in.Name, in.Description)
+			}
+			if err == nil && setThresholds {
+				c, err = rp.SetCategoryThresholds(ctx, id, thresholds)
+			}
 			if err != nil {
+				if err == mongo.ErrNoDocuments {
+					WriteError(w, 404, "not found")
+					return
+				}
 				WriteError(w, 500, "db error")
 				return
 			}
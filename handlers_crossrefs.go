@@ -0,0 +1,179 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GET  /cross-references?number=
+// POST /cross-references {numbers: [{brand, number}], note}
+func CrossReferencesHandler(rp CrossReferenceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+
+		case http.MethodGet:
+			var keys []string
+			if v := r.URL.Query().Get("number"); v != "" {
+				keys = []string{models.PartNumberKey(v)}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			list, err := rp.ListCrossReferences(ctx, keys)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, list)
+
+		case http.MethodPost:
+			var in struct {
+				Numbers []models.PartNumberRef `json:"numbers"`
+				Note    string                 `json:"note"`
+			}
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+			now := time.Now()
+			x := models.CrossReference{
+				Numbers:   in.Numbers,
+				Note:      strings.TrimSpace(in.Note),
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			if !validCrossReference(w, &x) {
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			out, err := rp.CreateCrossReference(ctx, x)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 201, out)
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+// GET|PUT|DELETE /cross-references/{id}
+func CrossReferenceByIDHandler(rp CrossReferenceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		segs := pathSegments(r.URL.Path, "/cross-references/")
+		if len(segs) == 0 {
+			WriteError(w, 400, "missing id")
+			return
+		}
+		if len(segs) > 1 {
+			WriteError(w, 404, "not found")
+			return
+		}
+		idStr := segs[0]
+		id, err := primitive.ObjectIDFromHex(idStr)
+		if err != nil {
+			WriteError(w, 400, "invalid id")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			x, err := rp.GetCrossReference(ctx, id)
+			if err != nil {
+				writeCrossReferenceError(w, err)
+				return
+			}
+			WriteJSON(w, 200, x)
+
+		case http.MethodPut:
+			var in struct {
+				Numbers []models.PartNumberRef `json:"numbers"`
+				Note    *string                `json:"note"`
+			}
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			x, err := rp.GetCrossReference(ctx, id)
+			if err != nil {
+				writeCrossReferenceError(w, err)
+				return
+			}
+			if in.Numbers != nil {
+				x.Numbers = in.Numbers
+			}
+			if in.Note != nil {
+				x.Note = strings.TrimSpace(*in.Note)
+			}
+			x.UpdatedAt = time.Now()
+			if !validCrossReference(w, &x) {
+				return
+			}
+
+			out, err := rp.ReplaceCrossReference(ctx, x)
+			if err != nil {
+				writeCrossReferenceError(w, err)
+				return
+			}
+			WriteJSON(w, 200, out)
+
+		case http.MethodDelete:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			if err := rp.DeleteCrossReference(ctx, id); err != nil {
+				writeCrossReferenceError(w, err)
+				return
+			}
+			WriteJSON(w, 200, map[string]string{"deleted": idStr})
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+// validCrossReference normalizes x and checks that it links at least two
+// distinct numbers, each with a brand. It writes the error response itself
+// and reports success.
+func validCrossReference(w http.ResponseWriter, x *models.CrossReference) bool {
+	for _, n := range x.Numbers {
+		if strings.TrimSpace(n.Brand) == "" || models.PartNumberKey(n.Number) == "" {
+			WriteError(w, 400, "every number needs a brand and a number")
+			return false
+		}
+	}
+	x.Normalize()
+	if len(x.Numbers) < 2 {
+		WriteError(w, 400, "at least two distinct numbers are required")
+		return false
+	}
+	return true
+}
+
+func writeCrossReferenceError(w http.ResponseWriter, err error) {
+	if err == mongo.ErrNoDocuments {
+		WriteError(w, 404, "not found")
+		return
+	}
+	WriteError(w, 500, "db error")
+}
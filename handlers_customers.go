@@ -0,0 +1,248 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const minPasswordLen = 8
+
+func CustomersHandler(rp CustomerStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+
+		case http.MethodGet:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			customers, err := rp.ListCustomers(ctx)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, customers)
+
+		case http.MethodPost:
+			var in struct {
+				FirstName string `json:"first_name"`
+				Phone     string `json:"phone"`
+				Email     string `json:"email"`
+				Password  string `json:"password"`
+			}
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+			c := models.Customer{
+				FirstName: strings.TrimSpace(in.FirstName),
+				Phone:     models.NormalizePhone(in.Phone),
+				Email:     models.NormalizeEmail(in.Email),
+				Role:      models.RoleCustomer,
+				CreatedAt: time.Now(),
+			}
+			if c.FirstName == "" {
+				WriteError(w, 400, "first_name is required")
+				return
+			}
+			if !validEmail(c.Email) {
+				WriteError(w, 400, "valid email is required")
+				return
+			}
+			if len(in.Password) < minPasswordLen {
+				WriteError(w, 400, "password must be at least 8 characters")
+				return
+			}
+			if err := c.SetPassword(in.Password); err != nil {
+				WriteError(w, 500, "password error")
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			out, err := rp.CreateCustomer(ctx, c)
+			if err != nil {
+				if errors.Is(err, ErrDuplicate) {
+					WriteError(w, 409, "email or phone already registered")
+					return
+				}
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 201, out)
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+func CustomerByIDHandler(rp Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		segs := pathSegments(r.URL.Path, "/customers/")
+		if len(segs) == 0 {
+			WriteError(w, 400, "missing id")
+			return
+		}
+		if len(segs) > 2 || len(segs) == 2 && segs[1] != "orders" {
+			WriteError(w, 404, "not found")
+			return
+		}
+		idStr := segs[0]
+		id, err := primitive.ObjectIDFromHex(idStr)
+		if err != nil {
+			WriteError(w, 400, "invalid id")
+			return
+		}
+
+		p, _ := PrincipalFrom(r.Context())
+
+		// /customers/{id}/orders: own history, or any customer's for staff
+		if len(segs) == 2 {
+			if r.Method != http.MethodGet {
+				WriteError(w, 405, "method not allowed")
+				return
+			}
+			if p.CustomerID != id && !p.Role.IsStaff() {
+				WriteError(w, 403, "forbidden")
+				return
+			}
+			writeOrdersPage(w, r, rp, OrderFilter{CustomerID: &id, Status: r.URL.Query().Get("status")})
+			return
+		}
+
+		// a customer can only see and change their own profile
+		if p.CustomerID != id && p.Role != models.RoleAdmin {
+			WriteError(w, 403, "forbidden")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			c, err := rp.GetCustomer(ctx, id)
+			if err != nil {
+				if err == mongo.ErrNoDocuments {
+					WriteError(w, 404, "not found")
+					return
+				}
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, c)
+
+		case http.MethodPut, http.MethodPatch:
+			var in struct {
+				FirstName *string `json:"first_name"`
+				Phone     *string `json:"phone"`
+				Email     *string `json:"email"`
+				Password  *string `json:"password"`
+				Role      *string `json:"role"`
+			}
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+
+			upd := bson.M{}
+			if in.FirstName != nil {
+				if strings.TrimSpace(*in.FirstName) == "" {
+					WriteError(w, 400, "first_name must not be empty")
+					return
+				}
+				upd["first_name"] = strings.TrimSpace(*in.FirstName)
+			}
+			if in.Phone != nil {
+				upd["phone"] = models.NormalizePhone(*in.Phone)
+			}
+			if in.Email != nil {
+				email := models.NormalizeEmail(*in.Email)
+				if !validEmail(email) {
+					WriteError(w, 400, "invalid email")
+					return
+				}
+				upd["email"] = email
+			}
+			if in.Password != nil {
+				if len(*in.Password) < minPasswordLen {
+					WriteError(w, 400, "password must be at least 8 characters")
+					return
+				}
+				var c models.Customer
+				if err := c.SetPassword(*in.Password); err != nil {
+					WriteError(w, 500, "password error")
+					return
+				}
+				upd["password_hash"] = c.PasswordHash
+			}
+			if in.Role != nil {
+				if p.Role != models.RoleAdmin {
+					WriteError(w, 403, "only admins can change roles")
+					return
+				}
+				role := models.Role(*in.Role)
+				if !role.Valid() {
+					WriteError(w, 400, "invalid role")
+					return
+				}
+				upd["role"] = role
+			}
+			if len(upd) == 0 {
+				WriteError(w, 400, "nothing to update")
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			c, err := rp.UpdateCustomer(ctx, id, upd)
+			if err != nil {
+				if err == mongo.ErrNoDocuments {
+					WriteError(w, 404, "not found")
+					return
+				}
+				if errors.Is(err, ErrDuplicate) {
+					WriteError(w, 409, "email or phone already registered")
+					return
+				}
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, c)
+
+		case http.MethodDelete:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			if err := rp.DeleteCustomer(ctx, id); err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, map[string]string{"deleted": idStr})
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+// validEmail is a sanity check, not RFC 5322: one '@' with text on both
+// sides and a dot in the domain.
+func validEmail(s string) bool {
+	at := strings.Index(s, "@")
+	if at <= 0 || at != strings.LastIndex(s, "@") {
+		return false
+	}
+	domain := s[at+1:]
+	return strings.Contains(domain, ".") && !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".")
+}
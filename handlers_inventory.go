@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// GET /inventory/reorder-suggestions?window_days=&cover_days=
+//
+// window_days (default 30) is how much order history the daily demand is
+// averaged over; cover_days (default 14) is how long an order should last
+// beyond the supplier's lead time.
+func ReorderSuggestionsHandler(rp Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, 405, "method not allowed")
+			return
+		}
+		opt := ReorderOptions{WindowDays: defaultDemandWindowDays, CoverDays: defaultCoverDays}
+		q := r.URL.Query()
+		for _, p := range []struct {
+			name string
+			dst  *int
+		}{{"window_days", &opt.WindowDays}, {"cover_days", &opt.CoverDays}} {
+			v := q.Get(p.name)
+			if v == "" {
+				continue
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxReorderDays {
+				WriteError(w, 400, p.name+" must be between 1 and 365")
+				return
+			}
+			*p.dst = n
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+
+		out, err := ReorderSuggestions(ctx, rp, opt, time.Now())
+		if err != nil {
+			WriteError(w, 500, "db error")
+			return
+		}
+		WriteJSON(w, 200, out)
+	}
+}
@@ -3,17 +3,22 @@ package main
 import (
 	"carparts/models"
 	"context"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func OrdersHandler(rp *Repo) http.HandlerFunc {
+func OrdersHandler(rp Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			listOrders(w, r, rp)
+			return
+		}
 		if r.Method != http.MethodPost {
 			WriteError(w, 405, "method not allowed")
 			return
@@ -22,26 +27,35 @@ func OrdersHandler(rp *Repo) http.HandlerFunc {
 		var in struct {
 			CustomerID string `json:"customer_id"`
 			Items      []struct {
-				PartID   string `json:"part_id"`
-				Quantity int    `json:"quantity"`
+				PartID      string `json:"part_id"`
+				Quantity    int    `json:"quantity"`
+				WarehouseID string `json:"warehouse_id"` // optional, chosen automatically otherwise
 			} `json:"items"`
 		}
 		if err := ReadJSON(r, &in); err != nil {
 			WriteError(w, 400, "invalid json")
 			return
 		}
-		if strings.TrimSpace(in.CustomerID) == "" {
-			WriteError(w, 400, "customer_id is required")
-			return
-		}
 		if len(in.Items) == 0 {
 			WriteError(w, 400, "items are required")
 			return
 		}
-		cid, err := primitive.ObjectIDFromHex(in.CustomerID)
-		if err != nil {
-			WriteError(w, 400, "invalid customer_id")
-			return
+
+		// the order belongs to the authenticated caller; only staff may name
+		// another customer in customer_id
+		p, _ := PrincipalFrom(r.Context())
+		cid := p.CustomerID
+		if in.CustomerID != "" && in.CustomerID != cid.Hex() {
+			if !p.Role.IsStaff() {
+				WriteError(w, 403, "cannot order for another customer")
+				return
+			}
+			id, err := primitive.ObjectIDFromHex(in.CustomerID)
+			if err != nil {
+				WriteError(w, 400, "invalid customer_id")
+				return
+			}
+			cid = id
 		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), 12*time.Second)
@@ -54,74 +68,172 @@ func OrdersHandler(rp *Repo) http.HandlerFunc {
 				WriteError(w, 400, "invalid part_id")
 				return
 			}
-
-			updatedPart, err := rp.DecreaseStock(ctx, pid, it.Quantity)
-			if err != nil {
-				WriteError(w, 400, err.Error())
+			if it.Quantity <= 0 {
+				WriteError(w, 400, "quantity must be > 0")
 				return
 			}
-
-			orderItems = append(orderItems, models.OrderItem{
-				OrderID:  primitive.NilObjectID, // will set after insert
-				PartID:   updatedPart.ID,
-				Price:    updatedPart.Price,
+			item := models.OrderItem{
+				PartID:   pid,
 				Quantity: it.Quantity,
-			})
+			}
+			if it.WarehouseID != "" {
+				wid, err := primitive.ObjectIDFromHex(it.WarehouseID)
+				if err != nil {
+					WriteError(w, 400, "invalid warehouse_id")
+					return
+				}
+				item.WarehouseID = &wid
+			}
+			orderItems = append(orderItems, item)
 		}
 
-		o := models.Order{
-			CustomerID: cid,
-			Items:      orderItems,
-			IsPaid:     false,
-			Status:     "created",
-			CreatedAt:  time.Now(),
+		created, ok := placeOrder(ctx, w, rp, p, cid, orderItems)
+		if !ok {
+			return
 		}
-		o.TotalPrice = o.CalculateTotal()
+		WriteJSON(w, 201, created)
+	}
+}
+
+// placeOrder is shared by POST /orders and cart checkout: it checks that the
+// customer exists and places the order on their behalf, with p recorded as
+// the actor. It writes the error response itself and reports success.
+func placeOrder(ctx context.Context, w http.ResponseWriter, rp Store, p Principal, cid primitive.ObjectID, items []models.OrderItem) (models.Order, bool) {
+	if _, err := rp.GetCustomer(ctx, cid); err != nil {
+		if err == mongo.ErrNoDocuments {
+			WriteError(w, 400, "customer not found")
+			return models.Order{}, false
+		}
+		WriteError(w, 500, "db error")
+		return models.Order{}, false
+	}
+
+	now := time.Now()
+	o := models.Order{
+		CustomerID: cid,
+		Items:      items,
+		IsPaid:     false,
+		Status:     models.StatusCreated,
+		StatusHistory: []models.StatusChange{
+			{To: models.StatusCreated, At: now, Actor: p.CustomerID.Hex()},
+		},
+		CreatedAt: now,
+	}
+
+	// stock holds and the insert commit or roll back together
+	created, err := rp.PlaceOrder(ctx, o)
+	if err != nil {
+		if errors.Is(err, ErrNotEnoughStock) {
+			WriteError(w, 400, err.Error())
+			return models.Order{}, false
+		}
+		if errors.Is(err, ErrWarehouseInactive) {
+			WriteError(w, 409, err.Error())
+			return models.Order{}, false
+		}
+		WriteError(w, 500, "db error")
+		return models.Order{}, false
+	}
+	return created, true
+}
 
-		created, err := rp.CreateOrder(ctx, o)
+// GET /orders?status=&is_paid=&from=&to=&customer_id=&cursor=&limit=&sort=
+// Staff see every order; customers and buyers only ever see their own.
+func listOrders(w http.ResponseWriter, r *http.Request, rp OrderStore) {
+	q := r.URL.Query()
+	var f OrderFilter
+
+	if v := q.Get("customer_id"); v != "" {
+		id, err := primitive.ObjectIDFromHex(v)
 		if err != nil {
-			WriteError(w, 500, "db error")
+			WriteError(w, 400, "invalid customer_id")
 			return
 		}
-
-		// update embedded items with order_id (simple second update)
-		for i := range created.Items {
-			created.Items[i].OrderID = created.ID
+		f.CustomerID = &id
+	}
+	p, _ := PrincipalFrom(r.Context())
+	if !p.Role.IsStaff() {
+		if f.CustomerID != nil && *f.CustomerID != p.CustomerID {
+			WriteError(w, 403, "forbidden")
+			return
 		}
-		_ = rp.syncOrderItems(ctx, created)
+		f.CustomerID = &p.CustomerID
+	}
 
-		WriteJSON(w, 201, created)
+	f.Status = q.Get("status")
+	if v := q.Get("is_paid"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			WriteError(w, 400, "is_paid must be true or false")
+			return
+		}
+		f.IsPaid = &b
 	}
+	if v := q.Get("from"); v != "" {
+		t, err := parseTimeParam(v, false)
+		if err != nil {
+			WriteError(w, 400, "from must be RFC 3339 or YYYY-MM-DD")
+			return
+		}
+		f.From = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := parseTimeParam(v, true)
+		if err != nil {
+			WriteError(w, 400, "to must be RFC 3339 or YYYY-MM-DD")
+			return
+		}
+		f.To = t
+	}
+
+	writeOrdersPage(w, r, rp, f)
 }
 
-func (rp *Repo) syncOrderItems(ctx context.Context, o models.Order) error {
-	_, err := rp.orders.UpdateOne(ctx, bson.M{"_id": o.ID}, bson.M{"$set": bson.M{"items": o.Items}})
-	return err
+func writeOrdersPage(w http.ResponseWriter, r *http.Request, rp OrderStore, f OrderFilter) {
+	pr, err := ParsePageRequest(r.URL.Query())
+	if err != nil {
+		WriteError(w, 400, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	items, next, err := rp.ListOrders(ctx, f, pr)
+	if err != nil {
+		WriteError(w, 500, "db error")
+		return
+	}
+	WriteJSON(w, 200, Page[models.Order]{Items: items, NextCursor: next})
 }
 
-func OrderByIDHandler(rp *Repo) http.HandlerFunc {
+func OrderByIDHandler(rp OrderStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		path := strings.TrimPrefix(r.URL.Path, "/orders/")
-		idStr := strings.Split(path, "/")[0]
-		if idStr == "" {
+		segs := pathSegments(r.URL.Path, "/orders/")
+		if len(segs) == 0 {
 			WriteError(w, 400, "missing id")
 			return
 		}
-		id, err := primitive.ObjectIDFromHex(idStr)
+		if len(segs) > 2 || len(segs) == 2 && segs[1] != "status" {
+			WriteError(w, 404, "not found")
+			return
+		}
+		id, err := primitive.ObjectIDFromHex(segs[0])
 		if err != nil {
 			WriteError(w, 400, "invalid id")
 			return
 		}
 
 		// /orders/{id}/status
-		if strings.HasSuffix(r.URL.Path, "/status") {
+		if len(segs) == 2 {
 			if r.Method != http.MethodPatch {
 				WriteError(w, 405, "method not allowed")
 				return
 			}
+			// is_paid follows the status (paid sets it, refunded clears it);
+			// refunding an order that has not shipped puts its items back
 			var in struct {
 				Status string `json:"status"`
-				IsPaid bool   `json:"is_paid"`
 			}
 			if err := ReadJSON(r, &in); err != nil {
 				WriteError(w, 400, "invalid json")
@@ -131,50 +243,51 @@ func OrderByIDHandler(rp *Repo) http.HandlerFunc {
 				WriteError(w, 400, "status is required")
 				return
 			}
+			if !models.ValidOrderStatus(in.Status) {
+				WriteError(w, 400, "unknown status")
+				return
+			}
 
 			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
 			defer cancel()
 
-			out, err := rp.UpdateOrderStatus(ctx, id, in.Status, in.IsPaid)
+			p, _ := PrincipalFrom(r.Context())
+			out, err := rp.UpdateOrderStatus(ctx, id, in.Status, p.CustomerID.Hex())
 			if err != nil {
-				if err == mongo.ErrNoDocuments {
-					WriteError(w, 404, "not found")
-					return
-				}
-				WriteError(w, 500, "db error")
+				writeOrderUpdateError(w, err)
 				return
 			}
 			WriteJSON(w, 200, out)
 			return
 		}
 
-		switch r.Method {
-		case http.MethodGet:
-			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
-			defer cancel()
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
 
-			out, err := rp.GetOrder(ctx, id)
-			if err != nil {
-				if err == mongo.ErrNoDocuments {
-					WriteError(w, 404, "not found")
-					return
-				}
-				WriteError(w, 500, "db error")
+		// customers and buyers may only read and cancel their own orders
+		o, err := rp.GetOrder(ctx, id)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				WriteError(w, 404, "not found")
 				return
 			}
-			WriteJSON(w, 200, out)
+			WriteError(w, 500, "db error")
+			return
+		}
+		p, _ := PrincipalFrom(r.Context())
+		if !p.Role.IsStaff() && o.CustomerID != p.CustomerID {
+			WriteError(w, 403, "forbidden")
+			return
+		}
 
-		case http.MethodDelete:
-			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
-			defer cancel()
+		switch r.Method {
+		case http.MethodGet:
+			WriteJSON(w, 200, o)
 
-			out, err := rp.CancelOrder(ctx, id)
+		case http.MethodDelete:
+			out, err := rp.CancelOrder(ctx, id, p.CustomerID.Hex())
 			if err != nil {
-				if err == mongo.ErrNoDocuments {
-					WriteError(w, 404, "not found")
-					return
-				}
-				WriteError(w, 500, "db error")
+				writeOrderUpdateError(w, err)
 				return
 			}
 			WriteJSON(w, 200, out)
@@ -184,3 +297,14 @@ func OrderByIDHandler(rp *Repo) http.HandlerFunc {
 		}
 	}
 }
+
+func writeOrderUpdateError(w http.ResponseWriter, err error) {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		WriteError(w, 404, "not found")
+	case errors.Is(err, ErrInvalidTransition), errors.Is(err, ErrConflict):
+		WriteError(w, 409, err.Error())
+	default:
+		WriteError(w, 500, "db error")
+	}
+}
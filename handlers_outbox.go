@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DeadLettersHandler serves the outbox events that ran out of attempts:
+//
+//	GET  /outbox/dead-letters?limit=
+//	POST /outbox/dead-letters/{id}/retry
+func DeadLettersHandler(rp OutboxStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/outbox/dead-letters"), "/")
+
+		if path == "" {
+			if r.Method != http.MethodGet {
+				WriteError(w, 405, "method not allowed")
+				return
+			}
+			limit := int64(0)
+			if v := r.URL.Query().Get("limit"); v != "" {
+				n, err := strconv.Atoi(v)
+				if err == nil && n > 0 {
+					limit = int64(n)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			evs, err := rp.ListDeadLetters(ctx, limit)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, evs)
+			return
+		}
+
+		idStr, action, _ := strings.Cut(path, "/")
+		if action != "retry" {
+			WriteError(w, 404, "not found")
+			return
+		}
+		if r.Method != http.MethodPost {
+			WriteError(w, 405, "method not allowed")
+			return
+		}
+		id, err := primitive.ObjectIDFromHex(idStr)
+		if err != nil {
+			WriteError(w, 400, "invalid id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+
+		ev, err := rp.RequeueDeadLetter(ctx, id)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				WriteError(w, 404, "not found")
+				return
+			}
+			WriteError(w, 500, "db error")
+			return
+		}
+		WriteJSON(w, 200, ev)
+	}
+}
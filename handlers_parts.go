@@ -13,44 +13,64 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func PartsHandler(rp *Repo) http.HandlerFunc {
+// GET  /parts?q=&brand=&car_model=&compatibility=&category_id=&is_new=&in_stock=&min_price=&max_price=&facets=
+// POST /parts
+// With facets=true GET answers {"parts": [...], "facets": {...}}, the facets
+// counting the same parts by brand, category, car model, condition, price
+// bucket and stock.
+func PartsHandler(rp PartStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 
 		case http.MethodGet:
-			q := r.URL.Query()
-
-			var catID *primitive.ObjectID
-			if v := q.Get("category_id"); v != "" {
-				id, err := primitive.ObjectIDFromHex(v)
+			f, ok := partFilterFrom(w, r)
+			if !ok {
+				return
+			}
+			withFacets := false
+			if v := r.URL.Query().Get("facets"); v != "" {
+				b, err := strconv.ParseBool(v)
 				if err != nil {
-					WriteError(w, 400, "invalid category_id")
+					WriteError(w, 400, "facets must be true or false")
 					return
 				}
-				catID = &id
+				withFacets = b
 			}
 
 			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
 			defer cancel()
 
-			parts, err := rp.ListPartsFiltered(ctx, catID, q.Get("car_model"), q.Get("brand"), q.Get("q"), q.Get("compatibility"))
+			parts, err := rp.ListPartsFiltered(ctx, f)
 			if err != nil {
 				WriteError(w, 500, "db error")
 				return
 			}
-			WriteJSON(w, 200, parts)
+			if !withFacets {
+				WriteJSON(w, 200, parts)
+				return
+			}
+			facets, err := rp.PartFacets(ctx, f)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, map[string]interface{}{"parts": parts, "facets": facets})
 
 		case http.MethodPost:
 			var in struct {
-				CategoryID      string  `json:"category_id"`
-				Brand           string  `json:"brand"`
-				CarModel        string  `json:"car_model"`
-				Compatibility   string  `json:"compatibility"`
-				Price           float64 `json:"price"`
-				Stock           int     `json:"stock"`
-				Description     string  `json:"description"`
-				ManufactureDate string  `json:"manufacture_date"`
-				IsNew           bool    `json:"is_new"`
+				CategoryID      string   `json:"category_id"`
+				Brand           string   `json:"brand"`
+				CarModel        string   `json:"car_model"`
+				Compatibility   string   `json:"compatibility"`
+				PartNumber      string   `json:"part_number"`
+				OEMNumbers      []string `json:"oem_numbers"`
+				Price           float64  `json:"price"`
+				Stock           int      `json:"stock"`
+				Description     string   `json:"description"`
+				ManufactureDate string   `json:"manufacture_date"`
+				IsNew           bool     `json:"is_new"`
+				ReorderPoint    *int     `json:"reorder_point"`
+				SafetyStock     *int     `json:"safety_stock"`
 			}
 			if err := ReadJSON(r, &in); err != nil {
 				WriteError(w, 400, "invalid json")
@@ -73,6 +93,10 @@ func PartsHandler(rp *Repo) http.HandlerFunc {
 				WriteError(w, 400, "stock must be >= 0")
 				return
 			}
+			thresholds := models.StockThresholds{ReorderPoint: in.ReorderPoint, SafetyStock: in.SafetyStock}
+			if !validThresholds(w, thresholds) {
+				return
+			}
 
 			md := time.Time{}
 			if in.ManufactureDate != "" {
@@ -89,12 +113,15 @@ func PartsHandler(rp *Repo) http.HandlerFunc {
 				Brand:           in.Brand,
 				CarModel:        in.CarModel,
 				Compatibility:   in.Compatibility,
+				PartNumber:      strings.TrimSpace(in.PartNumber),
+				OEMNumbers:      models.CleanPartNumbers(in.OEMNumbers),
 				Price:           in.Price,
 				Stock:           in.Stock,
 				Description:     in.Description,
 				ManufactureDate: md,
 				IsNew:           in.IsNew,
 				IsActive:        true,
+				StockThresholds: thresholds,
 			}
 
 			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
@@ -113,19 +140,41 @@ func PartsHandler(rp *Repo) http.HandlerFunc {
 	}
 }
 
-func PartByIDHandler(rp *Repo) http.HandlerFunc {
+func PartByIDHandler(rp Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		path := strings.TrimPrefix(r.URL.Path, "/parts/")
-		if path == "" {
+		segs := pathSegments(r.URL.Path, "/parts/")
+		if len(segs) == 0 {
 			WriteError(w, 400, "missing id")
 			return
 		}
 
+		// /parts/lookup?number=
+		if len(segs) == 1 && segs[0] == "lookup" {
+			if r.Method != http.MethodGet {
+				WriteError(w, 405, "method not allowed")
+				return
+			}
+			number := r.URL.Query().Get("number")
+			if models.PartNumberKey(number) == "" {
+				WriteError(w, 400, "number is required")
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			out, err := InterchangeableParts(ctx, rp, number)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, out)
+			return
+		}
+
 		// /parts/{id}/availability
-		if strings.HasSuffix(path, "/availability") {
-			idStr := strings.TrimSuffix(path, "/availability")
-			idStr = strings.TrimSuffix(idStr, "/")
-			id, err := primitive.ObjectIDFromHex(idStr)
+		if len(segs) == 2 && segs[1] == "availability" {
+			id, err := primitive.ObjectIDFromHex(segs[0])
 			if err != nil {
 				WriteError(w, 400, "invalid id")
 				return
@@ -143,21 +192,75 @@ func PartByIDHandler(rp *Repo) http.HandlerFunc {
 				WriteError(w, 500, "db error")
 				return
 			}
+
+			levels, err := rp.PartInventory(ctx, id)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			warehouses, err := rp.ListWarehouses(ctx)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			byID := make(map[primitive.ObjectID]models.Warehouse, len(warehouses))
+			for _, wh := range warehouses {
+				byID[wh.ID] = wh
+			}
+
+			// on_hand is physically in stock, reserved is held for unpaid
+			// orders and available_to_promise is what can still be sold
+			type warehouseAvailability struct {
+				WarehouseID        primitive.ObjectID `json:"warehouse_id"`
+				Name               string             `json:"name"`
+				City               string             `json:"city"`
+				OnHand             int                `json:"on_hand"`
+				Reserved           int                `json:"reserved"`
+				AvailableToPromise int                `json:"available_to_promise"`
+				Available          bool               `json:"available"`
+			}
+			breakdown := make([]warehouseAvailability, 0, len(levels))
+			for _, l := range levels {
+				wh := byID[l.WarehouseID]
+				breakdown = append(breakdown, warehouseAvailability{
+					WarehouseID:        l.WarehouseID,
+					Name:               wh.Name,
+					City:               wh.City,
+					OnHand:             l.Quantity,
+					Reserved:           l.Reserved,
+					AvailableToPromise: l.Available(),
+					Available:          l.Available() > 0 && p.IsActive && wh.IsActive,
+				})
+			}
+
 			WriteJSON(w, 200, map[string]any{
-				"part_id":   p.ID,
-				"stock":     p.Stock,
-				"available": p.Stock > 0 && p.IsActive,
+				"part_id":              p.ID,
+				"on_hand":              p.Stock,
+				"reserved":             p.Reserved,
+				"available_to_promise": p.Available(),
+				"available":            p.CheckStock(),
+				"warehouses":           breakdown,
 			})
 			return
 		}
 
-		idStr := strings.Split(path, "/")[0]
-		id, err := primitive.ObjectIDFromHex(idStr)
+		fitment := len(segs) <= 3 && len(segs) > 1 && segs[1] == "fitment"
+		if len(segs) > 1 && !fitment {
+			WriteError(w, 404, "not found")
+			return
+		}
+		id, err := primitive.ObjectIDFromHex(segs[0])
 		if err != nil {
 			WriteError(w, 400, "invalid id")
 			return
 		}
 
+		// /parts/{id}/fitment[/{vehicle_id}]
+		if fitment {
+			partFitment(w, r, rp, id, segs[2:])
+			return
+		}
+
 		switch r.Method {
 		case http.MethodGet:
 			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
@@ -176,30 +279,46 @@ func PartByIDHandler(rp *Repo) http.HandlerFunc {
 
 		case http.MethodPut:
 			var in struct {
-				CategoryID    string  `json:"category_id"`
-				Brand         string  `json:"brand"`
-				CarModel      string  `json:"car_model"`
-				Compatibility string  `json:"compatibility"`
-				Price         float64 `json:"price"`
-				Stock         int     `json:"stock"`
-				Description   string  `json:"description"`
-				IsNew         bool    `json:"is_new"`
-				IsActive      bool    `json:"is_active"`
+				CategoryID    string   `json:"category_id"`
+				Brand         string   `json:"brand"`
+				CarModel      string   `json:"car_model"`
+				Compatibility string   `json:"compatibility"`
+				PartNumber    string   `json:"part_number"`
+				OEMNumbers    []string `json:"oem_numbers"`
+				Price         float64  `json:"price"`
+				Stock         int      `json:"stock"`
+				Description   string   `json:"description"`
+				IsNew         bool     `json:"is_new"`
+				IsActive      bool     `json:"is_active"`
+				ReorderPoint  *int     `json:"reorder_point"`
+				SafetyStock   *int     `json:"safety_stock"`
 			}
 			if err := ReadJSON(r, &in); err != nil {
 				WriteError(w, 400, "invalid json")
 				return
 			}
+			// omitted thresholds are cleared and inherit from the category
+			if !validThresholds(w, models.StockThresholds{ReorderPoint: in.ReorderPoint, SafetyStock: in.SafetyStock}) {
+				return
+			}
+
+			numbers := models.SparePart{PartNumber: strings.TrimSpace(in.PartNumber), OEMNumbers: models.CleanPartNumbers(in.OEMNumbers)}
+			numbers.SetNumberKeys()
 
 			upd := bson.M{
 				"brand":         in.Brand,
 				"car_model":     in.CarModel,
 				"compatibility": in.Compatibility,
+				"part_number":   numbers.PartNumber,
+				"oem_numbers":   numbers.OEMNumbers,
+				"number_keys":   numbers.NumberKeys,
 				"price":         in.Price,
 				"stock":         in.Stock,
 				"description":   in.Description,
 				"is_new":        in.IsNew,
 				"is_active":     in.IsActive,
+				"reorder_point": in.ReorderPoint,
+				"safety_stock":  in.SafetyStock,
 			}
 			if in.CategoryID != "" {
 				cid, err := primitive.ObjectIDFromHex(in.CategoryID)
@@ -213,6 +332,10 @@ func PartByIDHandler(rp *Repo) http.HandlerFunc {
 			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
 			defer cancel()
 
+			if !stockEditable(ctx, w, rp, id, upd) {
+				return
+			}
+
 			p, err := rp.UpdatePart(ctx, id, upd)
 			if err != nil {
 				WriteError(w, 500, "db error")
@@ -240,6 +363,27 @@ func PartByIDHandler(rp *Repo) http.HandlerFunc {
 			if v, ok := in["description"]; ok {
 				upd["description"] = toString(v)
 			}
+			if v, ok := in["part_number"]; ok {
+				upd["part_number"] = strings.TrimSpace(toString(v))
+			}
+			if v, ok := in["oem_numbers"]; ok {
+				// null clears them
+				list, isList := v.([]any)
+				if v != nil && !isList {
+					WriteError(w, 400, "oem_numbers must be an array of strings")
+					return
+				}
+				nums := make([]string, 0, len(list))
+				for _, n := range list {
+					str, ok := n.(string)
+					if !ok {
+						WriteError(w, 400, "oem_numbers must be an array of strings")
+						return
+					}
+					nums = append(nums, str)
+				}
+				upd["oem_numbers"] = models.CleanPartNumbers(nums)
+			}
 			if v, ok := in["is_new"]; ok {
 				if b, ok2 := v.(bool); ok2 {
 					upd["is_new"] = b
@@ -270,10 +414,34 @@ func PartByIDHandler(rp *Repo) http.HandlerFunc {
 				}
 				upd["category_id"] = cid
 			}
+			// thresholds take a number, or null to inherit from the category
+			var thresholds models.StockThresholds
+			for key, dst := range map[string]**int{"reorder_point": &thresholds.ReorderPoint, "safety_stock": &thresholds.SafetyStock} {
+				v, ok := in[key]
+				if !ok {
+					continue
+				}
+				if v != nil {
+					n, err := strconv.Atoi(toString(v))
+					if err != nil {
+						WriteError(w, 400, key+" must be an integer or null")
+						return
+					}
+					*dst = &n
+				}
+				upd[key] = *dst
+			}
+			if !validThresholds(w, thresholds) {
+				return
+			}
 
 			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
 			defer cancel()
 
+			if !stockEditable(ctx, w, rp, id, upd) || !numberKeysFor(ctx, w, rp, id, upd) {
+				return
+			}
+
 			p, err := rp.UpdatePart(ctx, id, upd)
 			if err != nil {
 				WriteError(w, 500, "db error")
@@ -289,7 +457,7 @@ func PartByIDHandler(rp *Repo) http.HandlerFunc {
 				WriteError(w, 500, "db error")
 				return
 			}
-			WriteJSON(w, 200, map[string]string{"deleted": idStr})
+			WriteJSON(w, 200, map[string]string{"deleted": segs[0]})
 
 		default:
 			WriteError(w, 405, "method not allowed")
@@ -297,6 +465,91 @@ func PartByIDHandler(rp *Repo) http.HandlerFunc {
 	}
 }
 
+// numberKeysFor adds number_keys to a PATCH that changes part_number or
+// oem_numbers, taking the one it leaves out from the stored part.
+// It writes the error response itself and reports whether to continue.
+func numberKeysFor(ctx context.Context, w http.ResponseWriter, rp Store, id primitive.ObjectID, upd bson.M) bool {
+	pn, hasPN := upd["part_number"].(string)
+	oem, hasOEM := upd["oem_numbers"].([]string)
+	if !hasPN && !hasOEM {
+		return true
+	}
+	p, err := rp.GetPart(ctx, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return true // UpdatePart reports the 404
+		}
+		WriteError(w, 500, "db error")
+		return false
+	}
+	if hasPN {
+		p.PartNumber = pn
+	}
+	if hasOEM {
+		p.OEMNumbers = oem
+	}
+	p.SetNumberKeys()
+	upd["number_keys"] = p.NumberKeys
+	return true
+}
+
+// stockEditable rejects a direct "stock" edit for parts stocked per
+// warehouse: their total must only move through /warehouses/{id}/stock.
+// A PUT that repeats the current total is fine and the key is dropped.
+// Stock may never drop below what is held for unpaid orders.
+// It writes the error response itself and reports whether to continue.
+func stockEditable(ctx context.Context, w http.ResponseWriter, rp Store, id primitive.ObjectID, upd bson.M) bool {
+	v, ok := upd["stock"]
+	if !ok {
+		return true
+	}
+	p, err := rp.GetPart(ctx, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return true // UpdatePart reports the 404
+		}
+		WriteError(w, 500, "db error")
+		return false
+	}
+	if p.Stock == v {
+		delete(upd, "stock")
+		return true
+	}
+	levels, err := rp.PartInventory(ctx, id)
+	if err != nil {
+		WriteError(w, 500, "db error")
+		return false
+	}
+	if len(levels) > 0 {
+		WriteError(w, 409, "stock is managed per warehouse, use /warehouses/{id}/stock")
+		return false
+	}
+	if n, _ := v.(int); n < p.Reserved {
+		WriteError(w, 409, ErrBelowReserved.Error())
+		return false
+	}
+	return true
+}
+
+// validThresholds checks the thresholds that are set; safety stock can only
+// be compared with a reorder point given alongside it.
+// It writes the error response itself and reports whether to continue.
+func validThresholds(w http.ResponseWriter, t models.StockThresholds) bool {
+	if t.ReorderPoint != nil && *t.ReorderPoint < 0 {
+		WriteError(w, 400, "reorder_point must be >= 0")
+		return false
+	}
+	if t.SafetyStock != nil && *t.SafetyStock < 0 {
+		WriteError(w, 400, "safety_stock must be >= 0")
+		return false
+	}
+	if t.ReorderPoint != nil && t.SafetyStock != nil && *t.SafetyStock > *t.ReorderPoint {
+		WriteError(w, 400, "safety_stock must be <= reorder_point")
+		return false
+	}
+	return true
+}
+
 func toString(v any) string {
 	switch t := v.(type) {
 	case string:
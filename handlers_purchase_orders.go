@@ -0,0 +1,546 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GET  /purchase-orders?status=&supplier_id=  lists orders, newest first.
+// POST /purchase-orders                       creates a draft.
+func PurchaseOrdersHandler(rp Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+
+		case http.MethodGet:
+			q := r.URL.Query()
+			status := q.Get("status")
+			if status != "" && !models.ValidPurchaseStatus(status) {
+				WriteError(w, 400, "unknown status")
+				return
+			}
+			var supplierID *primitive.ObjectID
+			if v := q.Get("supplier_id"); v != "" {
+				id, err := primitive.ObjectIDFromHex(v)
+				if err != nil {
+					WriteError(w, 400, "invalid supplier_id")
+					return
+				}
+				supplierID = &id
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			list, err := rp.ListPurchaseOrders(ctx, status, supplierID)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, list)
+
+		case http.MethodPost:
+			var in struct {
+				SupplierID  string `json:"supplier_id"`
+				WarehouseID string `json:"warehouse_id"`
+				Lines       []struct {
+					PartID    string   `json:"part_id"`
+					Quantity  int      `json:"quantity"`
+					UnitPrice *float64 `json:"unit_price"`
+				} `json:"lines"`
+				Note string `json:"note"`
+			}
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+			supplierID, err := primitive.ObjectIDFromHex(in.SupplierID)
+			if err != nil {
+				WriteError(w, 400, "invalid supplier_id")
+				return
+			}
+			if len(in.Lines) == 0 {
+				WriteError(w, 400, "lines are required")
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			sup, ok := purchaseSupplier(ctx, w, rp, supplierID)
+			if !ok {
+				return
+			}
+			warehouseID, ok := purchaseWarehouse(ctx, w, rp, in.WarehouseID)
+			if !ok {
+				return
+			}
+
+			lines := make([]models.PurchaseOrderLine, 0, len(in.Lines))
+			seen := map[primitive.ObjectID]bool{}
+			for _, l := range in.Lines {
+				pid, err := primitive.ObjectIDFromHex(l.PartID)
+				if err != nil {
+					WriteError(w, 400, "invalid part_id")
+					return
+				}
+				if l.Quantity <= 0 {
+					WriteError(w, 400, "quantity must be > 0")
+					return
+				}
+				if seen[pid] {
+					WriteError(w, 400, "duplicate part_id")
+					return
+				}
+				seen[pid] = true
+				if _, err := rp.GetPart(ctx, pid); err != nil {
+					if err == mongo.ErrNoDocuments {
+						WriteError(w, 400, "part not found")
+						return
+					}
+					WriteError(w, 500, "db error")
+					return
+				}
+				if l.Quantity < sup.OrderQuantity(pid, l.Quantity) {
+					WriteError(w, 400, "quantity is below the supplier's minimum order quantity")
+					return
+				}
+				line := models.PurchaseOrderLine{PartID: pid, Quantity: l.Quantity}
+				switch price, priced := sup.PriceFor(pid); {
+				case l.UnitPrice != nil && *l.UnitPrice <= 0:
+					WriteError(w, 400, "unit_price must be > 0")
+					return
+				case l.UnitPrice != nil:
+					line.UnitPrice = *l.UnitPrice
+				case priced:
+					line.UnitPrice = price.Price
+				default:
+					WriteError(w, 400, "supplier has no price for part, give unit_price")
+					return
+				}
+				lines = append(lines, line)
+			}
+
+			p, _ := PrincipalFrom(r.Context())
+			now := time.Now()
+			out, err := rp.CreatePurchaseOrder(ctx, models.PurchaseOrder{
+				SupplierID:  supplierID,
+				WarehouseID: warehouseID,
+				Lines:       lines,
+				Status:      models.PurchaseDraft,
+				Note:        strings.TrimSpace(in.Note),
+				CreatedBy:   p.CustomerID.Hex(),
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			})
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 201, out)
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+// skippedAlert is an alert generation left out, and why.
+type skippedAlert struct {
+	AlertID primitive.ObjectID `json:"alert_id"`
+	PartID  primitive.ObjectID `json:"part_id"`
+	Reason  string             `json:"reason"`
+}
+
+// PurchaseOrdersFromAlertsHandler drafts purchase orders for the open and
+// acknowledged low-stock alerts (or just alert_ids), one per supplier.
+//
+//	POST /purchase-orders/from-alerts {supplier_id?, warehouse_id?, alert_ids?}
+//
+// Each part goes to the cheapest active supplier that prices it, or only to
+// supplier_id if given. Alerts already on an open purchase order are skipped.
+func PurchaseOrdersFromAlertsHandler(rp Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, 405, "method not allowed")
+			return
+		}
+		var in struct {
+			SupplierID  string   `json:"supplier_id"`
+			WarehouseID string   `json:"warehouse_id"`
+			AlertIDs    []string `json:"alert_ids"`
+		}
+		if r.ContentLength != 0 {
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+
+		var suppliers []models.Supplier
+		if in.SupplierID != "" {
+			id, err := primitive.ObjectIDFromHex(in.SupplierID)
+			if err != nil {
+				WriteError(w, 400, "invalid supplier_id")
+				return
+			}
+			sup, ok := purchaseSupplier(ctx, w, rp, id)
+			if !ok {
+				return
+			}
+			suppliers = []models.Supplier{sup}
+		} else {
+			all, err := rp.ListSuppliers(ctx)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			for _, s := range all {
+				if s.IsActive {
+					suppliers = append(suppliers, s)
+				}
+			}
+		}
+		warehouseID, ok := purchaseWarehouse(ctx, w, rp, in.WarehouseID)
+		if !ok {
+			return
+		}
+
+		var alerts []models.LowStockAlert
+		if len(in.AlertIDs) > 0 {
+			for _, s := range in.AlertIDs {
+				id, err := primitive.ObjectIDFromHex(s)
+				if err != nil {
+					WriteError(w, 400, "invalid alert id")
+					return
+				}
+				a, err := rp.GetAlert(ctx, id)
+				if err != nil {
+					if err == mongo.ErrNoDocuments {
+						WriteError(w, 400, "alert not found")
+						return
+					}
+					WriteError(w, 500, "db error")
+					return
+				}
+				alerts = append(alerts, a)
+			}
+		} else {
+			for _, status := range []string{models.AlertOpen, models.AlertAcknowledged} {
+				list, err := rp.ListAlerts(ctx, status, 0)
+				if err != nil {
+					WriteError(w, 500, "db error")
+					return
+				}
+				alerts = append(alerts, list...)
+			}
+		}
+		pending, err := rp.PendingPurchaseAlertIDs(ctx)
+		if err != nil {
+			WriteError(w, 500, "db error")
+			return
+		}
+
+		drafts, skipped := planPurchaseOrders(alerts, suppliers, pending)
+		p, _ := PrincipalFrom(r.Context())
+		now := time.Now()
+		out := make([]models.PurchaseOrder, 0, len(drafts))
+		for _, po := range drafts {
+			po.WarehouseID = warehouseID
+			po.Status = models.PurchaseDraft
+			po.Note = "generated from low-stock alerts"
+			po.CreatedBy = p.CustomerID.Hex()
+			po.CreatedAt, po.UpdatedAt = now, now
+			po, err := rp.CreatePurchaseOrder(ctx, po)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			out = append(out, po)
+		}
+		WriteJSON(w, 201, map[string]any{"purchase_orders": out, "skipped": skipped})
+	}
+}
+
+// planPurchaseOrders groups the alerts into one order per supplier. A line
+// asks for enough to lift the part back above its reorder point, rounded up
+// to the supplier's minimum. An alert listed twice counts once, and a part
+// gets one line, for the larger of its alerts' shortfalls.
+func planPurchaseOrders(alerts []models.LowStockAlert, suppliers []models.Supplier, pending map[primitive.ObjectID]bool) ([]models.PurchaseOrder, []skippedAlert) {
+	bySupplier := map[primitive.ObjectID]*models.PurchaseOrder{}
+	var order []primitive.ObjectID
+	type lineRef struct {
+		po *models.PurchaseOrder
+		i  int
+	}
+	lines := map[primitive.ObjectID]lineRef{} // by part
+	seen := map[primitive.ObjectID]bool{}
+	skipped := make([]skippedAlert, 0)
+	for _, a := range alerts {
+		if seen[a.ID] {
+			continue
+		}
+		seen[a.ID] = true
+		switch {
+		case a.Status == models.AlertResolved:
+			skipped = append(skipped, skippedAlert{a.ID, a.PartID, "alert is resolved"})
+			continue
+		case pending[a.ID]:
+			skipped = append(skipped, skippedAlert{a.ID, a.PartID, "already on an open purchase order"})
+			continue
+		}
+		sup, price, ok := cheapestSupplier(suppliers, a.PartID)
+		if !ok {
+			skipped = append(skipped, skippedAlert{a.ID, a.PartID, "no supplier prices this part"})
+			continue
+		}
+		want := a.ReorderPoint - a.Stock + 1
+		if want < 1 {
+			want = 1
+		}
+		if ref, ok := lines[a.PartID]; ok {
+			l := &ref.po.Lines[ref.i]
+			if q := sup.OrderQuantity(a.PartID, want); q > l.Quantity {
+				l.Quantity = q
+			}
+			skipped = append(skipped, skippedAlert{a.ID, a.PartID, "part is already on this purchase order"})
+			continue
+		}
+		po := bySupplier[sup.ID]
+		if po == nil {
+			po = &models.PurchaseOrder{SupplierID: sup.ID}
+			bySupplier[sup.ID] = po
+			order = append(order, sup.ID)
+		}
+		alertID := a.ID
+		po.Lines = append(po.Lines, models.PurchaseOrderLine{
+			PartID:    a.PartID,
+			Quantity:  sup.OrderQuantity(a.PartID, want),
+			UnitPrice: price,
+			AlertID:   &alertID,
+		})
+		lines[a.PartID] = lineRef{po, len(po.Lines) - 1}
+	}
+
+	out := make([]models.PurchaseOrder, 0, len(order))
+	for _, id := range order {
+		out = append(out, *bySupplier[id])
+	}
+	return out, skipped
+}
+
+// cheapestSupplier picks the lowest price for the part, then the shortest
+// lead time.
+func cheapestSupplier(suppliers []models.Supplier, partID primitive.ObjectID) (models.Supplier, float64, bool) {
+	type offer struct {
+		s     models.Supplier
+		price float64
+	}
+	var offers []offer
+	for _, s := range suppliers {
+		if p, ok := s.PriceFor(partID); ok {
+			offers = append(offers, offer{s, p.Price})
+		}
+	}
+	if len(offers) == 0 {
+		return models.Supplier{}, 0, false
+	}
+	sort.SliceStable(offers, func(i, j int) bool {
+		if offers[i].price != offers[j].price {
+			return offers[i].price < offers[j].price
+		}
+		return offers[i].s.LeadTimeDays < offers[j].s.LeadTimeDays
+	})
+	return offers[0].s, offers[0].price, true
+}
+
+// GET    /purchase-orders/{id}
+// DELETE /purchase-orders/{id}          (drafts only)
+// POST   /purchase-orders/{id}/send
+// POST   /purchase-orders/{id}/receive  {warehouse_id?, lines: [{part_id, quantity}]}
+func PurchaseOrderByIDHandler(rp Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := pathSegments(r.URL.Path, "/purchase-orders/")
+		if len(parts) == 0 {
+			WriteError(w, 400, "missing id")
+			return
+		}
+		if len(parts) > 2 {
+			WriteError(w, 404, "not found")
+			return
+		}
+		idStr := parts[0]
+		id, err := primitive.ObjectIDFromHex(idStr)
+		if err != nil {
+			WriteError(w, 400, "invalid id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+
+		action := ""
+		if len(parts) > 1 {
+			action = parts[1]
+		}
+
+		switch {
+		case action == "" && r.Method == http.MethodGet:
+			po, err := rp.GetPurchaseOrder(ctx, id)
+			if err != nil {
+				writePurchaseError(w, err)
+				return
+			}
+			WriteJSON(w, 200, po)
+
+		case action == "" && r.Method == http.MethodDelete:
+			if err := rp.DeletePurchaseOrder(ctx, id); err != nil {
+				writePurchaseError(w, err)
+				return
+			}
+			WriteJSON(w, 200, map[string]string{"deleted": idStr})
+
+		case action == "send" && r.Method == http.MethodPost:
+			po, err := rp.SendPurchaseOrder(ctx, id)
+			if err != nil {
+				writePurchaseError(w, err)
+				return
+			}
+			WriteJSON(w, 200, po)
+
+		case action == "receive" && r.Method == http.MethodPost:
+			// without lines everything outstanding has arrived; warehouse_id
+			// says where, for an order that was not given one
+			var in struct {
+				WarehouseID string `json:"warehouse_id"`
+				Lines       []struct {
+					PartID   string `json:"part_id"`
+					Quantity int    `json:"quantity"`
+				} `json:"lines"`
+			}
+			if r.ContentLength != 0 {
+				if err := ReadJSON(r, &in); err != nil {
+					WriteError(w, 400, "invalid json")
+					return
+				}
+			}
+			po, err := rp.GetPurchaseOrder(ctx, id)
+			if err != nil {
+				writePurchaseError(w, err)
+				return
+			}
+			warehouseID, ok := purchaseWarehouse(ctx, w, rp, in.WarehouseID)
+			if !ok {
+				return
+			}
+			if warehouseID != nil && po.WarehouseID != nil && *warehouseID != *po.WarehouseID {
+				WriteError(w, 400, "purchase order is for another warehouse")
+				return
+			}
+			onOrder := map[primitive.ObjectID]bool{}
+			for _, l := range po.Lines {
+				onOrder[l.PartID] = true
+			}
+
+			received := map[primitive.ObjectID]int{}
+			if len(in.Lines) == 0 {
+				for _, l := range po.Lines {
+					received[l.PartID] = l.Outstanding()
+				}
+			}
+			for _, l := range in.Lines {
+				pid, err := primitive.ObjectIDFromHex(l.PartID)
+				if err != nil {
+					WriteError(w, 400, "invalid part_id")
+					return
+				}
+				if !onOrder[pid] {
+					WriteError(w, 400, "part is not on this purchase order")
+					return
+				}
+				if l.Quantity <= 0 {
+					WriteError(w, 400, "quantity must be > 0")
+					return
+				}
+				received[pid] += l.Quantity
+			}
+
+			p, _ := PrincipalFrom(r.Context())
+			po, err = rp.ReceivePurchaseOrder(ctx, id, warehouseID, received, p.CustomerID.Hex())
+			if err != nil {
+				writePurchaseError(w, err)
+				return
+			}
+			WriteJSON(w, 200, po)
+
+		case action != "" && action != "send" && action != "receive":
+			WriteError(w, 404, "not found")
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+// purchaseSupplier loads an active supplier. It writes the error response
+// itself and reports success.
+func purchaseSupplier(ctx context.Context, w http.ResponseWriter, rp SupplierStore, id primitive.ObjectID) (models.Supplier, bool) {
+	sup, err := rp.GetSupplier(ctx, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			WriteError(w, 400, "supplier not found")
+			return models.Supplier{}, false
+		}
+		WriteError(w, 500, "db error")
+		return models.Supplier{}, false
+	}
+	if !sup.IsActive {
+		WriteError(w, 400, "supplier is inactive")
+		return models.Supplier{}, false
+	}
+	return sup, true
+}
+
+// purchaseWarehouse resolves the optional warehouse goods are delivered to.
+// It writes the error response itself and reports success.
+func purchaseWarehouse(ctx context.Context, w http.ResponseWriter, rp WarehouseStore, idStr string) (*primitive.ObjectID, bool) {
+	if idStr == "" {
+		return nil, true
+	}
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		WriteError(w, 400, "invalid warehouse_id")
+		return nil, false
+	}
+	if _, err := rp.GetWarehouse(ctx, id); err != nil {
+		if err == mongo.ErrNoDocuments {
+			WriteError(w, 400, "warehouse not found")
+			return nil, false
+		}
+		WriteError(w, 500, "db error")
+		return nil, false
+	}
+	return &id, true
+}
+
+func writePurchaseError(w http.ResponseWriter, err error) {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		WriteError(w, 404, "not found")
+	case errors.Is(err, ErrPurchaseState), errors.Is(err, ErrOverReceipt), errors.Is(err, ErrReceiptWarehouse),
+		errors.Is(err, ErrUnallocatedHolds), errors.Is(err, ErrConflict):
+		WriteError(w, 409, err.Error())
+	default:
+		WriteError(w, 500, "db error")
+	}
+}
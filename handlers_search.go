@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSuggestions = 10
+	maxSuggestions     = 50
+)
+
+// GET /search/suggest?prefix=&limit=
+// Completions for the search box: brands, car models, categories and part
+// numbers with a word starting with prefix. It is served from memory, so it
+// can be called on every keystroke.
+func SuggestHandler(rp SuggestStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, 405, "method not allowed")
+			return
+		}
+
+		prefix := strings.TrimSpace(r.URL.Query().Get("prefix"))
+		if prefix == "" {
+			WriteError(w, 400, "prefix is required")
+			return
+		}
+		limit := defaultSuggestions
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				WriteError(w, 400, "invalid limit")
+				return
+			}
+			if n > maxSuggestions {
+				n = maxSuggestions
+			}
+			limit = n
+		}
+		WriteJSON(w, 200, rp.Suggest(prefix, limit))
+	}
+}
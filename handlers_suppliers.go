@@ -0,0 +1,264 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func SuppliersHandler(rp SupplierStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+
+		case http.MethodGet:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			list, err := rp.ListSuppliers(ctx)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, list)
+
+		case http.MethodPost:
+			var in struct {
+				Name         string `json:"name"`
+				Email        string `json:"email"`
+				Phone        string `json:"phone"`
+				LeadTimeDays int    `json:"lead_time_days"`
+				MinOrderQty  int    `json:"min_order_qty"`
+			}
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+			if strings.TrimSpace(in.Name) == "" {
+				WriteError(w, 400, "name is required")
+				return
+			}
+			if in.LeadTimeDays < 0 || in.MinOrderQty < 0 {
+				WriteError(w, 400, "lead_time_days and min_order_qty must be >= 0")
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			out, err := rp.CreateSupplier(ctx, models.Supplier{
+				Name:         strings.TrimSpace(in.Name),
+				Email:        strings.TrimSpace(in.Email),
+				Phone:        strings.TrimSpace(in.Phone),
+				LeadTimeDays: in.LeadTimeDays,
+				MinOrderQty:  in.MinOrderQty,
+				IsActive:     true,
+				CreatedAt:    time.Now(),
+			})
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 201, out)
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+// GET|PUT|DELETE /suppliers/{id}
+// PUT|DELETE     /suppliers/{id}/prices/{part_id}
+func SupplierByIDHandler(rp Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/suppliers/"), "/")
+		idStr := parts[0]
+		if idStr == "" {
+			WriteError(w, 400, "missing id")
+			return
+		}
+		id, err := primitive.ObjectIDFromHex(idStr)
+		if err != nil {
+			WriteError(w, 400, "invalid id")
+			return
+		}
+
+		if len(parts) > 1 {
+			if len(parts) != 3 || parts[1] != "prices" {
+				WriteError(w, 404, "not found")
+				return
+			}
+			supplierPrice(w, r, rp, id, parts[2])
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			s, err := rp.GetSupplier(ctx, id)
+			if err != nil {
+				writeSupplierError(w, err)
+				return
+			}
+			WriteJSON(w, 200, s)
+
+		case http.MethodPut:
+			var in struct {
+				Name         *string `json:"name"`
+				Email        *string `json:"email"`
+				Phone        *string `json:"phone"`
+				LeadTimeDays *int    `json:"lead_time_days"`
+				MinOrderQty  *int    `json:"min_order_qty"`
+				IsActive     *bool   `json:"is_active"`
+			}
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+			upd := bson.M{}
+			if in.Name != nil {
+				if strings.TrimSpace(*in.Name) == "" {
+					WriteError(w, 400, "name cannot be empty")
+					return
+				}
+				upd["name"] = strings.TrimSpace(*in.Name)
+			}
+			if in.Email != nil {
+				upd["email"] = strings.TrimSpace(*in.Email)
+			}
+			if in.Phone != nil {
+				upd["phone"] = strings.TrimSpace(*in.Phone)
+			}
+			if in.LeadTimeDays != nil {
+				if *in.LeadTimeDays < 0 {
+					WriteError(w, 400, "lead_time_days must be >= 0")
+					return
+				}
+				upd["lead_time_days"] = *in.LeadTimeDays
+			}
+			if in.MinOrderQty != nil {
+				if *in.MinOrderQty < 0 {
+					WriteError(w, 400, "min_order_qty must be >= 0")
+					return
+				}
+				upd["min_order_qty"] = *in.MinOrderQty
+			}
+			if in.IsActive != nil {
+				upd["is_active"] = *in.IsActive
+			}
+			if len(upd) == 0 {
+				WriteError(w, 400, "nothing to update")
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			s, err := rp.UpdateSupplier(ctx, id, upd)
+			if err != nil {
+				writeSupplierError(w, err)
+				return
+			}
+			WriteJSON(w, 200, s)
+
+		case http.MethodDelete:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			if err := rp.DeleteSupplier(ctx, id); err != nil {
+				writeSupplierError(w, err)
+				return
+			}
+			WriteJSON(w, 200, map[string]string{"deleted": idStr})
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+// supplierPrice sets (PUT {price, min_order_qty}) or removes (DELETE) what
+// the supplier charges for one part.
+func supplierPrice(w http.ResponseWriter, r *http.Request, rp Store, id primitive.ObjectID, partIDStr string) {
+	partID, err := primitive.ObjectIDFromHex(partIDStr)
+	if err != nil {
+		WriteError(w, 400, "invalid part_id")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var in struct {
+			Price       float64 `json:"price"`
+			MinOrderQty int     `json:"min_order_qty"`
+		}
+		if err := ReadJSON(r, &in); err != nil {
+			WriteError(w, 400, "invalid json")
+			return
+		}
+		if in.Price <= 0 {
+			WriteError(w, 400, "price must be > 0")
+			return
+		}
+		if in.MinOrderQty < 0 {
+			WriteError(w, 400, "min_order_qty must be >= 0")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+
+		if _, err := rp.GetPart(ctx, partID); err != nil {
+			if err == mongo.ErrNoDocuments {
+				WriteError(w, 400, "part not found")
+				return
+			}
+			WriteError(w, 500, "db error")
+			return
+		}
+		s, err := rp.SetSupplierPrice(ctx, id, models.SupplierPrice{
+			PartID:      partID,
+			Price:       in.Price,
+			MinOrderQty: in.MinOrderQty,
+			UpdatedAt:   time.Now(),
+		})
+		if err != nil {
+			writeSupplierError(w, err)
+			return
+		}
+		WriteJSON(w, 200, s)
+
+	case http.MethodDelete:
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+
+		s, err := rp.RemoveSupplierPrice(ctx, id, partID)
+		if err != nil {
+			writeSupplierError(w, err)
+			return
+		}
+		WriteJSON(w, 200, s)
+
+	default:
+		WriteError(w, 405, "method not allowed")
+	}
+}
+
+func writeSupplierError(w http.ResponseWriter, err error) {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		WriteError(w, 404, "not found")
+	case errors.Is(err, ErrSupplierInUse), errors.Is(err, ErrConflict):
+		WriteError(w, 409, err.Error())
+	default:
+		WriteError(w, 500, "db error")
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GET  /transfers?status=  lists transfers, newest first.
+// POST /transfers          creates a draft.
+func TransfersHandler(rp Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+
+		case http.MethodGet:
+			status := r.URL.Query().Get("status")
+			if status != "" && status != models.TransferDraft &&
+				status != models.TransferInTransit && status != models.TransferReceived {
+				WriteError(w, 400, "unknown status")
+				return
+			}
+			listTransfers(w, rp, status)
+
+		case http.MethodPost:
+			var in struct {
+				FromWarehouseID string `json:"from_warehouse_id"`
+				ToWarehouseID   string `json:"to_warehouse_id"`
+				Lines           []struct {
+					PartID   string `json:"part_id"`
+					Quantity int    `json:"quantity"`
+				} `json:"lines"`
+				Note string `json:"note"`
+			}
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+			from, err := primitive.ObjectIDFromHex(in.FromWarehouseID)
+			if err != nil {
+				WriteError(w, 400, "invalid from_warehouse_id")
+				return
+			}
+			to, err := primitive.ObjectIDFromHex(in.ToWarehouseID)
+			if err != nil {
+				WriteError(w, 400, "invalid to_warehouse_id")
+				return
+			}
+			if from == to {
+				WriteError(w, 400, "source and destination must differ")
+				return
+			}
+			if len(in.Lines) == 0 {
+				WriteError(w, 400, "lines are required")
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			for _, wid := range []primitive.ObjectID{from, to} {
+				if _, err := rp.GetWarehouse(ctx, wid); err != nil {
+					if err == mongo.ErrNoDocuments {
+						WriteError(w, 400, "warehouse not found")
+						return
+					}
+					WriteError(w, 500, "db error")
+					return
+				}
+			}
+
+			lines := make([]models.TransferLine, 0, len(in.Lines))
+			seen := map[primitive.ObjectID]bool{}
+			for _, l := range in.Lines {
+				pid, err := primitive.ObjectIDFromHex(l.PartID)
+				if err != nil {
+					WriteError(w, 400, "invalid part_id")
+					return
+				}
+				if l.Quantity <= 0 {
+					WriteError(w, 400, "quantity must be > 0")
+					return
+				}
+				if seen[pid] {
+					WriteError(w, 400, "duplicate part_id")
+					return
+				}
+				seen[pid] = true
+				if _, err := rp.GetPart(ctx, pid); err != nil {
+					if err == mongo.ErrNoDocuments {
+						WriteError(w, 400, "part not found")
+						return
+					}
+					WriteError(w, 500, "db error")
+					return
+				}
+				lines = append(lines, models.TransferLine{PartID: pid, Quantity: l.Quantity})
+			}
+
+			p, _ := PrincipalFrom(r.Context())
+			out, err := rp.CreateTransfer(ctx, models.StockTransfer{
+				FromWarehouseID: from,
+				ToWarehouseID:   to,
+				Lines:           lines,
+				Status:          models.TransferDraft,
+				Note:            strings.TrimSpace(in.Note),
+				CreatedBy:       p.CustomerID.Hex(),
+				CreatedAt:       time.Now(),
+			})
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 201, out)
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+func listTransfers(w http.ResponseWriter, rp TransferStore, status string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	list, err := rp.ListTransfers(ctx, status)
+	if err != nil {
+		WriteError(w, 500, "db error")
+		return
+	}
+	WriteJSON(w, 200, list)
+}
+
+// GET  /transfers/in-transit
+// GET  /transfers/{id}
+// POST /transfers/{id}/dispatch
+// POST /transfers/{id}/receive {lines: [{part_id, received_quantity}]}
+func TransferByIDHandler(rp TransferStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := pathSegments(r.URL.Path, "/transfers/")
+		if len(parts) == 0 {
+			WriteError(w, 400, "missing id")
+			return
+		}
+		if len(parts) > 2 {
+			WriteError(w, 404, "not found")
+			return
+		}
+		idStr := parts[0]
+
+		if len(parts) == 1 && idStr == "in-transit" {
+			if r.Method != http.MethodGet {
+				WriteError(w, 405, "method not allowed")
+				return
+			}
+			listTransfers(w, rp, models.TransferInTransit)
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(idStr)
+		if err != nil {
+			WriteError(w, 400, "invalid id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+
+		action := ""
+		if len(parts) > 1 {
+			action = parts[1]
+		}
+
+		switch {
+		case action == "" && r.Method == http.MethodGet:
+			t, err := rp.GetTransfer(ctx, id)
+			if err != nil {
+				writeTransferError(w, err)
+				return
+			}
+			WriteJSON(w, 200, t)
+
+		case action == "dispatch" && r.Method == http.MethodPost:
+			t, err := rp.DispatchTransfer(ctx, id)
+			if err != nil {
+				writeTransferError(w, err)
+				return
+			}
+			WriteJSON(w, 200, t)
+
+		case action == "receive" && r.Method == http.MethodPost:
+			var in struct {
+				Lines []struct {
+					PartID           string `json:"part_id"`
+					ReceivedQuantity int    `json:"received_quantity"`
+				} `json:"lines"`
+			}
+			if r.ContentLength != 0 {
+				if err := ReadJSON(r, &in); err != nil {
+					WriteError(w, 400, "invalid json")
+					return
+				}
+			}
+			t, err := rp.GetTransfer(ctx, id)
+			if err != nil {
+				writeTransferError(w, err)
+				return
+			}
+			onTransfer := map[primitive.ObjectID]bool{}
+			for _, l := range t.Lines {
+				onTransfer[l.PartID] = true
+			}
+
+			received := map[primitive.ObjectID]int{}
+			for _, l := range in.Lines {
+				pid, err := primitive.ObjectIDFromHex(l.PartID)
+				if err != nil {
+					WriteError(w, 400, "invalid part_id")
+					return
+				}
+				if !onTransfer[pid] {
+					WriteError(w, 400, "part is not on this transfer")
+					return
+				}
+				if l.ReceivedQuantity < 0 {
+					WriteError(w, 400, "received_quantity must be >= 0")
+					return
+				}
+				received[pid] = l.ReceivedQuantity
+			}
+
+			t, err = rp.ReceiveTransfer(ctx, id, received)
+			if err != nil {
+				writeTransferError(w, err)
+				return
+			}
+			WriteJSON(w, 200, t)
+
+		case action != "" && action != "dispatch" && action != "receive":
+			WriteError(w, 404, "not found")
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+func writeTransferError(w http.ResponseWriter, err error) {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		WriteError(w, 404, "not found")
+	case errors.Is(err, ErrTransferState), errors.Is(err, ErrNotEnoughStock):
+		WriteError(w, 409, err.Error())
+	default:
+		WriteError(w, 500, "db error")
+	}
+}
@@ -1,40 +1,526 @@
 package main
 
 import (
+	"carparts/models"
 	"context"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// GET /vehicle/search?car_model=&brand=&compatibility=&category_id=&q=
-func VehicleSearchHandler(rp *Repo) http.HandlerFunc {
+const (
+	minVehicleYear = 1900
+	maxVehicleYear = 2100
+)
+
+// GET /vehicle/search?make=&model=&year=&engine_code=&body_type=
+// and the /parts filters (car_model, brand, compatibility, category_id, q).
+// Any of the vehicle parameters limits the result to parts with a fitment
+// on a matching catalog vehicle; the free-text ones still apply on top.
+func VehicleSearchHandler(rp Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, 405, "method not allowed")
+			return
+		}
+
+		f, ok := partFilterFrom(w, r)
+		if !ok {
+			return
+		}
+		vf, ok := vehicleFilterFrom(w, r)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+
+		parts, err := fittingParts(ctx, rp, f, vf)
+		if err != nil {
+			WriteError(w, 500, "db error")
+			return
+		}
+		WriteJSON(w, 200, parts)
+	}
+}
+
+// GET /vehicle/vin/{vin} takes the same filters as /vehicle/search. Make
+// and model year come from the VIN, as does the model when the VIN table
+// knows it; otherwise model= narrows the search.
+func VINSearchHandler(rp Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			WriteError(w, 405, "method not allowed")
 			return
 		}
 
-		q := r.URL.Query()
-		var catID *primitive.ObjectID
-		if v := q.Get("category_id"); v != "" {
-			id, err := primitive.ObjectIDFromHex(v)
+		info, err := DecodeVIN(strings.TrimPrefix(r.URL.Path, "/vehicle/vin/"), time.Now())
+		if err != nil {
+			WriteError(w, 400, err.Error())
+			return
+		}
+		if info.Make == "" {
+			WriteError(w, 404, "unknown manufacturer "+info.WMI)
+			return
+		}
+		f, ok := partFilterFrom(w, r)
+		if !ok {
+			return
+		}
+		vf, ok := vehicleFilterFrom(w, r)
+		if !ok {
+			return
+		}
+		vf.Make, vf.Year = info.Make, info.ModelYear
+		if info.Model != "" {
+			vf.Model = info.Model
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+
+		vehicles, err := rp.ListVehicles(ctx, vf)
+		if err != nil {
+			WriteError(w, 500, "db error")
+			return
+		}
+		parts, err := fittingParts(ctx, rp, f, vf)
+		if err != nil {
+			WriteError(w, 500, "db error")
+			return
+		}
+		WriteJSON(w, 200, map[string]any{
+			"vin":      info,
+			"vehicles": vehicles,
+			"parts":    parts,
+		})
+	}
+}
+
+// fittingParts lists the parts f selects, keeping only those fitted to a
+// vehicle vf matches unless vf is empty.
+func fittingParts(ctx context.Context, rp Store, f PartFilter, vf VehicleFilter) ([]models.SparePart, error) {
+	if !vf.IsZero() {
+		ids, err := rp.FittingPartIDs(ctx, vf)
+		if err != nil {
+			return nil, err
+		}
+		f.IDs = ids
+	}
+	return rp.ListPartsFiltered(ctx, f)
+}
+
+// partFilterFrom reads the /parts filters from the query. It writes the
+// error response itself and reports success.
+func partFilterFrom(w http.ResponseWriter, r *http.Request) (PartFilter, bool) {
+	q := r.URL.Query()
+	f := PartFilter{
+		CarModel:      q.Get("car_model"),
+		Brand:         q.Get("brand"),
+		Q:             q.Get("q"),
+		Compatibility: q.Get("compatibility"),
+	}
+	if v := q.Get("category_id"); v != "" {
+		id, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			WriteError(w, 400, "invalid category_id")
+			return PartFilter{}, false
+		}
+		f.CategoryID = &id
+	}
+	for _, b := range []struct {
+		name string
+		dst  **bool
+	}{{"is_new", &f.IsNew}, {"in_stock", &f.InStock}} {
+		if v := q.Get(b.name); v != "" {
+			x, err := strconv.ParseBool(v)
+			if err != nil {
+				WriteError(w, 400, b.name+" must be true or false")
+				return PartFilter{}, false
+			}
+			*b.dst = &x
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  **float64
+	}{{"min_price", &f.MinPrice}, {"max_price", &f.MaxPrice}} {
+		if v := q.Get(p.name); v != "" {
+			x, err := strconv.ParseFloat(v, 64)
+			if err != nil || x < 0 || math.IsNaN(x) || math.IsInf(x, 0) {
+				WriteError(w, 400, "invalid "+p.name)
+				return PartFilter{}, false
+			}
+			*p.dst = &x
+		}
+	}
+	return f, true
+}
+
+// GET  /vehicles?make=&model=&year=&engine_code=&body_type=
+// POST /vehicles
+func VehiclesHandler(rp VehicleStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+
+		case http.MethodGet:
+			f, ok := vehicleFilterFrom(w, r)
+			if !ok {
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			list, err := rp.ListVehicles(ctx, f)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, list)
+
+		case http.MethodPost:
+			var in struct {
+				Make       string `json:"make"`
+				Model      string `json:"model"`
+				Generation string `json:"generation"`
+				YearFrom   int    `json:"year_from"`
+				YearTo     int    `json:"year_to"`
+				EngineCode string `json:"engine_code"`
+				BodyType   string `json:"body_type"`
+			}
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+			v := models.Vehicle{
+				Make:       in.Make,
+				Model:      in.Model,
+				Generation: in.Generation,
+				YearFrom:   in.YearFrom,
+				YearTo:     in.YearTo,
+				EngineCode: in.EngineCode,
+				BodyType:   in.BodyType,
+				CreatedAt:  time.Now(),
+			}
+			if !validVehicle(w, &v) {
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			out, err := rp.CreateVehicle(ctx, v)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 201, out)
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+// GET            /vehicles/makes
+// GET            /vehicles/models?make=
+// GET|PUT|DELETE /vehicles/{id}
+func VehicleByIDHandler(rp VehicleStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		segs := pathSegments(r.URL.Path, "/vehicles/")
+		if len(segs) == 0 {
+			WriteError(w, 400, "missing id")
+			return
+		}
+		if len(segs) > 1 {
+			WriteError(w, 404, "not found")
+			return
+		}
+		idStr := segs[0]
+
+		if idStr == "makes" || idStr == "models" {
+			if r.Method != http.MethodGet {
+				WriteError(w, 405, "method not allowed")
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			var names []string
+			var err error
+			if idStr == "makes" {
+				names, err = rp.ListVehicleMakes(ctx)
+			} else {
+				vehicleMake := r.URL.Query().Get("make")
+				if strings.TrimSpace(vehicleMake) == "" {
+					WriteError(w, 400, "make is required")
+					return
+				}
+				names, err = rp.ListVehicleModels(ctx, vehicleMake)
+			}
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, names)
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(idStr)
+		if err != nil {
+			WriteError(w, 400, "invalid id")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			v, err := rp.GetVehicle(ctx, id)
 			if err != nil {
-				WriteError(w, 400, "invalid category_id")
+				writeVehicleError(w, err)
 				return
 			}
-			catID = &id
+			WriteJSON(w, 200, v)
+
+		case http.MethodPut:
+			var in struct {
+				Make       *string `json:"make"`
+				Model      *string `json:"model"`
+				Generation *string `json:"generation"`
+				YearFrom   *int    `json:"year_from"`
+				YearTo     *int    `json:"year_to"`
+				EngineCode *string `json:"engine_code"`
+				BodyType   *string `json:"body_type"`
+			}
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			v, err := rp.GetVehicle(ctx, id)
+			if err != nil {
+				writeVehicleError(w, err)
+				return
+			}
+			if in.Make != nil {
+				v.Make = *in.Make
+			}
+			if in.Model != nil {
+				v.Model = *in.Model
+			}
+			if in.Generation != nil {
+				v.Generation = *in.Generation
+			}
+			if in.YearFrom != nil {
+				v.YearFrom = *in.YearFrom
+			}
+			if in.YearTo != nil {
+				v.YearTo = *in.YearTo
+			}
+			if in.EngineCode != nil {
+				v.EngineCode = *in.EngineCode
+			}
+			if in.BodyType != nil {
+				v.BodyType = *in.BodyType
+			}
+			if !validVehicle(w, &v) {
+				return
+			}
+
+			out, err := rp.ReplaceVehicle(ctx, v)
+			if err != nil {
+				writeVehicleError(w, err)
+				return
+			}
+			WriteJSON(w, 200, out)
+
+		case http.MethodDelete:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			if err := rp.DeleteVehicle(ctx, id); err != nil {
+				writeVehicleError(w, err)
+				return
+			}
+			WriteJSON(w, 200, map[string]string{"deleted": idStr})
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+// partFitment serves the vehicles a part fits. rest is what follows
+// /parts/{id}/fitment in the path:
+//
+//	GET        /parts/{id}/fitment
+//	PUT|DELETE /parts/{id}/fitment/{vehicle_id} (PUT {note})
+func partFitment(w http.ResponseWriter, r *http.Request, rp Store, partID primitive.ObjectID, rest []string) {
+	if len(rest) == 0 || rest[0] == "" {
+		if r.Method != http.MethodGet {
+			WriteError(w, 405, "method not allowed")
+			return
 		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
 		defer cancel()
 
-		parts, err := rp.ListPartsFiltered(ctx, catID, q.Get("car_model"), q.Get("brand"), q.Get("q"), q.Get("compatibility"))
+		if _, err := rp.GetPart(ctx, partID); err != nil {
+			writeVehicleError(w, err)
+			return
+		}
+		fitments, err := rp.PartFitments(ctx, partID)
 		if err != nil {
 			WriteError(w, 500, "db error")
 			return
 		}
-		WriteJSON(w, 200, parts)
+		ids := make([]primitive.ObjectID, 0, len(fitments))
+		for _, f := range fitments {
+			ids = append(ids, f.VehicleID)
+		}
+		vehicles, err := rp.ListVehicles(ctx, VehicleFilter{IDs: ids})
+		if err != nil {
+			WriteError(w, 500, "db error")
+			return
+		}
+		notes := make(map[primitive.ObjectID]string, len(fitments))
+		for _, f := range fitments {
+			notes[f.VehicleID] = f.Note
+		}
+
+		type fittedVehicle struct {
+			models.Vehicle
+			Note string `json:"note,omitempty"`
+		}
+		out := make([]fittedVehicle, 0, len(vehicles))
+		for _, v := range vehicles {
+			out = append(out, fittedVehicle{Vehicle: v, Note: notes[v.ID]})
+		}
+		WriteJSON(w, 200, out)
+		return
+	}
+
+	vehicleID, err := primitive.ObjectIDFromHex(rest[0])
+	if err != nil {
+		WriteError(w, 400, "invalid vehicle_id")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var in struct {
+			Note string `json:"note"`
+		}
+		// the body is optional
+		if r.ContentLength != 0 {
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+
+		if _, err := rp.GetPart(ctx, partID); err != nil {
+			writeVehicleError(w, err)
+			return
+		}
+		if _, err := rp.GetVehicle(ctx, vehicleID); err != nil {
+			if err == mongo.ErrNoDocuments {
+				WriteError(w, 400, "vehicle not found")
+				return
+			}
+			WriteError(w, 500, "db error")
+			return
+		}
+		f, err := rp.AddFitment(ctx, models.Fitment{
+			PartID:    partID,
+			VehicleID: vehicleID,
+			Note:      strings.TrimSpace(in.Note),
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			WriteError(w, 500, "db error")
+			return
+		}
+		WriteJSON(w, 200, f)
+
+	case http.MethodDelete:
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+
+		if err := rp.RemoveFitment(ctx, partID, vehicleID); err != nil {
+			writeVehicleError(w, err)
+			return
+		}
+		WriteJSON(w, 200, map[string]string{"deleted": rest[0]})
+
+	default:
+		WriteError(w, 405, "method not allowed")
+	}
+}
+
+// vehicleFilterFrom reads make, model, year, engine_code and body_type from
+// the query. It writes the error response itself and reports success.
+func vehicleFilterFrom(w http.ResponseWriter, r *http.Request) (VehicleFilter, bool) {
+	q := r.URL.Query()
+	f := VehicleFilter{
+		Make:       strings.TrimSpace(q.Get("make")),
+		Model:      strings.TrimSpace(q.Get("model")),
+		EngineCode: strings.TrimSpace(q.Get("engine_code")),
+		BodyType:   strings.ToLower(strings.TrimSpace(q.Get("body_type"))),
+	}
+	if v := q.Get("year"); v != "" {
+		y, err := strconv.Atoi(v)
+		if err != nil || y < minVehicleYear || y > maxVehicleYear {
+			WriteError(w, 400, "invalid year")
+			return VehicleFilter{}, false
+		}
+		f.Year = y
+	}
+	if f.BodyType != "" && !models.ValidBodyType(f.BodyType) {
+		WriteError(w, 400, "invalid body_type")
+		return VehicleFilter{}, false
+	}
+	return f, true
+}
+
+// validVehicle normalizes v and checks it can go into the catalog. It
+// writes the error response itself and reports success.
+func validVehicle(w http.ResponseWriter, v *models.Vehicle) bool {
+	v.Normalize()
+	switch {
+	case v.Make == "" || v.Model == "":
+		WriteError(w, 400, "make and model are required")
+	case v.YearFrom < minVehicleYear || v.YearFrom > maxVehicleYear:
+		WriteError(w, 400, "year_from must be between 1900 and 2100")
+	case v.YearTo != 0 && (v.YearTo < v.YearFrom || v.YearTo > maxVehicleYear):
+		WriteError(w, 400, "year_to must be 0 or between year_from and 2100")
+	case v.BodyType != "" && !models.ValidBodyType(v.BodyType):
+		WriteError(w, 400, "invalid body_type")
+	default:
+		return true
+	}
+	return false
+}
+
+func writeVehicleError(w http.ResponseWriter, err error) {
+	if err == mongo.ErrNoDocuments {
+		WriteError(w, 404, "not found")
+		return
 	}
+	WriteError(w, 500, "db error")
 }
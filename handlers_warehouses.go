@@ -0,0 +1,228 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func WarehousesHandler(rp WarehouseStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+
+		case http.MethodGet:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			list, err := rp.ListWarehouses(ctx)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, list)
+
+		case http.MethodPost:
+			var in struct {
+				Name    string `json:"name"`
+				City    string `json:"city"`
+				Address string `json:"address"`
+			}
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+			if strings.TrimSpace(in.Name) == "" || strings.TrimSpace(in.City) == "" {
+				WriteError(w, 400, "name and city are required")
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			out, err := rp.CreateWarehouse(ctx, models.Warehouse{
+				Name:      strings.TrimSpace(in.Name),
+				City:      strings.TrimSpace(in.City),
+				Address:   strings.TrimSpace(in.Address),
+				IsActive:  true,
+				CreatedAt: time.Now(),
+			})
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 201, out)
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+func WarehouseByIDHandler(rp Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		segs := pathSegments(r.URL.Path, "/warehouses/")
+		if len(segs) == 0 {
+			WriteError(w, 400, "missing id")
+			return
+		}
+		if len(segs) > 2 || len(segs) == 2 && segs[1] != "stock" {
+			WriteError(w, 404, "not found")
+			return
+		}
+		idStr := segs[0]
+		id, err := primitive.ObjectIDFromHex(idStr)
+		if err != nil {
+			WriteError(w, 400, "invalid id")
+			return
+		}
+
+		// /warehouses/{id}/stock
+		if len(segs) == 2 {
+			warehouseStock(w, r, rp, id)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			wh, err := rp.GetWarehouse(ctx, id)
+			if err != nil {
+				if err == mongo.ErrNoDocuments {
+					WriteError(w, 404, "not found")
+					return
+				}
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, wh)
+
+		case http.MethodPut:
+			var in struct {
+				Name     *string `json:"name"`
+				City     *string `json:"city"`
+				Address  *string `json:"address"`
+				IsActive *bool   `json:"is_active"`
+			}
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+			upd := bson.M{}
+			if in.Name != nil {
+				upd["name"] = strings.TrimSpace(*in.Name)
+			}
+			if in.City != nil {
+				upd["city"] = strings.TrimSpace(*in.City)
+			}
+			if in.Address != nil {
+				upd["address"] = strings.TrimSpace(*in.Address)
+			}
+			if in.IsActive != nil {
+				upd["is_active"] = *in.IsActive
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			wh, err := rp.UpdateWarehouse(ctx, id, upd)
+			if err != nil {
+				if err == mongo.ErrNoDocuments {
+					WriteError(w, 404, "not found")
+					return
+				}
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, wh)
+
+		case http.MethodDelete:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			if err := rp.DeleteWarehouse(ctx, id); err != nil {
+				if errors.Is(err, ErrWarehouseNotEmpty) {
+					WriteError(w, 409, err.Error())
+					return
+				}
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, map[string]string{"deleted": idStr})
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+// GET /warehouses/{id}/stock lists the levels held there.
+// PUT /warehouses/{id}/stock {part_id, quantity} sets one level.
+func warehouseStock(w http.ResponseWriter, r *http.Request, rp Store, id primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	if _, err := rp.GetWarehouse(ctx, id); err != nil {
+		if err == mongo.ErrNoDocuments {
+			WriteError(w, 404, "not found")
+			return
+		}
+		WriteError(w, 500, "db error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		levels, err := rp.ListInventory(ctx, id)
+		if err != nil {
+			WriteError(w, 500, "db error")
+			return
+		}
+		WriteJSON(w, 200, levels)
+
+	case http.MethodPut:
+		var in struct {
+			PartID   string `json:"part_id"`
+			Quantity int    `json:"quantity"`
+		}
+		if err := ReadJSON(r, &in); err != nil {
+			WriteError(w, 400, "invalid json")
+			return
+		}
+		pid, err := primitive.ObjectIDFromHex(in.PartID)
+		if err != nil {
+			WriteError(w, 400, "invalid part_id")
+			return
+		}
+		if in.Quantity < 0 {
+			WriteError(w, 400, "quantity must be >= 0")
+			return
+		}
+
+		l, err := rp.SetStock(ctx, id, pid, in.Quantity)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				WriteError(w, 404, "part not found")
+				return
+			}
+			if errors.Is(err, ErrBelowReserved) || errors.Is(err, ErrUnallocatedHolds) || errors.Is(err, ErrConflict) {
+				WriteError(w, 409, err.Error())
+				return
+			}
+			WriteError(w, 500, "db error")
+			return
+		}
+		WriteJSON(w, 200, l)
+
+	default:
+		WriteError(w, 405, "method not allowed")
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const minWebhookSecret = 16
+
+// WebhooksHandler lists and creates subscriptions. The secret is returned by
+// POST only; without one in the request a random secret is generated.
+func WebhooksHandler(rp WebhookStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			subs, err := rp.ListWebhooks(ctx)
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 200, subs)
+
+		case http.MethodPost:
+			var in struct {
+				URL    string   `json:"url"`
+				Events []string `json:"events"`
+				Secret string   `json:"secret"`
+			}
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+			u, ok := validWebhookURL(w, in.URL)
+			if !ok {
+				return
+			}
+			events, ok := validWebhookEvents(w, in.Events)
+			if !ok {
+				return
+			}
+			secret := in.Secret
+			if secret == "" {
+				b := make([]byte, 32)
+				if _, err := rand.Read(b); err != nil {
+					WriteError(w, 500, "internal error")
+					return
+				}
+				secret = hex.EncodeToString(b)
+			} else if len(secret) < minWebhookSecret {
+				WriteError(w, 400, "secret must be at least 16 characters")
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			p, _ := PrincipalFrom(r.Context())
+			sub, err := rp.CreateWebhook(ctx, models.WebhookSubscription{
+				URL:       u,
+				Events:    events,
+				Secret:    secret,
+				Active:    true,
+				CreatedBy: p.CustomerID.Hex(),
+				CreatedAt: time.Now(),
+			})
+			if err != nil {
+				WriteError(w, 500, "db error")
+				return
+			}
+			WriteJSON(w, 201, struct {
+				models.WebhookSubscription
+				Secret string `json:"secret"`
+			}{sub, sub.Secret})
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+// WebhookByIDHandler serves one subscription:
+//
+//	GET|PATCH|DELETE /webhooks/{id}
+//	GET  /webhooks/{id}/deliveries?limit=
+//	POST /webhooks/{id}/test
+func WebhookByIDHandler(rp WebhookStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/webhooks/"), "/"), "/")
+		if idStr == "" {
+			WriteError(w, 400, "missing id")
+			return
+		}
+		id, err := primitive.ObjectIDFromHex(idStr)
+		if err != nil {
+			WriteError(w, 400, "invalid id")
+			return
+		}
+
+		switch action {
+		case "":
+		case "deliveries":
+			webhookDeliveries(w, r, rp, id)
+			return
+		case "test":
+			testWebhook(w, r, rp, id)
+			return
+		default:
+			WriteError(w, 404, "not found")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			sub, err := rp.GetWebhook(ctx, id)
+			if err != nil {
+				writeWebhookError(w, err)
+				return
+			}
+			WriteJSON(w, 200, sub)
+
+		case http.MethodPatch:
+			var in struct {
+				URL    *string   `json:"url"`
+				Events *[]string `json:"events"`
+				Active *bool     `json:"active"`
+			}
+			if err := ReadJSON(r, &in); err != nil {
+				WriteError(w, 400, "invalid json")
+				return
+			}
+			upd := bson.M{}
+			if in.URL != nil {
+				u, ok := validWebhookURL(w, *in.URL)
+				if !ok {
+					return
+				}
+				upd["url"] = u
+			}
+			if in.Events != nil {
+				events, ok := validWebhookEvents(w, *in.Events)
+				if !ok {
+					return
+				}
+				upd["events"] = events
+			}
+			if in.Active != nil {
+				upd["active"] = *in.Active
+			}
+			if len(upd) == 0 {
+				WriteError(w, 400, "nothing to update")
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			sub, err := rp.UpdateWebhook(ctx, id, upd)
+			if err != nil {
+				writeWebhookError(w, err)
+				return
+			}
+			WriteJSON(w, 200, sub)
+
+		case http.MethodDelete:
+			ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+			defer cancel()
+
+			if err := rp.DeleteWebhook(ctx, id); err != nil {
+				writeWebhookError(w, err)
+				return
+			}
+			WriteJSON(w, 200, map[string]string{"deleted": idStr})
+
+		default:
+			WriteError(w, 405, "method not allowed")
+		}
+	}
+}
+
+func webhookDeliveries(w http.ResponseWriter, r *http.Request, rp WebhookStore, id primitive.ObjectID) {
+	if r.Method != http.MethodGet {
+		WriteError(w, 405, "method not allowed")
+		return
+	}
+	limit := int64(50)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			limit = int64(n)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	if _, err := rp.GetWebhook(ctx, id); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	ds, err := rp.ListWebhookDeliveries(ctx, id, limit)
+	if err != nil {
+		WriteError(w, 500, "db error")
+		return
+	}
+	WriteJSON(w, 200, ds)
+}
+
+// testWebhook sends a webhook.test event to the subscription right away,
+// once and whether or not it is active, and answers with the logged delivery.
+func testWebhook(w http.ResponseWriter, r *http.Request, rp WebhookStore, id primitive.ObjectID) {
+	if r.Method != http.MethodPost {
+		WriteError(w, 405, "method not allowed")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	sub, err := rp.GetWebhook(ctx, id)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	now := time.Now()
+	eventID := primitive.NewObjectID().Hex()
+	payload, err := webhookPayload(eventID, models.WebhookTest, now, map[string]string{"subscription_id": sub.ID.Hex()})
+	if err != nil {
+		WriteError(w, 500, "internal error")
+		return
+	}
+	d := models.NewWebhookDelivery(sub.ID, eventID, models.WebhookTest, payload, 1, now)
+	// leased so the dispatcher leaves it to us
+	until := now.Add(webhookLease)
+	d.LockedUntil = &until
+	if d, err = rp.CreateWebhookDelivery(ctx, d); err != nil {
+		WriteError(w, 500, "db error")
+		return
+	}
+
+	actx, acancel := context.WithTimeout(context.Background(), webhookTimeout)
+	attemptWebhook(actx, sub, &d)
+	acancel()
+
+	sctx, scancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer scancel()
+	if err := rp.SaveWebhookDelivery(sctx, d); err != nil {
+		WriteError(w, 500, "db error")
+		return
+	}
+	WriteJSON(w, 200, d)
+}
+
+// validWebhookURL accepts absolute http and https URLs. It writes the error
+// response itself and reports success.
+func validWebhookURL(w http.ResponseWriter, raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		WriteError(w, 400, "url is required")
+		return "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		WriteError(w, 400, "url must be an absolute http or https url")
+		return "", false
+	}
+	return u.String(), true
+}
+
+// validWebhookEvents checks and deduplicates the subscribed events. It writes
+// the error response itself and reports success.
+func validWebhookEvents(w http.ResponseWriter, in []string) ([]string, bool) {
+	if len(in) == 0 {
+		WriteError(w, 400, "events are required")
+		return nil, false
+	}
+	seen := map[string]bool{}
+	out := make([]string, 0, len(in))
+	for _, e := range in {
+		if !models.ValidWebhookEvent(e) {
+			WriteError(w, 400, "unknown event "+e)
+			return nil, false
+		}
+		if !seen[e] {
+			seen[e] = true
+			out = append(out, e)
+		}
+	}
+	return out, true
+}
+
+func writeWebhookError(w http.ResponseWriter, err error) {
+	if err == mongo.ErrNoDocuments {
+		WriteError(w, 404, "not found")
+		return
+	}
+	WriteError(w, 500, "db error")
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"carparts/models"
 	"context"
+	"crypto/rand"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -15,6 +20,63 @@ import (
 
 func main() {
 	_ = godotenv.Load()
+	var store Store
+	if os.Getenv("STORE") == "memory" {
+		store = NewMemoryRepo()
+		log.Println("using in-memory store")
+	} else {
+		store = connectMongo()
+	}
+	events := NewEventHub()
+	outbox := StartOutboxWorker(store, events)
+	webhooks := StartWebhookDispatcher(store)
+	if d, err := time.ParseDuration(os.Getenv("RESERVATION_TTL")); err == nil && d > 0 {
+		reservationTTL = d
+	}
+	every := reservationTTL / 4
+	if every > time.Minute {
+		every = time.Minute
+	}
+	StartReservationWorker(store, every)
+	if d, err := time.ParseDuration(os.Getenv("REORDER_INTERVAL")); err == nil && d > 0 {
+		StartReorderWorker(store, d)
+	}
+	ensureAdmin(store)
+
+	tokens := NewTokenIssuer(authSecret())
+
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, store, tokens, events)
+
+	srv := &http.Server{Addr: ":8080", Handler: Authenticate(tokens, store, mux)}
+	srv.RegisterOnShutdown(events.Close) // open streams would hold Shutdown up
+	stop, unnotify := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer unnotify()
+	go func() {
+		log.Println("server started on :8080")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	<-stop.Done()
+
+	// finish in-flight requests first so their outbox events are written,
+	// then deliver what is due before exiting
+	log.Println("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("http shutdown: %v", err)
+	}
+	if err := outbox.Shutdown(ctx); err != nil {
+		log.Printf("outbox drain: %v", err)
+	}
+	if err := webhooks.Shutdown(ctx); err != nil {
+		log.Printf("webhook shutdown: %v", err)
+	}
+}
+
+func connectMongo() *Repo {
 	uri := os.Getenv("MONGO_URI")
 	dbName := os.Getenv("MONGO_DB")
 	if uri == "" || dbName == "" {
@@ -31,13 +93,57 @@ func main() {
 	if err := client.Ping(ctx, nil); err != nil {
 		log.Fatal(err)
 	}
-
 	repo := NewRepo(client.Database(dbName))
-	StartLowStockWorker(repo)
+	if err := repo.EnsureIndexes(ctx); err != nil {
+		log.Fatal(err)
+	}
+	// a catalog-wide backfill can take longer than connecting
+	rctx, rcancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer rcancel()
+	if err := repo.ReindexParts(rctx); err != nil {
+		log.Fatal(err)
+	}
+	if err := repo.LoadSuggestions(rctx); err != nil {
+		log.Fatal(err)
+	}
+	return repo
+}
 
-	mux := http.NewServeMux()
-	RegisterRoutes(mux, repo)
+// authSecret is the HMAC key for access tokens. Without AUTH_SECRET a random
+// key is used, which logs everyone out on restart.
+func authSecret() []byte {
+	if s := os.Getenv("AUTH_SECRET"); s != "" {
+		return []byte(s)
+	}
+	log.Println("AUTH_SECRET not set, using a random key")
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal(err)
+	}
+	return b
+}
 
-	log.Println("server started on :8080")
-	log.Fatal(http.ListenAndServe(":8080", mux))
+// ensureAdmin creates the ADMIN_EMAIL account on first start so there is
+// someone who can hand out the other roles.
+func ensureAdmin(s CustomerStore) {
+	email := models.NormalizeEmail(os.Getenv("ADMIN_EMAIL"))
+	pw := os.Getenv("ADMIN_PASSWORD")
+	if email == "" || pw == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := s.GetCustomerByEmail(ctx, email); err == nil {
+		return
+	}
+	c := models.Customer{FirstName: "Admin", Email: email, Role: models.RoleAdmin, CreatedAt: time.Now()}
+	if err := c.SetPassword(pw); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := s.CreateCustomer(ctx, c); err != nil && !errors.Is(err, ErrDuplicate) {
+		log.Fatal(err)
+	}
+	log.Printf("created admin account %s", email)
 }
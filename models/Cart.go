@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CartItem struct {
+	PartID   primitive.ObjectID `bson:"part_id" json:"part_id"`
+	Quantity int                `bson:"quantity" json:"quantity"`
+	// Price is the unit price the customer last saw; checkout is refused
+	// until it matches the part's current price again.
+	Price       float64             `bson:"price" json:"price"`
+	WarehouseID *primitive.ObjectID `bson:"warehouse_id,omitempty" json:"warehouse_id,omitempty"`
+}
+
+// Cart belongs either to a customer or to an anonymous session, identified
+// by the hash of the token handed out with the first line.
+type Cart struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	CustomerID  *primitive.ObjectID `bson:"customer_id,omitempty" json:"customer_id,omitempty"`
+	SessionHash string              `bson:"session_hash,omitempty" json:"-"`
+	Items       []CartItem          `bson:"items" json:"items"`
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// Line returns the index of the part's line, or -1.
+func (c *Cart) Line(partID primitive.ObjectID) int {
+	for i, it := range c.Items {
+		if it.PartID == partID {
+			return i
+		}
+	}
+	return -1
+}
+
+// SetLine replaces the part's line, adding it if needed; a quantity of zero
+// removes it.
+func (c *Cart) SetLine(it CartItem) {
+	i := c.Line(it.PartID)
+	switch {
+	case i < 0 && it.Quantity > 0:
+		c.Items = append(c.Items, it)
+	case i >= 0 && it.Quantity > 0:
+		c.Items[i] = it
+	case i >= 0:
+		c.Items = append(c.Items[:i], c.Items[i+1:]...)
+	}
+}
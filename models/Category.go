@@ -7,6 +7,9 @@ type Category struct {
 	Name        string               `bson:"name" json:"name"`
 	Description string               `bson:"description" json:"description"`
 	PartsList   []primitive.ObjectID `bson:"parts_list" json:"parts_list"`
+
+	// StockThresholds are the defaults for the category's parts.
+	StockThresholds `bson:",inline"`
 }
 
 func (cat *Category) AddCategory()                    {}
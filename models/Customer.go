@@ -1,15 +1,67 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
 
 type Customer struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	FirstName string             `bson:"first_name" json:"first_name"`
-	Phone     string             `bson:"phone" json:"phone"`
-	Email     string             `bson:"email" json:"email"`
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	FirstName    string             `bson:"first_name" json:"first_name"`
+	Phone        string             `bson:"phone" json:"phone"`
+	Email        string             `bson:"email" json:"email"`
+	PasswordHash string             `bson:"password_hash" json:"-"` // bcrypt, never serialized
+	Role         Role               `bson:"role" json:"role"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
+
+func (c *Customer) Register() {}
+
+// AccountRole defaults accounts created before roles existed to retail customers.
+func (c *Customer) AccountRole() Role {
+	if c.Role == "" {
+		return RoleCustomer
+	}
+	return c.Role
+}
+
+// SetPassword stores a bcrypt hash of pw.
+func (c *Customer) SetPassword(pw string) error {
+	h, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	c.PasswordHash = string(h)
+	return nil
 }
 
-func (c *Customer) Register()                 {}
-func (c *Customer) Login()                    {}
-func (c *Customer) UpdateProfile()            {}
-func (c *Customer) ViewOrderHistory() []Order { return nil }
+// Login reports whether pw matches the stored hash.
+func (c *Customer) Login(pw string) bool {
+	if c.PasswordHash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(c.PasswordHash), []byte(pw)) == nil
+}
+
+func (c *Customer) UpdateProfile() {}
+
+// NormalizeEmail lowercases and trims an address so uniqueness checks are
+// not defeated by "A@x.kz" vs "a@x.kz".
+func NormalizeEmail(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// NormalizePhone keeps only digits and a leading '+', so
+// "+7 (701) 123-45-67" and "+77011234567" are the same number.
+func NormalizePhone(s string) string {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(s) {
+		if (r >= '0' && r <= '9') || (r == '+' && i == 0) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
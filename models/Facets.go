@@ -0,0 +1,58 @@
+package models
+
+// PriceBuckets are the lower bounds of the price ranges parts are counted
+// in; the last range is open-ended.
+var PriceBuckets = []float64{0, 5000, 10000, 25000, 50000, 100000}
+
+// FacetCount is how many parts have Value. Label names it for display when
+// Value is an id.
+type FacetCount struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	Count int    `json:"count"`
+}
+
+// PriceBucketCount counts the parts priced from Min up to, not including,
+// Max. Max is nil for the top bucket.
+type PriceBucketCount struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max,omitempty"`
+	Count int      `json:"count"`
+}
+
+// PartFacets breaks a set of parts down by the fields the catalog is
+// narrowed by. Value lists are ordered by count, most first.
+type PartFacets struct {
+	Total      int          `json:"total"`
+	Brands     []FacetCount `json:"brand"`
+	Categories []FacetCount `json:"category"`
+	CarModels  []FacetCount `json:"car_model"`
+	Condition  struct {
+		New  int `json:"new"`
+		Used int `json:"used"`
+	} `json:"is_new"`
+	Price []PriceBucketCount `json:"price"`
+	Stock struct {
+		InStock    int `json:"in_stock"`
+		OutOfStock int `json:"out_of_stock"`
+	} `json:"in_stock"`
+}
+
+// NewPartFacets returns facets counting no parts, with every price bucket
+// listed.
+func NewPartFacets() PartFacets {
+	f := PartFacets{
+		Brands:     []FacetCount{},
+		Categories: []FacetCount{},
+		CarModels:  []FacetCount{},
+		Price:      make([]PriceBucketCount, len(PriceBuckets)),
+	}
+	for i, lo := range PriceBuckets {
+		f.Price[i].Min = lo
+		if i+1 < len(PriceBuckets) {
+			hi := PriceBuckets[i+1]
+			f.Price[i].Max = &hi
+		}
+	}
+	return f
+}
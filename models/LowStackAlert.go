@@ -6,10 +6,72 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	AlertOpen         = "open"
+	AlertAcknowledged = "acknowledged"
+	AlertResolved     = "resolved"
+)
+
+// alertTransitions: staff acknowledge or resolve an alert, and may reopen an
+// acknowledged one. Resolved alerts stay resolved; if the part runs low
+// again a new alert is opened.
+var alertTransitions = map[string][]string{
+	AlertOpen:         {AlertAcknowledged, AlertResolved},
+	AlertAcknowledged: {AlertOpen, AlertResolved},
+	AlertResolved:     {},
+}
+
+func ValidAlertStatus(s string) bool {
+	_, ok := alertTransitions[s]
+	return ok
+}
+
+func CanTransitionAlert(from, to string) bool {
+	for _, s := range alertTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// LowStockAlert is raised once per part while it sits at or below its
+// reorder point; Stock and Critical follow the part until the alert is
+// resolved, by staff or automatically once stock is back above the point.
 type LowStockAlert struct {
-	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	PartID primitive.ObjectID `bson:"part_id" json:"part_id"`
-	Name   string             `bson:"name" json:"name"`
-	Stock  int                `bson:"stock" json:"stock"`
-	At     time.Time          `bson:"at" json:"at"`
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PartID       primitive.ObjectID `bson:"part_id" json:"part_id"`
+	Name         string             `bson:"name" json:"name"`
+	Stock        int                `bson:"stock" json:"stock"` // available to promise
+	ReorderPoint int                `bson:"reorder_point" json:"reorder_point"`
+	SafetyStock  int                `bson:"safety_stock" json:"safety_stock"`
+	Critical     bool               `bson:"critical" json:"critical"` // at or below safety stock
+	Status       string             `bson:"status" json:"status"`
+	// Current is true until the alert is resolved; a unique index on
+	// (part_id) over current alerts keeps one unresolved alert per part.
+	Current        bool       `bson:"current" json:"-"`
+	At             time.Time  `bson:"at" json:"at"`
+	UpdatedAt      time.Time  `bson:"updated_at" json:"updated_at"`
+	AcknowledgedAt *time.Time `bson:"acknowledged_at,omitempty" json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string     `bson:"acknowledged_by,omitempty" json:"acknowledged_by,omitempty"`
+	ResolvedAt     *time.Time `bson:"resolved_at,omitempty" json:"resolved_at,omitempty"`
+	ResolvedBy     string     `bson:"resolved_by,omitempty" json:"resolved_by,omitempty"`
+}
+
+// SetStatus applies a staff transition in memory; it reports false and
+// leaves the alert untouched if the lifecycle does not allow it.
+func (a *LowStockAlert) SetStatus(status, actor string, at time.Time) bool {
+	if !CanTransitionAlert(a.Status, status) {
+		return false
+	}
+	a.Status = status
+	a.UpdatedAt = at
+	switch status {
+	case AlertAcknowledged:
+		a.AcknowledgedAt, a.AcknowledgedBy = &at, actor
+	case AlertResolved:
+		a.ResolvedAt, a.ResolvedBy = &at, actor
+		a.Current = false
+	}
+	return true
 }
@@ -6,18 +6,88 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	StatusCreated   = "created"
+	StatusPaid      = "paid"
+	StatusPicking   = "picking"
+	StatusShipped   = "shipped"
+	StatusDelivered = "delivered"
+	StatusCanceled  = "canceled"
+	StatusRefunded  = "refunded"
+)
+
+// orderTransitions is the order lifecycle:
+// created → paid → picking → shipped → delivered, with canceled allowed
+// until the order ships and refunded once money has been taken.
+var orderTransitions = map[string][]string{
+	StatusCreated:   {StatusPaid, StatusCanceled},
+	StatusPaid:      {StatusPicking, StatusCanceled, StatusRefunded},
+	StatusPicking:   {StatusShipped, StatusCanceled, StatusRefunded},
+	StatusShipped:   {StatusDelivered},
+	StatusDelivered: {StatusRefunded},
+	StatusCanceled:  {},
+	StatusRefunded:  {},
+}
+
+func ValidOrderStatus(s string) bool {
+	_, ok := orderTransitions[s]
+	return ok
+}
+
+func CanTransition(from, to string) bool {
+	for _, s := range orderTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ActorSystem marks status changes made by background jobs.
+const ActorSystem = "system"
+
+// StatusChange is one entry of an order's status history. Actor is the id of
+// the account that made the change, or "system" for background jobs.
+type StatusChange struct {
+	From  string    `bson:"from" json:"from"`
+	To    string    `bson:"to" json:"to"`
+	At    time.Time `bson:"at" json:"at"`
+	Actor string    `bson:"actor" json:"actor"`
+}
+
 type Order struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	CustomerID primitive.ObjectID `bson:"customer_id" json:"customer_id"`
-	Items      []OrderItem        `bson:"items" json:"items"`
-	IsPaid     bool               `bson:"is_paid" json:"is_paid"`
-	TotalPrice float64            `bson:"total_price" json:"total_price"`
-	Status     string             `bson:"status" json:"status"`
-	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CustomerID    primitive.ObjectID `bson:"customer_id" json:"customer_id"`
+	Items         []OrderItem        `bson:"items" json:"items"`
+	IsPaid        bool               `bson:"is_paid" json:"is_paid"`
+	TotalPrice    float64            `bson:"total_price" json:"total_price"`
+	Status        string             `bson:"status" json:"status"`
+	StatusHistory []StatusChange     `bson:"status_history" json:"status_history"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	// ReservedUntil is set when the items are held rather than taken from
+	// stock; an order still unpaid by then is canceled and the holds freed.
+	ReservedUntil *time.Time `bson:"reserved_until,omitempty" json:"reserved_until,omitempty"`
+}
+
+func (o *Order) CreateOrder() {}
+
+// UpdateStatus applies a transition in memory; it reports false and leaves
+// the order untouched if the lifecycle does not allow it.
+func (o *Order) UpdateStatus(status, actor string, at time.Time) bool {
+	if !CanTransition(o.Status, status) {
+		return false
+	}
+	o.StatusHistory = append(o.StatusHistory, StatusChange{From: o.Status, To: status, At: at, Actor: actor})
+	o.Status = status
+	switch status {
+	case StatusPaid:
+		o.IsPaid = true
+	case StatusRefunded:
+		o.IsPaid = false
+	}
+	return true
 }
 
-func (o *Order) CreateOrder()               {}
-func (o *Order) UpdateStatus(status string) { o.Status = status }
 func (o *Order) CalculateTotal() float64 {
 	var t float64
 	for _, it := range o.Items {
@@ -25,4 +95,15 @@ func (o *Order) CalculateTotal() float64 {
 	}
 	return t
 }
-func (o *Order) Cancel() { o.Status = "canceled" }
+
+func (o *Order) PartIDs() []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, 0, len(o.Items))
+	for _, it := range o.Items {
+		ids = append(ids, it.PartID)
+	}
+	return ids
+}
+
+func (o *Order) Cancel(actor string, at time.Time) bool {
+	return o.UpdateStatus(StatusCanceled, actor, at)
+}
@@ -8,6 +8,9 @@ type OrderItem struct {
 	PartID   primitive.ObjectID `bson:"part_id" json:"part_id"`
 	Price    float64            `bson:"price" json:"price"`
 	Quantity int                `bson:"quantity" json:"quantity"`
+	// WarehouseID is the location the line ships from; nil for parts that
+	// are not stocked per warehouse.
+	WarehouseID *primitive.ObjectID `bson:"warehouse_id,omitempty" json:"warehouse_id,omitempty"`
 }
 
 func (oi *OrderItem) AddItem()    {}
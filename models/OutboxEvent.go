@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Outbox topics. TopicStockChanged asks for PartIDs to be re-checked
+// against their thresholds; the order topics announce OrderID, which moved
+// to Status, to webhook subscribers.
+const (
+	TopicStockChanged       = "stock_changed"
+	TopicOrderCreated       = "order_created"
+	TopicOrderStatusChanged = "order_status_changed"
+)
+
+// OutboxEvent is written in the same unit as the change it announces and
+// deleted once delivered. A delivery that keeps failing is moved to the dead
+// letters with DeadAt set.
+type OutboxEvent struct {
+	ID            primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Topic         string               `bson:"topic" json:"topic"`
+	PartIDs       []primitive.ObjectID `bson:"part_ids,omitempty" json:"part_ids,omitempty"`
+	OrderID       *primitive.ObjectID  `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	Status        string               `bson:"status,omitempty" json:"status,omitempty"`
+	Attempts      int                  `bson:"attempts" json:"attempts"`
+	NextAttemptAt time.Time            `bson:"next_attempt_at" json:"next_attempt_at"`
+	// LockedUntil is the lease of the worker delivering it; a worker that
+	// dies mid-delivery leaves the event to be claimed again once it lapses.
+	LockedUntil *time.Time `bson:"locked_until,omitempty" json:"locked_until,omitempty"`
+	LastError   string     `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	DeadAt      *time.Time `bson:"dead_at,omitempty" json:"dead_at,omitempty"`
+}
+
+func NewStockChangedEvent(partIDs []primitive.ObjectID, at time.Time) OutboxEvent {
+	return OutboxEvent{
+		ID:            primitive.NewObjectID(),
+		Topic:         TopicStockChanged,
+		PartIDs:       append([]primitive.ObjectID{}, partIDs...),
+		NextAttemptAt: at,
+		CreatedAt:     at,
+	}
+}
+
+func NewOrderEvent(topic string, orderID primitive.ObjectID, status string, at time.Time) OutboxEvent {
+	return OutboxEvent{
+		ID:            primitive.NewObjectID(),
+		Topic:         topic,
+		OrderID:       &orderID,
+		Status:        status,
+		NextAttemptAt: at,
+		CreatedAt:     at,
+	}
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PartNumberKey folds a part number for lookup: upper case with spaces,
+// dashes, dots, slashes and any other separators removed, so "04465-33471"
+// and "0446533471" are the same number.
+func PartNumberKey(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// CleanPartNumbers trims the numbers and drops blanks and numbers whose key
+// repeats an earlier one.
+func CleanPartNumbers(nums []string) []string {
+	seen := map[string]bool{}
+	out := make([]string, 0, len(nums))
+	for _, n := range nums {
+		n = strings.TrimSpace(n)
+		k := PartNumberKey(n)
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		out = append(out, n)
+	}
+	return out
+}
+
+// PartNumberRef is a number as printed by a brand.
+type PartNumberRef struct {
+	Brand  string `bson:"brand" json:"brand"`
+	Number string `bson:"number" json:"number"`
+}
+
+// CrossReference groups numbers, across brands, for parts that can replace
+// one another.
+type CrossReference struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Numbers    []PartNumberRef    `bson:"numbers" json:"numbers"`
+	NumberKeys []string           `bson:"number_keys" json:"-"`
+	Note       string             `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Normalize trims the numbers, drops blanks and repeats, and fills in
+// NumberKeys.
+func (x *CrossReference) Normalize() {
+	seen := map[string]bool{}
+	nums := make([]PartNumberRef, 0, len(x.Numbers))
+	x.NumberKeys = make([]string, 0, len(x.Numbers))
+	for _, n := range x.Numbers {
+		n.Brand, n.Number = strings.TrimSpace(n.Brand), strings.TrimSpace(n.Number)
+		k := PartNumberKey(n.Number)
+		if k == "" || seen[n.Brand+"\x00"+k] {
+			continue
+		}
+		seen[n.Brand+"\x00"+k] = true
+		nums = append(nums, n)
+		if !seen[k] {
+			seen[k] = true
+			x.NumberKeys = append(x.NumberKeys, k)
+		}
+	}
+	x.Numbers = nums
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	PurchaseDraft             = "draft"
+	PurchaseSent              = "sent"
+	PurchasePartiallyReceived = "partially_received"
+	PurchaseReceived          = "received"
+)
+
+func ValidPurchaseStatus(s string) bool {
+	switch s {
+	case PurchaseDraft, PurchaseSent, PurchasePartiallyReceived, PurchaseReceived:
+		return true
+	}
+	return false
+}
+
+// PurchaseOrderLine orders Quantity of a part. AlertID links the line to the
+// low-stock alert it was raised for; receiving the line in full resolves it.
+type PurchaseOrderLine struct {
+	PartID           primitive.ObjectID  `bson:"part_id" json:"part_id"`
+	Quantity         int                 `bson:"quantity" json:"quantity"`
+	ReceivedQuantity int                 `bson:"received_quantity" json:"received_quantity"`
+	UnitPrice        float64             `bson:"unit_price" json:"unit_price"`
+	AlertID          *primitive.ObjectID `bson:"alert_id,omitempty" json:"alert_id,omitempty"`
+}
+
+func (l PurchaseOrderLine) Outstanding() int { return l.Quantity - l.ReceivedQuantity }
+
+// PurchaseOrder buys stock from a supplier: draft → sent → partially_received
+// → received. Goods are booked into WarehouseID when set, otherwise only into
+// SparePart.Stock.
+type PurchaseOrder struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	SupplierID  primitive.ObjectID  `bson:"supplier_id" json:"supplier_id"`
+	WarehouseID *primitive.ObjectID `bson:"warehouse_id,omitempty" json:"warehouse_id,omitempty"`
+	Lines       []PurchaseOrderLine `bson:"lines" json:"lines"`
+	Status      string              `bson:"status" json:"status"`
+	Total       float64             `bson:"total" json:"total"`
+	Note        string              `bson:"note" json:"note"`
+	CreatedBy   string              `bson:"created_by" json:"created_by"`
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+	SentAt      *time.Time          `bson:"sent_at,omitempty" json:"sent_at,omitempty"`
+	// ExpectedAt is SentAt plus the supplier's lead time.
+	ExpectedAt *time.Time `bson:"expected_at,omitempty" json:"expected_at,omitempty"`
+	ReceivedAt *time.Time `bson:"received_at,omitempty" json:"received_at,omitempty"`
+	UpdatedAt  time.Time  `bson:"updated_at" json:"updated_at"`
+}
+
+func (po *PurchaseOrder) CalcTotal() {
+	po.Total = 0
+	for _, l := range po.Lines {
+		po.Total += l.UnitPrice * float64(l.Quantity)
+	}
+}
+
+func (po *PurchaseOrder) PartIDs() []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, 0, len(po.Lines))
+	for _, l := range po.Lines {
+		ids = append(ids, l.PartID)
+	}
+	return ids
+}
+
+// Receive books quantities arriving now against the lines and moves the
+// order to partially_received or received. Callers check that no line gets
+// more than is outstanding. It returns the lines this receipt completed.
+func (po *PurchaseOrder) Receive(received map[primitive.ObjectID]int, at time.Time) []PurchaseOrderLine {
+	var completed []PurchaseOrderLine
+	done := true
+	for i := range po.Lines {
+		l := &po.Lines[i]
+		if n := received[l.PartID]; n > 0 {
+			l.ReceivedQuantity += n
+			if l.Outstanding() <= 0 {
+				completed = append(completed, *l)
+			}
+		}
+		if l.Outstanding() > 0 {
+			done = false
+		}
+	}
+	po.Status = PurchasePartiallyReceived
+	if done {
+		po.Status = PurchaseReceived
+		po.ReceivedAt = &at
+	}
+	po.UpdatedAt = at
+	return completed
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ReservationActive    = "active"
+	ReservationCommitted = "committed" // order paid, stock taken
+	ReservationReleased  = "released"  // order canceled or hold expired
+)
+
+// Reservation holds Quantity of a part for an order until ExpiresAt. While
+// active it counts towards SparePart.Reserved (and InventoryLevel.Reserved
+// when WarehouseID is set) but has not left stock yet.
+type Reservation struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	OrderID     primitive.ObjectID  `bson:"order_id" json:"order_id"`
+	PartID      primitive.ObjectID  `bson:"part_id" json:"part_id"`
+	WarehouseID *primitive.ObjectID `bson:"warehouse_id,omitempty" json:"warehouse_id,omitempty"`
+	Quantity    int                 `bson:"quantity" json:"quantity"`
+	Status      string              `bson:"status" json:"status"`
+	ExpiresAt   time.Time           `bson:"expires_at" json:"expires_at"`
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+type Role string
+
+const (
+	RoleAdmin    Role = "admin"
+	RoleStaff    Role = "staff"    // warehouse staff
+	RoleBuyer    Role = "buyer"    // service-center buyer
+	RoleCustomer Role = "customer" // retail customer
+)
+
+var Roles = []Role{RoleAdmin, RoleStaff, RoleBuyer, RoleCustomer}
+
+func (r Role) Valid() bool {
+	for _, x := range Roles {
+		if r == x {
+			return true
+		}
+	}
+	return false
+}
+
+// IsStaff reports whether the role works for the store rather than buying
+// from it.
+func (r Role) IsStaff() bool {
+	return r == RoleAdmin || r == RoleStaff
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session backs one login. The access tokens issued for it carry its ID, so
+// revoking the session (logout) invalidates them as well as the refresh token.
+type Session struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CustomerID  primitive.ObjectID `bson:"customer_id" json:"customer_id"`
+	RefreshHash string             `bson:"refresh_hash" json:"-"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	ExpiresAt   time.Time          `bson:"expires_at" json:"expires_at"`
+	RevokedAt   *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
@@ -12,15 +12,47 @@ type SparePart struct {
 	Brand           string             `bson:"brand" json:"brand"`
 	CarModel        string             `bson:"car_model" json:"car_model"`
 	Compatibility   string             `bson:"compatibility" json:"compatibility"`
+	PartNumber      string             `bson:"part_number,omitempty" json:"part_number,omitempty"` // the brand's own number
+	OEMNumbers      []string           `bson:"oem_numbers,omitempty" json:"oem_numbers,omitempty"`
+	NumberKeys      []string           `bson:"number_keys,omitempty" json:"-"` // see SetNumberKeys
 	Price           float64            `bson:"price" json:"price"`
 	Stock           int                `bson:"stock" json:"stock"`
+	Reserved        int                `bson:"reserved" json:"reserved"` // held for unpaid orders
 	Description     string             `bson:"description" json:"description"`
 	ManufactureDate time.Time          `bson:"manufacture_date" json:"manufacture_date"`
 	IsNew           bool               `bson:"is_new" json:"is_new"`
 	IsActive        bool               `bson:"is_active" json:"is_active"`
+	SearchTerms     []string           `bson:"search_terms,omitempty" json:"-"`
+	BrandTerms      []string           `bson:"brand_terms,omitempty" json:"-"` // the brand's alone, for the brand filter
+	ModelTerms      []string           `bson:"model_terms,omitempty" json:"-"` // the car model's alone
+	SearchVersion   int                `bson:"search_version,omitempty" json:"-"`
+	Score           float64            `bson:"-" json:"score,omitempty"` // relevance to the search, when there is one
+
+	StockThresholds `bson:",inline"`
 }
 
 func (s *SparePart) GetDetails()              {}
-func (s *SparePart) CheckStock() bool         { return s.Stock > 0 && s.IsActive }
+func (s *SparePart) CheckStock() bool         { return s.Available() > 0 && s.IsActive }
 func (s *SparePart) UpdatePrice(p float64)    { s.Price = p }
 func (s *SparePart) CheckCompatibility() bool { return s.Compatibility != "" }
+
+// SetNumberKeys refreshes NumberKeys after PartNumber or OEMNumbers change.
+func (s *SparePart) SetNumberKeys() {
+	s.NumberKeys = nil
+	for _, n := range append([]string{s.PartNumber}, s.OEMNumbers...) {
+		k := PartNumberKey(n)
+		if k == "" {
+			continue
+		}
+		dup := false
+		for _, have := range s.NumberKeys {
+			dup = dup || have == k
+		}
+		if !dup {
+			s.NumberKeys = append(s.NumberKeys, k)
+		}
+	}
+}
+
+// Available is the available-to-promise quantity: on hand minus holds.
+func (s *SparePart) Available() int { return s.Stock - s.Reserved }
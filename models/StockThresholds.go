@@ -0,0 +1,33 @@
+package models
+
+// Defaults for parts whose category sets no thresholds either. 5 is the
+// limit the low-stock alert always used.
+const (
+	DefaultReorderPoint = 5
+	DefaultSafetyStock  = 0
+)
+
+// StockThresholds drive low-stock alerts. An alert opens when a part's
+// available-to-promise quantity falls to ReorderPoint and is critical at
+// SafetyStock. Nil fields inherit: a part from its category, a category
+// from the defaults.
+type StockThresholds struct {
+	ReorderPoint *int `bson:"reorder_point,omitempty" json:"reorder_point,omitempty"`
+	SafetyStock  *int `bson:"safety_stock,omitempty" json:"safety_stock,omitempty"`
+}
+
+// Resolve fills t's unset fields from fallback and then from the defaults.
+func (t StockThresholds) Resolve(fallback StockThresholds) (reorderPoint, safetyStock int) {
+	reorderPoint, safetyStock = DefaultReorderPoint, DefaultSafetyStock
+	for _, v := range []*int{fallback.ReorderPoint, t.ReorderPoint} {
+		if v != nil {
+			reorderPoint = *v
+		}
+	}
+	for _, v := range []*int{fallback.SafetyStock, t.SafetyStock} {
+		if v != nil {
+			safetyStock = *v
+		}
+	}
+	return reorderPoint, safetyStock
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	TransferDraft     = "draft"
+	TransferInTransit = "in_transit"
+	TransferReceived  = "received"
+)
+
+type TransferLine struct {
+	PartID           primitive.ObjectID `bson:"part_id" json:"part_id"`
+	Quantity         int                `bson:"quantity" json:"quantity"`
+	ReceivedQuantity int                `bson:"received_quantity" json:"received_quantity"`
+}
+
+// TransferDiscrepancy records a line where the destination counted a
+// different quantity than was shipped. Missing is negative for overages.
+type TransferDiscrepancy struct {
+	PartID   primitive.ObjectID `bson:"part_id" json:"part_id"`
+	Shipped  int                `bson:"shipped" json:"shipped"`
+	Received int                `bson:"received" json:"received"`
+	Missing  int                `bson:"missing" json:"missing"`
+}
+
+// StockTransfer moves stock between warehouses: draft → in_transit (source
+// decremented) → received (destination incremented by what arrived).
+type StockTransfer struct {
+	ID              primitive.ObjectID    `bson:"_id,omitempty" json:"id"`
+	FromWarehouseID primitive.ObjectID    `bson:"from_warehouse_id" json:"from_warehouse_id"`
+	ToWarehouseID   primitive.ObjectID    `bson:"to_warehouse_id" json:"to_warehouse_id"`
+	Lines           []TransferLine        `bson:"lines" json:"lines"`
+	Status          string                `bson:"status" json:"status"`
+	Note            string                `bson:"note" json:"note"`
+	Discrepancies   []TransferDiscrepancy `bson:"discrepancies" json:"discrepancies"`
+	CreatedBy       string                `bson:"created_by" json:"created_by"`
+	CreatedAt       time.Time             `bson:"created_at" json:"created_at"`
+	DispatchedAt    *time.Time            `bson:"dispatched_at,omitempty" json:"dispatched_at,omitempty"`
+	ReceivedAt      *time.Time            `bson:"received_at,omitempty" json:"received_at,omitempty"`
+}
+
+// Receive fills in the received quantities (lines missing from received
+// arrived in full) and recomputes the discrepancies.
+func (t *StockTransfer) Receive(received map[primitive.ObjectID]int, at time.Time) {
+	t.Discrepancies = []TransferDiscrepancy{}
+	for i := range t.Lines {
+		l := &t.Lines[i]
+		l.ReceivedQuantity = l.Quantity
+		if n, ok := received[l.PartID]; ok {
+			l.ReceivedQuantity = n
+		}
+		if l.ReceivedQuantity != l.Quantity {
+			t.Discrepancies = append(t.Discrepancies, TransferDiscrepancy{
+				PartID:   l.PartID,
+				Shipped:  l.Quantity,
+				Received: l.ReceivedQuantity,
+				Missing:  l.Quantity - l.ReceivedQuantity,
+			})
+		}
+	}
+	t.Status = TransferReceived
+	t.ReceivedAt = &at
+}
+
+func (t *StockTransfer) PartIDs() []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, 0, len(t.Lines))
+	for _, l := range t.Lines {
+		ids = append(ids, l.PartID)
+	}
+	return ids
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SupplierPrice is what a supplier charges for one part. MinOrderQty, when
+// set, overrides the supplier's own minimum for this part.
+type SupplierPrice struct {
+	PartID      primitive.ObjectID `bson:"part_id" json:"part_id"`
+	Price       float64            `bson:"price" json:"price"`
+	MinOrderQty int                `bson:"min_order_qty,omitempty" json:"min_order_qty,omitempty"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type Supplier struct {
+	ID    primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name  string             `bson:"name" json:"name"`
+	Email string             `bson:"email" json:"email"`
+	Phone string             `bson:"phone" json:"phone"`
+	// LeadTimeDays is how long an order takes to arrive once sent.
+	LeadTimeDays int             `bson:"lead_time_days" json:"lead_time_days"`
+	MinOrderQty  int             `bson:"min_order_qty" json:"min_order_qty"`
+	Prices       []SupplierPrice `bson:"prices" json:"prices"`
+	IsActive     bool            `bson:"is_active" json:"is_active"`
+	CreatedAt    time.Time       `bson:"created_at" json:"created_at"`
+}
+
+func (s *Supplier) PriceFor(partID primitive.ObjectID) (SupplierPrice, bool) {
+	for _, p := range s.Prices {
+		if p.PartID == partID {
+			return p, true
+		}
+	}
+	return SupplierPrice{}, false
+}
+
+// OrderQuantity rounds want up to the minimum the supplier accepts for the
+// part.
+func (s *Supplier) OrderQuantity(partID primitive.ObjectID, want int) int {
+	moq := s.MinOrderQty
+	if p, ok := s.PriceFor(partID); ok && p.MinOrderQty > 0 {
+		moq = p.MinOrderQty
+	}
+	if want < moq {
+		return moq
+	}
+	return want
+}
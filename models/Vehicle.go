@@ -0,0 +1,74 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var BodyTypes = []string{"sedan", "hatchback", "wagon", "suv", "coupe", "convertible", "minivan", "pickup", "van"}
+
+func ValidBodyType(b string) bool {
+	for _, t := range BodyTypes {
+		if t == b {
+			return true
+		}
+	}
+	return false
+}
+
+// Vehicle is one variant in the catalog: a model over a range of production
+// years, optionally narrowed to an engine and a body type. Parts are tied to
+// variants through Fitment.
+type Vehicle struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Make       string             `bson:"make" json:"make"`
+	Model      string             `bson:"model" json:"model"`
+	Generation string             `bson:"generation,omitempty" json:"generation,omitempty"`
+	YearFrom   int                `bson:"year_from" json:"year_from"`
+	YearTo     int                `bson:"year_to" json:"year_to"` // 0 while still produced
+	EngineCode string             `bson:"engine_code,omitempty" json:"engine_code,omitempty"`
+	BodyType   string             `bson:"body_type,omitempty" json:"body_type,omitempty"`
+	// MakeKey and ModelKey are the names as VehicleKey folds them, so
+	// "Mercedes-Benz" and "mercedes benz" are the same make.
+	MakeKey   string    `bson:"make_key" json:"-"`
+	ModelKey  string    `bson:"model_key" json:"-"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// Normalize tidies the names and fills in the lookup keys.
+func (v *Vehicle) Normalize() {
+	v.Make = strings.Join(strings.Fields(v.Make), " ")
+	v.Model = strings.Join(strings.Fields(v.Model), " ")
+	v.Generation = strings.TrimSpace(v.Generation)
+	v.EngineCode = EngineKey(v.EngineCode)
+	v.BodyType = strings.ToLower(strings.TrimSpace(v.BodyType))
+	v.MakeKey = VehicleKey(v.Make)
+	v.ModelKey = VehicleKey(v.Model)
+}
+
+func (v Vehicle) FitsYear(year int) bool {
+	return v.YearFrom <= year && (v.YearTo == 0 || year <= v.YearTo)
+}
+
+// VehicleKey folds a make or model name for matching: lower case, with
+// hyphens and runs of spaces turned into single spaces.
+func VehicleKey(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(s, "-", " "))), " ")
+}
+
+// EngineKey folds an engine code for matching: upper case without spaces.
+func EngineKey(s string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(s), ""))
+}
+
+// Fitment records that a part fits a vehicle variant. Note carries any
+// restriction the variant alone cannot express, e.g. "front axle".
+type Fitment struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PartID    primitive.ObjectID `bson:"part_id" json:"part_id"`
+	VehicleID primitive.ObjectID `bson:"vehicle_id" json:"vehicle_id"`
+	Note      string             `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -1,15 +1,29 @@
 package models
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Warehouse struct {
-	ID    primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
-	Parts []primitive.ObjectID `bson:"parts" json:"parts"`
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	City      string             `bson:"city" json:"city"`
+	Address   string             `bson:"address" json:"address"`
+	IsActive  bool               `bson:"is_active" json:"is_active"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// InventoryLevel is the stock of one part in one warehouse. SparePart.Stock
+// is kept equal to the sum over warehouses for parts that have levels.
+type InventoryLevel struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	WarehouseID primitive.ObjectID `bson:"warehouse_id" json:"warehouse_id"`
+	PartID      primitive.ObjectID `bson:"part_id" json:"part_id"`
+	Quantity    int                `bson:"quantity" json:"quantity"`
+	Reserved    int                `bson:"reserved" json:"reserved"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
 }
 
-func (w *Warehouse) CheckInventory() []primitive.ObjectID { return w.Parts }
-func (w *Warehouse) UpdateStock(partID string)            {}
-func (w *Warehouse) GenerateReport()                      {}
-func (w *Warehouse) AlertLowStock()                       {}
+func (l InventoryLevel) Available() int { return l.Quantity - l.Reserved }
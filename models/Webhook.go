@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook event types a subscription can ask for.
+const (
+	WebhookOrderCreated       = "order.created"
+	WebhookOrderStatusChanged = "order.status_changed"
+	WebhookAlertOpened        = "alert.opened"
+	// WebhookTest is only sent by the test-fire endpoint and cannot be
+	// subscribed to.
+	WebhookTest = "webhook.test"
+)
+
+var webhookEvents = map[string]bool{
+	WebhookOrderCreated:       true,
+	WebhookOrderStatusChanged: true,
+	WebhookAlertOpened:        true,
+}
+
+func ValidWebhookEvent(e string) bool { return webhookEvents[e] }
+
+// WebhookSubscription receives every event listed in Events as a signed
+// POST to URL. Secret is the HMAC key; it is only shown when created.
+type WebhookSubscription struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	URL       string             `bson:"url" json:"url"`
+	Events    []string           `bson:"events" json:"events"`
+	Secret    string             `bson:"secret" json:"-"`
+	Active    bool               `bson:"active" json:"active"`
+	CreatedBy string             `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+func (s *WebhookSubscription) Wants(event string) bool {
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed" // out of attempts
+)
+
+// WebhookDelivery is one event for one subscription: the queue entry while
+// pending and the delivery log afterwards. Payload is the exact body sent.
+type WebhookDelivery struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SubscriptionID primitive.ObjectID `bson:"subscription_id" json:"subscription_id"`
+	// EventID is the same for every subscription receiving the event, so
+	// receivers can drop duplicates.
+	EventID       string     `bson:"event_id" json:"event_id"`
+	Event         string     `bson:"event" json:"event"`
+	Payload       string     `bson:"payload" json:"payload"`
+	Status        string     `bson:"status" json:"status"`
+	Attempts      int        `bson:"attempts" json:"attempts"`
+	MaxAttempts   int        `bson:"max_attempts" json:"max_attempts"`
+	NextAttemptAt time.Time  `bson:"next_attempt_at" json:"next_attempt_at"`
+	LockedUntil   *time.Time `bson:"locked_until,omitempty" json:"-"`
+	ResponseCode  int        `bson:"response_code,omitempty" json:"response_code,omitempty"`
+	ResponseBody  string     `bson:"response_body,omitempty" json:"response_body,omitempty"`
+	LastError     string     `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	CreatedAt     time.Time  `bson:"created_at" json:"created_at"`
+	DeliveredAt   *time.Time `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+}
+
+func NewWebhookDelivery(subscriptionID primitive.ObjectID, eventID, event string, payload []byte, maxAttempts int, at time.Time) WebhookDelivery {
+	return WebhookDelivery{
+		ID:             primitive.NewObjectID(),
+		SubscriptionID: subscriptionID,
+		EventID:        eventID,
+		Event:          event,
+		Payload:        string(payload),
+		Status:         DeliveryPending,
+		MaxAttempts:    maxAttempts,
+		NextAttemptAt:  at,
+		CreatedAt:      at,
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// stockSnapshot is what a failed PlaceOrder must leave untouched.
+type stockSnapshot struct {
+	Stock, Reserved int
+	Levels          map[primitive.ObjectID][2]int // warehouse: quantity, reserved
+}
+
+func snapshotStock(t *testing.T, s Store, partID primitive.ObjectID) stockSnapshot {
+	t.Helper()
+	ctx := context.Background()
+	p, err := s.GetPart(ctx, partID)
+	if err != nil {
+		t.Fatalf("get part: %v", err)
+	}
+	levels, err := s.PartInventory(ctx, partID)
+	if err != nil {
+		t.Fatalf("part inventory: %v", err)
+	}
+	snap := stockSnapshot{Stock: p.Stock, Reserved: p.Reserved, Levels: map[primitive.ObjectID][2]int{}}
+	for _, l := range levels {
+		snap.Levels[l.WarehouseID] = [2]int{l.Quantity, l.Reserved}
+	}
+	return snap
+}
+
+func equalSnapshots(a, b stockSnapshot) bool {
+	if a.Stock != b.Stock || a.Reserved != b.Reserved || len(a.Levels) != len(b.Levels) {
+		return false
+	}
+	for w, l := range a.Levels {
+		if b.Levels[w] != l {
+			return false
+		}
+	}
+	return true
+}
+
+// placeOrderFixture creates a warehouse-stocked part and a second part that
+// cannot fill its line, for an order that fails on its second item.
+func placeOrderFixture(t *testing.T, s Store) (stocked, empty primitive.ObjectID) {
+	t.Helper()
+	ctx := context.Background()
+	c, err := s.CreateCategory(ctx, models.Category{Name: "Brakes"})
+	if err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+	wh, err := s.CreateWarehouse(ctx, models.Warehouse{Name: "Main", City: "Almaty", IsActive: true})
+	if err != nil {
+		t.Fatalf("create warehouse: %v", err)
+	}
+	a, err := s.CreatePart(ctx, models.SparePart{CategoryID: c.ID, Brand: "Bosch", CarModel: "Camry", Price: 10, IsActive: true})
+	if err != nil {
+		t.Fatalf("create part: %v", err)
+	}
+	if _, err := s.SetStock(ctx, wh.ID, a.ID, 5); err != nil {
+		t.Fatalf("set stock: %v", err)
+	}
+	b, err := s.CreatePart(ctx, models.SparePart{CategoryID: c.ID, Brand: "Denso", CarModel: "Camry", Price: 20, IsActive: true})
+	if err != nil {
+		t.Fatalf("create part: %v", err)
+	}
+	return a.ID, b.ID
+}
+
+// assertPlaceOrderLeaksNoStock places an order whose first line can be held
+// and whose second cannot, and checks the first line's hold was undone.
+func assertPlaceOrderLeaksNoStock(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+	stocked, empty := placeOrderFixture(t, s)
+	before := snapshotStock(t, s, stocked)
+
+	o := models.Order{
+		CustomerID: primitive.NewObjectID(),
+		Status:     models.StatusCreated,
+		CreatedAt:  time.Now(),
+		Items: []models.OrderItem{
+			{PartID: stocked, Quantity: 2},
+			{PartID: empty, Quantity: 1},
+		},
+	}
+	if _, err := s.PlaceOrder(ctx, o); !errors.Is(err, ErrNotEnoughStock) {
+		t.Fatalf("PlaceOrder error = %v, want ErrNotEnoughStock", err)
+	}
+
+	if after := snapshotStock(t, s, stocked); !equalSnapshots(before, after) {
+		t.Errorf("stock after failed order = %+v, want %+v", after, before)
+	}
+	orders, _, err := s.ListOrders(ctx, OrderFilter{CustomerID: &o.CustomerID}, PageRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("list orders: %v", err)
+	}
+	if len(orders) != 0 {
+		t.Errorf("failed PlaceOrder stored %d orders", len(orders))
+	}
+}
+
+func TestMemoryPlaceOrderLeaksNoStock(t *testing.T) {
+	m := NewMemoryRepo()
+	assertPlaceOrderLeaksNoStock(t, m)
+	if len(m.reservations) != 0 {
+		t.Errorf("failed PlaceOrder left %d reservations", len(m.reservations))
+	}
+}
+
+func TestAtomicallyCompensatesInReverse(t *testing.T) {
+	saved := noTx.Load()
+	noTx.Store(true) // the saga path; no database is touched
+	defer noTx.Store(saved)
+
+	r := &Repo{}
+	var ran []int
+	committed := false
+	boom := errors.New("second line failed")
+	err := r.atomically(context.Background(), func(ctx context.Context, s *txScope) error {
+		s.OnCommit(func() { committed = true })
+		s.Compensate(func(context.Context) error { ran = append(ran, 1); return nil })
+		s.Compensate(func(context.Context) error { ran = append(ran, 2); return errors.New("logged, not fatal") })
+		s.Compensate(func(context.Context) error { ran = append(ran, 3); return nil })
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("atomically error = %v, want %v", err, boom)
+	}
+	if want := []int{3, 2, 1}; len(ran) != len(want) || ran[0] != 3 || ran[1] != 2 || ran[2] != 1 {
+		t.Errorf("compensations ran %v, want %v", ran, want)
+	}
+	if committed {
+		t.Error("OnCommit ran for a failed scope")
+	}
+
+	ran = nil
+	if err := r.atomically(context.Background(), func(ctx context.Context, s *txScope) error {
+		s.OnCommit(func() { committed = true })
+		s.Compensate(func(context.Context) error { ran = append(ran, 1); return nil })
+		return nil
+	}); err != nil {
+		t.Fatalf("atomically: %v", err)
+	}
+	if len(ran) != 0 || !committed {
+		t.Errorf("successful scope: compensations %v, committed %v", ran, committed)
+	}
+}
+
+// TestRepoPlaceOrderLeaksNoStock runs against MONGO_TEST_URI, in a database
+// of its own that it drops afterwards, once inside a transaction when the
+// deployment has them and once through the compensating saga.
+func TestRepoPlaceOrderLeaksNoStock(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	saved := noTx.Load()
+	defer noTx.Store(saved)
+	for _, saga := range []bool{false, true} {
+		name := "transaction"
+		if saga {
+			name = "saga"
+		}
+		t.Run(name, func(t *testing.T) {
+			noTx.Store(saga)
+			db := client.Database("carparts_test_" + primitive.NewObjectID().Hex())
+			defer db.Drop(context.Background())
+			r := NewRepo(db)
+			if err := r.EnsureIndexes(ctx); err != nil {
+				t.Fatalf("ensure indexes: %v", err)
+			}
+			assertPlaceOrderLeaksNoStock(t, r)
+			n, err := r.reservations.CountDocuments(ctx, map[string]any{})
+			if err != nil {
+				t.Fatalf("count reservations: %v", err)
+			}
+			if n != 0 {
+				t.Errorf("failed PlaceOrder left %d reservations", n)
+			}
+		})
+	}
+}
+
+func TestMemoryRefundRestocks(t *testing.T) {
+	m := NewMemoryRepo()
+	ctx := context.Background()
+	stocked, _ := placeOrderFixture(t, m)
+	before := snapshotStock(t, m, stocked)
+
+	// refunded from paid, then from picking
+	for _, path := range [][]string{
+		{models.StatusPaid, models.StatusRefunded},
+		{models.StatusPaid, models.StatusPicking, models.StatusRefunded},
+	} {
+		o, err := m.PlaceOrder(ctx, models.Order{
+			CustomerID: primitive.NewObjectID(),
+			Status:     models.StatusCreated,
+			Items:      []models.OrderItem{{PartID: stocked, Quantity: 2}},
+		})
+		if err != nil {
+			t.Fatalf("PlaceOrder: %v", err)
+		}
+		for _, st := range path {
+			if _, err := m.UpdateOrderStatus(ctx, o.ID, st, "test"); err != nil {
+				t.Fatalf("to %s: %v", st, err)
+			}
+		}
+		if after := snapshotStock(t, m, stocked); !equalSnapshots(before, after) {
+			t.Errorf("stock after %v = %+v, want %+v", path, after, before)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"carparts/models"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var errBadCursor = errors.New("invalid cursor")
+
+// Cursor marks the last document of a page ordered by (created_at, _id).
+// The _id breaks ties between documents created in the same millisecond.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        primitive.ObjectID
+}
+
+func (c Cursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixMilli(), 10) + ":" + c.ID.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errBadCursor
+	}
+	ms, hexID, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, errBadCursor
+	}
+	n, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return nil, errBadCursor
+	}
+	id, err := primitive.ObjectIDFromHex(hexID)
+	if err != nil {
+		return nil, errBadCursor
+	}
+	return &Cursor{CreatedAt: time.UnixMilli(n).UTC(), ID: id}, nil
+}
+
+// PageRequest is the ?cursor=&limit=&sort= part of a list request.
+type PageRequest struct {
+	After *Cursor
+	Limit int
+	Asc   bool // oldest first; the default is newest first
+}
+
+func ParsePageRequest(q url.Values) (PageRequest, error) {
+	pr := PageRequest{Limit: defaultPageSize}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return pr, errors.New("invalid limit")
+		}
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		pr.Limit = n
+	}
+	switch q.Get("sort") {
+	case "", "-created_at":
+	case "created_at":
+		pr.Asc = true
+	default:
+		return pr, errors.New("sort must be created_at or -created_at")
+	}
+	c, err := DecodeCursor(q.Get("cursor"))
+	if err != nil {
+		return pr, err
+	}
+	pr.After = c
+	return pr, nil
+}
+
+// Page is the envelope of every cursor-paginated response. NextCursor is
+// empty on the last page.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// trimPage cuts a result fetched with limit+1 rows down to limit and returns
+// the cursor of the last kept order if there was more.
+func trimPage(out []models.Order, limit int) ([]models.Order, string) {
+	if len(out) <= limit {
+		return out, ""
+	}
+	out = out[:limit]
+	last := out[len(out)-1]
+	return out, Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+}
+
+// parseTimeParam accepts RFC 3339 or a bare date. A bare date used as an
+// upper bound covers the whole day.
+func parseTimeParam(v string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24 * time.Hour)
+	}
+	return t, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxInterchangeHops bounds how far InterchangeableParts follows chains of
+// cross references.
+const maxInterchangeHops = 5
+
+// Interchange is what a part number lookup found. Equivalents are the
+// numbers cross-referenced with it, directly or through other references.
+type Interchange struct {
+	Number      string                 `json:"number"`
+	Key         string                 `json:"key"`
+	Equivalents []models.PartNumberRef `json:"equivalents"`
+	Parts       []models.SparePart     `json:"parts"`
+}
+
+// InterchangeableParts finds every active part that can stand in for
+// number. Numbers are treated as interchangeable when a cross reference
+// lists them together or one part carries both, e.g. its own number and an
+// OEM number; the relation is followed transitively for up to
+// maxInterchangeHops steps. Parts in stock come first.
+func InterchangeableParts(ctx context.Context, s Store, number string) (Interchange, error) {
+	out := Interchange{
+		Number:      number,
+		Key:         models.PartNumberKey(number),
+		Equivalents: []models.PartNumberRef{},
+		Parts:       []models.SparePart{},
+	}
+	if out.Key == "" {
+		return out, nil
+	}
+
+	known := map[string]bool{out.Key: true}
+	keys := []string{out.Key}
+	frontier := keys
+	seenRef := map[primitive.ObjectID]bool{}
+	seenNum := map[string]bool{}
+	for hop := 0; hop < maxInterchangeHops && len(frontier) > 0; hop++ {
+		var next []string
+		add := func(ks []string) {
+			for _, k := range ks {
+				if !known[k] {
+					known[k] = true
+					next = append(next, k)
+				}
+			}
+		}
+
+		refs, err := s.ListCrossReferences(ctx, frontier)
+		if err != nil {
+			return Interchange{}, err
+		}
+		for _, x := range refs {
+			if seenRef[x.ID] {
+				continue
+			}
+			seenRef[x.ID] = true
+			for _, n := range x.Numbers {
+				id := n.Brand + "\x00" + models.PartNumberKey(n.Number)
+				if !seenNum[id] {
+					seenNum[id] = true
+					out.Equivalents = append(out.Equivalents, n)
+				}
+			}
+			add(x.NumberKeys)
+		}
+		parts, err := s.ListPartsFiltered(ctx, PartFilter{NumberKeys: frontier})
+		if err != nil {
+			return Interchange{}, err
+		}
+		for _, p := range parts {
+			add(p.NumberKeys)
+		}
+
+		keys = append(keys, next...)
+		frontier = next
+	}
+
+	parts, err := s.ListPartsFiltered(ctx, PartFilter{NumberKeys: keys})
+	if err != nil {
+		return Interchange{}, err
+	}
+	sort.SliceStable(parts, func(i, j int) bool {
+		return parts[i].Available() > 0 && parts[j].Available() <= 0
+	})
+	out.Parts = parts
+	return out, nil
+}
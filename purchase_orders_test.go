@@ -0,0 +1,120 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryReceiveKeepsStockInWarehouses(t *testing.T) {
+	m := NewMemoryRepo()
+	ctx := context.Background()
+	stocked, _ := placeOrderFixture(t, m)
+	levels, _ := m.PartInventory(ctx, stocked)
+	wh := levels[0].WarehouseID
+
+	sup, err := m.CreateSupplier(ctx, models.Supplier{Name: "Acme", IsActive: true})
+	if err != nil {
+		t.Fatalf("create supplier: %v", err)
+	}
+	po, err := m.CreatePurchaseOrder(ctx, models.PurchaseOrder{
+		SupplierID: sup.ID,
+		Status:     models.PurchaseDraft,
+		Lines:      []models.PurchaseOrderLine{{PartID: stocked, Quantity: 4, UnitPrice: 3}},
+	})
+	if err != nil {
+		t.Fatalf("create purchase order: %v", err)
+	}
+	if _, err := m.SendPurchaseOrder(ctx, po.ID); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	before := snapshotStock(t, m, stocked)
+	received := map[primitive.ObjectID]int{stocked: 4}
+	if _, err := m.ReceivePurchaseOrder(ctx, po.ID, nil, received, "test"); !errors.Is(err, ErrReceiptWarehouse) {
+		t.Fatalf("receipt without a warehouse: error = %v, want ErrReceiptWarehouse", err)
+	}
+	if after := snapshotStock(t, m, stocked); !equalSnapshots(before, after) {
+		t.Fatalf("refused receipt changed stock: %+v, want %+v", after, before)
+	}
+
+	out, err := m.ReceivePurchaseOrder(ctx, po.ID, &wh, received, "test")
+	if err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	if out.WarehouseID == nil || *out.WarehouseID != wh {
+		t.Errorf("purchase order warehouse = %v, want %s", out.WarehouseID, wh.Hex())
+	}
+	after := snapshotStock(t, m, stocked)
+	if after.Stock != before.Stock+4 || after.Levels[wh][0] != before.Levels[wh][0]+4 {
+		t.Errorf("after receipt: %+v, want 4 more in the part and in %s", after, wh.Hex())
+	}
+}
+
+func TestMemoryReceiveAllocatesUnallocatedStock(t *testing.T) {
+	m := NewMemoryRepo()
+	ctx := context.Background()
+	_, part := placeOrderFixture(t, m) // no warehouse levels
+	if _, err := m.UpdatePart(ctx, part, bson.M{"stock": 10}); err != nil {
+		t.Fatalf("set stock: %v", err)
+	}
+	wh, err := m.CreateWarehouse(ctx, models.Warehouse{Name: "Astana", City: "Astana", IsActive: true})
+	if err != nil {
+		t.Fatalf("create warehouse: %v", err)
+	}
+	sup, err := m.CreateSupplier(ctx, models.Supplier{Name: "Acme", IsActive: true})
+	if err != nil {
+		t.Fatalf("create supplier: %v", err)
+	}
+	po, err := m.CreatePurchaseOrder(ctx, models.PurchaseOrder{
+		SupplierID: sup.ID,
+		Status:     models.PurchaseDraft,
+		Lines:      []models.PurchaseOrderLine{{PartID: part, Quantity: 4, UnitPrice: 3}},
+	})
+	if err != nil {
+		t.Fatalf("create purchase order: %v", err)
+	}
+	if _, err := m.SendPurchaseOrder(ctx, po.ID); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	if _, err := m.ReceivePurchaseOrder(ctx, po.ID, &wh.ID, map[primitive.ObjectID]int{part: 4}, "test"); err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	after := snapshotStock(t, m, part)
+	if after.Stock != 14 || len(after.Levels) != 1 || after.Levels[wh.ID] != [2]int{14, 0} {
+		t.Fatalf("after receipt: %+v, want 14 in the part and all of it in %s", after, wh.ID.Hex())
+	}
+	if _, err := m.PlaceOrder(ctx, models.Order{
+		CustomerID: primitive.NewObjectID(),
+		Status:     models.StatusCreated,
+		Items:      []models.OrderItem{{PartID: part, Quantity: 8}},
+	}); err != nil {
+		t.Errorf("an order for 8 of the 14: %v", err)
+	}
+}
+
+func TestPlanPurchaseOrdersDeduplicates(t *testing.T) {
+	part := primitive.NewObjectID()
+	sup := models.Supplier{ID: primitive.NewObjectID(), IsActive: true,
+		Prices: []models.SupplierPrice{{PartID: part, Price: 3}}}
+	a := models.LowStockAlert{ID: primitive.NewObjectID(), PartID: part, Status: models.AlertOpen, ReorderPoint: 5, Stock: 2}
+	b := a
+	b.ID, b.Stock = primitive.NewObjectID(), 0
+
+	pos, skipped := planPurchaseOrders([]models.LowStockAlert{a, a, b}, []models.Supplier{sup}, nil)
+	if len(pos) != 1 || len(pos[0].Lines) != 1 {
+		t.Fatalf("planned %+v, want one order with one line", pos)
+	}
+	l := pos[0].Lines[0]
+	if l.Quantity != 6 || l.AlertID == nil || *l.AlertID != a.ID {
+		t.Errorf("line = %+v, want 6 for alert %s", l, a.ID.Hex())
+	}
+	if len(skipped) != 1 || skipped[0].AlertID != b.ID {
+		t.Errorf("skipped = %+v, want the second alert for the part", skipped)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"carparts/models"
+	"net/http"
+	"strings"
+)
+
+// access lists the roles allowed on a route. A nil access means the route is
+// public.
+type access []models.Role
+
+func allow(roles ...models.Role) access { return access(roles) }
+
+var (
+	public   access
+	signedIn = allow(models.Roles...)
+	staff    = allow(models.RoleAdmin, models.RoleStaff)
+	admin    = allow(models.RoleAdmin)
+)
+
+type permission struct {
+	Method  string
+	Pattern string // "{id}" matches any single path segment
+	Access  access
+}
+
+// permissions is the per-route access table. It is deny by default: a path
+// not listed here is 404 before any handler sees it, and a listed path with
+// an unlisted method is 405.
+// Ownership rules (customers only see their own orders and profile) live in
+// the handlers, since they need the loaded document.
+var permissions = []permission{
+	{"GET", "/health", public},
+
+	{"POST", "/auth/login", public},
+	{"POST", "/auth/refresh", public},
+	{"POST", "/auth/logout", signedIn},
+
+	{"GET", "/categories", public},
+	{"POST", "/categories", staff},
+	{"GET", "/categories/{id}", public},
+	{"PUT", "/categories/{id}", staff},
+	{"DELETE", "/categories/{id}", admin},
+
+	{"GET", "/parts", public},
+	{"POST", "/parts", staff},
+	{"GET", "/parts/lookup", public},
+	{"GET", "/parts/{id}", public},
+	{"GET", "/parts/{id}/availability", public},
+	{"PUT", "/parts/{id}", staff},
+	{"PATCH", "/parts/{id}", staff},
+	{"DELETE", "/parts/{id}", admin},
+	{"GET", "/parts/{id}/fitment", public},
+	{"PUT", "/parts/{id}/fitment/{id}", staff},
+	{"DELETE", "/parts/{id}/fitment/{id}", staff},
+
+	{"GET", "/cross-references", public},
+	{"POST", "/cross-references", staff},
+	{"GET", "/cross-references/{id}", public},
+	{"PUT", "/cross-references/{id}", staff},
+	{"DELETE", "/cross-references/{id}", staff},
+
+	{"GET", "/warehouses", public},
+	{"POST", "/warehouses", admin},
+	{"GET", "/warehouses/{id}", public},
+	{"PUT", "/warehouses/{id}", admin},
+	{"DELETE", "/warehouses/{id}", admin},
+	{"GET", "/warehouses/{id}/stock", staff},
+	{"PUT", "/warehouses/{id}/stock", staff},
+
+	{"GET", "/transfers", staff},
+	{"POST", "/transfers", staff},
+	{"GET", "/transfers/in-transit", staff},
+	{"GET", "/transfers/{id}", staff},
+	{"POST", "/transfers/{id}/dispatch", staff},
+	{"POST", "/transfers/{id}/receive", staff},
+
+	{"GET", "/search/suggest", public},
+
+	{"GET", "/vehicle/search", public},
+	{"GET", "/vehicle/vin/{id}", public},
+	{"GET", "/vehicles", public},
+	{"POST", "/vehicles", staff},
+	{"GET", "/vehicles/makes", public},
+	{"GET", "/vehicles/models", public},
+	{"GET", "/vehicles/{id}", public},
+	{"PUT", "/vehicles/{id}", staff},
+	{"DELETE", "/vehicles/{id}", admin},
+
+	{"GET", "/customers", admin},
+	{"POST", "/customers", public},
+	{"GET", "/customers/{id}", signedIn},
+	{"PUT", "/customers/{id}", signedIn},
+	{"PATCH", "/customers/{id}", signedIn},
+	{"DELETE", "/customers/{id}", admin},
+	{"GET", "/customers/{id}/orders", signedIn},
+
+	{"GET", "/orders", signedIn},
+	{"POST", "/orders", signedIn},
+	{"GET", "/orders/{id}", signedIn},
+	{"DELETE", "/orders/{id}", signedIn},
+	{"PATCH", "/orders/{id}/status", staff},
+
+	// anonymous carts are allowed; an order needs a customer
+	{"GET", "/cart", public},
+	{"DELETE", "/cart", public},
+	{"POST", "/cart/items", public},
+	{"PUT", "/cart/items/{id}", public},
+	{"DELETE", "/cart/items/{id}", public},
+	{"POST", "/cart/checkout", signedIn},
+
+	{"GET", "/alerts", staff},
+	{"GET", "/alerts/stream", staff},
+	{"GET", "/alerts/{id}", staff},
+	{"PATCH", "/alerts/{id}", staff},
+
+	{"GET", "/outbox/dead-letters", admin},
+	{"POST", "/outbox/dead-letters/{id}/retry", admin},
+
+	{"GET", "/webhooks", admin},
+	{"POST", "/webhooks", admin},
+	{"GET", "/webhooks/{id}", admin},
+	{"PATCH", "/webhooks/{id}", admin},
+	{"DELETE", "/webhooks/{id}", admin},
+	{"GET", "/webhooks/{id}/deliveries", admin},
+	{"POST", "/webhooks/{id}/test", admin},
+
+	{"GET", "/suppliers", staff},
+	{"POST", "/suppliers", staff},
+	{"GET", "/suppliers/{id}", staff},
+	{"PUT", "/suppliers/{id}", staff},
+	{"DELETE", "/suppliers/{id}", admin},
+	{"PUT", "/suppliers/{id}/prices/{id}", staff},
+	{"DELETE", "/suppliers/{id}/prices/{id}", staff},
+
+	{"GET", "/purchase-orders", staff},
+	{"POST", "/purchase-orders", staff},
+	{"POST", "/purchase-orders/from-alerts", staff},
+	{"GET", "/purchase-orders/{id}", staff},
+	{"DELETE", "/purchase-orders/{id}", staff},
+	{"POST", "/purchase-orders/{id}/send", staff},
+	{"POST", "/purchase-orders/{id}/receive", staff},
+
+	{"GET", "/inventory/reorder-suggestions", staff},
+}
+
+// Authorize enforces the permissions table in front of h.
+func Authorize(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acc, pathKnown, ok := lookupPermission(r.Method, r.URL.Path)
+		if !ok {
+			if pathKnown {
+				WriteError(w, 405, "method not allowed")
+				return
+			}
+			WriteError(w, 404, "not found")
+			return
+		}
+		if acc == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		p, signed := PrincipalFrom(r.Context())
+		if !signed {
+			if reason, ok := authFailure(r.Context()); ok {
+				WriteError(w, 401, reason)
+				return
+			}
+			WriteError(w, 401, "authentication required")
+			return
+		}
+		for _, role := range acc {
+			if p.Role == role {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		WriteError(w, 403, "forbidden")
+	})
+}
+
+func lookupPermission(method, path string) (acc access, pathKnown, ok bool) {
+	for _, p := range permissions {
+		if !matchPattern(p.Pattern, path) {
+			continue
+		}
+		pathKnown = true
+		if p.Method == method {
+			return p.Access, true, true
+		}
+	}
+	return nil, pathKnown, false
+}
+
+func matchPattern(pattern, path string) bool {
+	ps := strings.Split(strings.Trim(pattern, "/"), "/")
+	xs := strings.Split(strings.Trim(path, "/"), "/")
+	if len(ps) != len(xs) {
+		return false
+	}
+	for i := range ps {
+		if ps[i] == "{id}" {
+			if xs[i] == "" {
+				return false
+			}
+			continue
+		}
+		if ps[i] != xs[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRoutesEnforcePermissions(t *testing.T) {
+	m := NewMemoryRepo()
+	ctx := context.Background()
+	stocked, _ := placeOrderFixture(t, m)
+	owner := Principal{CustomerID: primitive.NewObjectID(), Role: models.RoleCustomer}
+	other := Principal{CustomerID: primitive.NewObjectID(), Role: models.RoleCustomer}
+	staffer := Principal{CustomerID: primitive.NewObjectID(), Role: models.RoleStaff}
+	adm := Principal{CustomerID: primitive.NewObjectID(), Role: models.RoleAdmin}
+	o, err := m.PlaceOrder(ctx, models.Order{
+		CustomerID: owner.CustomerID,
+		Status:     models.StatusCreated,
+		Items:      []models.OrderItem{{PartID: stocked, Quantity: 1}},
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	order := "/orders/" + o.ID.Hex()
+	missing := primitive.NewObjectID().Hex()
+
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, m, NewTokenIssuer([]byte("test")), NewEventHub())
+
+	for _, tc := range []struct {
+		name   string
+		caller *Principal // nil is anonymous
+		method string
+		path   string
+		want   int
+	}{
+		{"public route", nil, "GET", "/health", 200},
+		{"unlisted path", nil, "GET", "/admin", 404},
+		{"unlisted path under a listed prefix", &adm, "GET", "/parts/" + missing + "/secrets", 404},
+		{"unlisted method", &adm, "PATCH", "/health", 405},
+		{"{id} is one segment", &adm, "GET", "/categories/a/b", 404},
+		{"{id} is not empty", &adm, "PUT", "/categories/", 405},
+
+		{"anonymous order", nil, "GET", order, 401},
+		{"own order", &owner, "GET", order, 200},
+		{"someone else's order", &other, "GET", order, 403},
+		{"someone else's order, canceled", &other, "DELETE", order, 403},
+		{"staff reads any order", &staffer, "GET", order, 200},
+		{"admin reads any order", &adm, "GET", order, 200},
+		{"customer sets order status", &owner, "PATCH", order + "/status", 403},
+
+		{"customer alerts", &owner, "GET", "/alerts", 403},
+		{"staff alerts", &staffer, "GET", "/alerts", 200},
+		{"staff deletes a part", &staffer, "DELETE", "/parts/" + missing, 403},
+		{"admin deletes a part", &adm, "DELETE", "/parts/" + missing, 200},
+		{"anonymous parts", nil, "GET", "/parts/" + missing, 404},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.caller != nil {
+			req = req.WithContext(withPrincipal(req.Context(), *tc.caller))
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: %s %s = %d, want %d (%s)", tc.name, tc.method, tc.path, rec.Code, tc.want, rec.Body.String())
+		}
+	}
+}
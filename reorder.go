@@ -0,0 +1,224 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultDemandWindowDays = 30
+	defaultCoverDays        = 14
+	maxReorderDays          = 365
+)
+
+// ReorderSuggestion is how much of a part to buy now. Position is what is on
+// hand to promise plus what open purchase orders still bring; once it is at
+// or below ReorderLevel, the demand expected over the lead time plus the
+// safety stock, SuggestedQty lifts it to TargetLevel, which also covers
+// CoverDays beyond the lead time. WarehouseID is where the goods should go
+// for a part stocked per warehouse: the active one with least to promise.
+type ReorderSuggestion struct {
+	PartID         primitive.ObjectID  `json:"part_id"`
+	Name           string              `json:"name"`
+	Available      int                 `json:"available"`
+	OnOrder        int                 `json:"on_order"`
+	Position       int                 `json:"position"`
+	Demand         int                 `json:"demand"` // units ordered in the window
+	AvgDailyDemand float64             `json:"avg_daily_demand"`
+	DaysOfCover    *float64            `json:"days_of_cover,omitempty"` // nil without demand
+	LeadTimeDays   int                 `json:"lead_time_days"`
+	SafetyStock    int                 `json:"safety_stock"`
+	ReorderLevel   int                 `json:"reorder_level"`
+	TargetLevel    int                 `json:"target_level"`
+	SuggestedQty   int                 `json:"suggested_qty"`
+	SupplierID     *primitive.ObjectID `json:"supplier_id,omitempty"` // cheapest active supplier
+	UnitPrice      float64             `json:"unit_price,omitempty"`
+	WarehouseID    *primitive.ObjectID `json:"warehouse_id,omitempty"`
+}
+
+type ReorderOptions struct {
+	WindowDays int // history averaged over
+	CoverDays  int
+}
+
+// ReorderSuggestions works out what every active part needs, most urgent
+// first. Parts nobody supplies are still suggested, with lead time zero and
+// no supplier.
+func ReorderSuggestions(ctx context.Context, s Store, opt ReorderOptions, now time.Time) ([]ReorderSuggestion, error) {
+	demand, err := s.PartDemand(ctx, now.AddDate(0, 0, -opt.WindowDays))
+	if err != nil {
+		return nil, err
+	}
+	onOrder, err := s.OnOrderByPart(ctx)
+	if err != nil {
+		return nil, err
+	}
+	parts, err := s.ListPartsFiltered(ctx, PartFilter{})
+	if err != nil {
+		return nil, err
+	}
+	cats, err := s.ListCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	catByID := make(map[primitive.ObjectID]models.Category, len(cats))
+	for _, c := range cats {
+		catByID[c.ID] = c
+	}
+	all, err := s.ListSuppliers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var suppliers []models.Supplier
+	for _, sup := range all {
+		if sup.IsActive {
+			suppliers = append(suppliers, sup)
+		}
+	}
+	whs, err := s.ListWarehouses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	activeWarehouse := map[primitive.ObjectID]bool{}
+	for _, w := range whs {
+		activeWarehouse[w.ID] = w.IsActive
+	}
+
+	out := make([]ReorderSuggestion, 0)
+	for _, p := range parts {
+		_, safety := p.StockThresholds.Resolve(catByID[p.CategoryID].StockThresholds)
+		sg := ReorderSuggestion{
+			PartID:         p.ID,
+			Name:           p.Brand + " " + p.CarModel,
+			Available:      p.Available(),
+			OnOrder:        onOrder[p.ID],
+			Demand:         demand[p.ID],
+			AvgDailyDemand: float64(demand[p.ID]) / float64(opt.WindowDays),
+			SafetyStock:    safety,
+		}
+		sg.Position = sg.Available + sg.OnOrder
+		sup, price, supplied := cheapestSupplier(suppliers, p.ID)
+		if supplied {
+			sg.SupplierID, sg.UnitPrice = &sup.ID, price
+			sg.LeadTimeDays = sup.LeadTimeDays
+		}
+		sg.ReorderLevel = int(math.Ceil(sg.AvgDailyDemand*float64(sg.LeadTimeDays))) + safety
+		sg.TargetLevel = int(math.Ceil(sg.AvgDailyDemand*float64(sg.LeadTimeDays+opt.CoverDays))) + safety
+		if sg.Position > sg.ReorderLevel || sg.TargetLevel <= sg.Position {
+			continue
+		}
+		sg.SuggestedQty = sg.TargetLevel - sg.Position
+		if supplied {
+			sg.SuggestedQty = sup.OrderQuantity(p.ID, sg.SuggestedQty)
+		}
+		if sg.AvgDailyDemand > 0 {
+			days := math.Round(float64(sg.Position)/sg.AvgDailyDemand*10) / 10
+			sg.DaysOfCover = &days
+		}
+		levels, err := s.PartInventory(ctx, p.ID)
+		if err != nil {
+			return nil, err
+		}
+		sg.WarehouseID = neediestWarehouse(levels, activeWarehouse)
+		out = append(out, sg)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i].DaysOfCover, out[j].DaysOfCover
+		switch {
+		case a != nil && b != nil && *a != *b:
+			return *a < *b
+		case (a == nil) != (b == nil):
+			return a != nil
+		}
+		return out[i].Position-out[i].ReorderLevel < out[j].Position-out[j].ReorderLevel
+	})
+	return out, nil
+}
+
+// neediestWarehouse picks the active warehouse with the least to promise,
+// or nil when the part is stocked in none.
+func neediestWarehouse(levels []models.InventoryLevel, active map[primitive.ObjectID]bool) *primitive.ObjectID {
+	var best *models.InventoryLevel
+	for i := range levels {
+		l := &levels[i]
+		if !active[l.WarehouseID] {
+			continue
+		}
+		if best == nil || l.Available() < best.Available() ||
+			l.Available() == best.Available() && idLess(l.WarehouseID, best.WarehouseID) {
+			best = l
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	id := best.WarehouseID
+	return &id
+}
+
+// DraftReorderPurchaseOrders turns the suggestions that have a supplier into
+// draft purchase orders, one per supplier and destination warehouse. Lines
+// are linked to the part's current low-stock alert, if any, so receiving
+// them resolves it.
+func DraftReorderPurchaseOrders(ctx context.Context, s Store, suggestions []ReorderSuggestion, actor string, now time.Time) ([]models.PurchaseOrder, error) {
+	alertByPart := map[primitive.ObjectID]primitive.ObjectID{}
+	for _, status := range []string{models.AlertOpen, models.AlertAcknowledged} {
+		alerts, err := s.ListAlerts(ctx, status, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range alerts {
+			alertByPart[a.PartID] = a.ID
+		}
+	}
+
+	type draftKey struct {
+		supplier, warehouse primitive.ObjectID // NilObjectID for no warehouse
+	}
+	drafts := map[draftKey]*models.PurchaseOrder{}
+	var order []draftKey
+	for _, sg := range suggestions {
+		if sg.SupplierID == nil {
+			continue
+		}
+		k := draftKey{supplier: *sg.SupplierID}
+		if sg.WarehouseID != nil {
+			k.warehouse = *sg.WarehouseID
+		}
+		po := drafts[k]
+		if po == nil {
+			po = &models.PurchaseOrder{
+				SupplierID:  *sg.SupplierID,
+				WarehouseID: sg.WarehouseID,
+				Status:      models.PurchaseDraft,
+				Note:        "generated from reorder suggestions",
+				CreatedBy:   actor,
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}
+			drafts[k] = po
+			order = append(order, k)
+		}
+		line := models.PurchaseOrderLine{PartID: sg.PartID, Quantity: sg.SuggestedQty, UnitPrice: sg.UnitPrice}
+		if id, ok := alertByPart[sg.PartID]; ok {
+			line.AlertID = &id
+		}
+		po.Lines = append(po.Lines, line)
+	}
+
+	out := make([]models.PurchaseOrder, 0, len(order))
+	for _, k := range order {
+		po, err := s.CreatePurchaseOrder(ctx, *drafts[k])
+		if err != nil {
+			return out, err
+		}
+		out = append(out, po)
+	}
+	return out, nil
+}
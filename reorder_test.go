@@ -0,0 +1,105 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDraftReorderPurchaseOrdersPicksWarehouse(t *testing.T) {
+	m := NewMemoryRepo()
+	ctx := context.Background()
+	c, _ := m.CreateCategory(ctx, models.Category{Name: "Filters"})
+	safety := 10
+	p, err := m.CreatePart(ctx, models.SparePart{CategoryID: c.ID, Brand: "Mann", Price: 5, IsActive: true,
+		StockThresholds: models.StockThresholds{SafetyStock: &safety}})
+	if err != nil {
+		t.Fatalf("create part: %v", err)
+	}
+	loose, err := m.CreatePart(ctx, models.SparePart{CategoryID: c.ID, Brand: "Bosch", Price: 5, Stock: 1, IsActive: true,
+		StockThresholds: models.StockThresholds{SafetyStock: &safety}})
+	if err != nil {
+		t.Fatalf("create part: %v", err)
+	}
+	full, _ := m.CreateWarehouse(ctx, models.Warehouse{Name: "Main", City: "Almaty", IsActive: true})
+	short, _ := m.CreateWarehouse(ctx, models.Warehouse{Name: "North", City: "Astana", IsActive: true})
+	closed, _ := m.CreateWarehouse(ctx, models.Warehouse{Name: "Old", City: "Almaty", IsActive: false})
+	for wh, qty := range map[*models.Warehouse]int{&full: 5, &short: 1, &closed: 0} {
+		if _, err := m.SetStock(ctx, wh.ID, p.ID, qty); err != nil {
+			t.Fatalf("set stock: %v", err)
+		}
+	}
+	if _, err := m.CreateSupplier(ctx, models.Supplier{Name: "Acme", IsActive: true, Prices: []models.SupplierPrice{
+		{PartID: p.ID, Price: 3}, {PartID: loose.ID, Price: 3},
+	}}); err != nil {
+		t.Fatalf("create supplier: %v", err)
+	}
+
+	now := time.Now()
+	sgs, err := ReorderSuggestions(ctx, m, ReorderOptions{WindowDays: 30, CoverDays: 14}, now)
+	if err != nil {
+		t.Fatalf("suggestions: %v", err)
+	}
+	pos, err := DraftReorderPurchaseOrders(ctx, m, sgs, models.ActorSystem, now)
+	if err != nil {
+		t.Fatalf("draft: %v", err)
+	}
+	if len(pos) != 2 {
+		t.Fatalf("drafted %d purchase orders, want one per destination", len(pos))
+	}
+	for _, po := range pos {
+		if len(po.Lines) != 1 {
+			t.Fatalf("purchase order %+v, want one line", po)
+		}
+		switch po.Lines[0].PartID {
+		case p.ID:
+			if po.WarehouseID == nil || *po.WarehouseID != short.ID {
+				t.Errorf("warehouse-stocked part goes to %v, want %s", po.WarehouseID, short.ID.Hex())
+			}
+		case loose.ID:
+			if po.WarehouseID != nil {
+				t.Errorf("part without levels goes to warehouse %s", po.WarehouseID.Hex())
+			}
+		}
+	}
+}
+
+func TestMemoryPartDemandLeavesOutCanceledAndRefunded(t *testing.T) {
+	m := NewMemoryRepo()
+	ctx := context.Background()
+	stocked, _ := placeOrderFixture(t, m)
+	since := time.Now().Add(-time.Minute)
+
+	// each order takes one item and ends in the given status
+	for _, path := range [][]string{
+		{},
+		{models.StatusPaid},
+		{models.StatusCanceled},
+		{models.StatusPaid, models.StatusRefunded},
+	} {
+		o, err := m.PlaceOrder(ctx, models.Order{
+			CustomerID: primitive.NewObjectID(),
+			Status:     models.StatusCreated,
+			Items:      []models.OrderItem{{PartID: stocked, Quantity: 1}},
+			CreatedAt:  time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("PlaceOrder: %v", err)
+		}
+		for _, st := range path {
+			if _, err := m.UpdateOrderStatus(ctx, o.ID, st, "test"); err != nil {
+				t.Fatalf("to %s: %v", st, err)
+			}
+		}
+	}
+	demand, err := m.PartDemand(ctx, since)
+	if err != nil {
+		t.Fatalf("PartDemand: %v", err)
+	}
+	if demand[stocked] != 2 {
+		t.Errorf("demand = %d, want 2 from the unpaid and the paid order", demand[stocked])
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"carparts/models"
 	"context"
 	"errors"
+	"fmt"
+	"log"
 	"regexp"
 	"time"
 
@@ -13,23 +15,220 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var (
+	ErrNotEnoughStock = errors.New("not enough stock or part not found")
+	ErrDuplicate      = errors.New("already exists")
+	// ErrInvalidTransition is wrapped with the attempted "from X to Y".
+	ErrInvalidTransition = errors.New("illegal status transition")
+	ErrConflict          = errors.New("concurrent update, try again")
+)
+
 type Repo struct {
-	categories *mongo.Collection
-	parts      *mongo.Collection
-	orders     *mongo.Collection
-	alerts     *mongo.Collection
+	db             *mongo.Database
+	categories     *mongo.Collection
+	parts          *mongo.Collection
+	orders         *mongo.Collection
+	alerts         *mongo.Collection
+	customers      *mongo.Collection
+	sessions       *mongo.Collection
+	warehouses     *mongo.Collection
+	inventory      *mongo.Collection
+	transfers      *mongo.Collection
+	reservations   *mongo.Collection
+	carts          *mongo.Collection
+	outbox         *mongo.Collection
+	deadLetters    *mongo.Collection
+	webhooks       *mongo.Collection
+	deliveries     *mongo.Collection
+	suppliers      *mongo.Collection
+	purchaseOrders *mongo.Collection
+	vehicles       *mongo.Collection
+	fitments       *mongo.Collection
+	crossRefs      *mongo.Collection
+	searchTerms    *mongo.Collection
 
-	lowStockCh chan models.LowStockAlert
+	suggest   *SuggestIndex
+	vocab     vocabCache
+	outboxCh  chan struct{}
+	webhookCh chan struct{}
 }
 
 func NewRepo(db *mongo.Database) *Repo {
 	return &Repo{
-		categories: db.Collection("categories"),
-		parts:      db.Collection("spare_parts"),
-		orders:     db.Collection("orders"),
-		alerts:     db.Collection("alerts"),
-		lowStockCh: make(chan models.LowStockAlert, 100),
+		db:             db,
+		categories:     db.Collection("categories"),
+		parts:          db.Collection("spare_parts"),
+		orders:         db.Collection("orders"),
+		alerts:         db.Collection("alerts"),
+		customers:      db.Collection("customers"),
+		sessions:       db.Collection("sessions"),
+		warehouses:     db.Collection("warehouses"),
+		inventory:      db.Collection("inventory"),
+		transfers:      db.Collection("stock_transfers"),
+		reservations:   db.Collection("reservations"),
+		carts:          db.Collection("carts"),
+		outbox:         db.Collection("outbox"),
+		deadLetters:    db.Collection("outbox_dead_letters"),
+		webhooks:       db.Collection("webhooks"),
+		deliveries:     db.Collection("webhook_deliveries"),
+		suppliers:      db.Collection("suppliers"),
+		purchaseOrders: db.Collection("purchase_orders"),
+		vehicles:       db.Collection("vehicles"),
+		fitments:       db.Collection("fitments"),
+		crossRefs:      db.Collection("cross_references"),
+		searchTerms:    db.Collection("search_terms"),
+		suggest:        NewSuggestIndex(),
+		outboxCh:       make(chan struct{}, 1),
+		webhookCh:      make(chan struct{}, 1),
+	}
+}
+
+// EnsureIndexes creates the indexes the repo relies on for uniqueness and
+// for its hot queries.
+func (r *Repo) EnsureIndexes(ctx context.Context) error {
+	_, err := r.customers.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{
+			Keys: bson.D{{Key: "phone", Value: 1}},
+			// phone is optional; only non-empty numbers have to be unique
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"phone": bson.M{"$gt": ""}}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.orders.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "customer_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.inventory.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "warehouse_id", Value: 1}, {Key: "part_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "part_id", Value: 1}, {Key: "quantity", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.transfers.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.reservations.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "order_id", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.carts.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "customer_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"customer_id": bson.M{"$exists": true}}),
+		},
+		{
+			Keys:    bson.D{{Key: "session_hash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"session_hash": bson.M{"$exists": true}}),
+		},
+		{
+			// anonymous carts are dropped after a month without changes
+			Keys: bson.D{{Key: "updated_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32((30 * 24 * time.Hour).Seconds())).
+				SetPartialFilterExpression(bson.M{"session_hash": bson.M{"$exists": true}}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.alerts.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			// at most one live alert per part
+			Keys:    bson.D{{Key: "part_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"current": true}),
+		},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "at", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.outbox.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "next_attempt_at", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.deadLetters.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "dead_at", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.deliveries.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			// an event reaches each subscription once, however often it is fanned out
+			Keys:    bson.D{{Key: "subscription_id", Value: 1}, {Key: "event_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "subscription_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.purchaseOrders.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "supplier_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.vehicles.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "make_key", Value: 1}, {Key: "model_key", Value: 1}, {Key: "year_from", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.fitments.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "part_id", Value: 1}, {Key: "vehicle_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "vehicle_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.parts.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "number_keys", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.parts.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "search_terms", Value: 1}}},
+		{Keys: bson.D{{Key: "brand_terms", Value: 1}}},
+		{Keys: bson.D{{Key: "model_terms", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.searchTerms.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "parts", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.crossRefs.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "number_keys", Value: 1}},
+	})
+	if err != nil {
+		return err
 	}
+	_, err = r.sessions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
 }
 
 // -------- categories --------
@@ -39,6 +238,7 @@ func (r *Repo) CreateCategory(ctx context.Context, c models.Category) (models.Ca
 		return models.Category{}, err
 	}
 	c.ID = res.InsertedID.(primitive.ObjectID)
+	r.suggest.SetCategory(c)
 	return c, nil
 }
 
@@ -81,21 +281,90 @@ func (r *Repo) UpdateCategory(ctx context.Context, id primitive.ObjectID, name,
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 	var out models.Category
 	err := r.categories.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": upd}, opts).Decode(&out)
+	if err == nil {
+		r.suggest.SetCategory(out)
+	}
+	return out, err
+}
+
+// SetCategoryThresholds replaces the category's default thresholds; nil
+// fields fall back to the global defaults.
+func (r *Repo) SetCategoryThresholds(ctx context.Context, id primitive.ObjectID, t models.StockThresholds) (models.Category, error) {
+	set, unset := bson.M{}, bson.M{}
+	for field, v := range map[string]*int{"reorder_point": t.ReorderPoint, "safety_stock": t.SafetyStock} {
+		if v != nil {
+			set[field] = *v
+		} else {
+			unset[field] = ""
+		}
+	}
+	upd := bson.M{}
+	if len(set) > 0 {
+		upd["$set"] = set
+	}
+	if len(unset) > 0 {
+		upd["$unset"] = unset
+	}
+
+	var out models.Category
+	err := r.atomically(ctx, func(ctx context.Context, s *txScope) error {
+		var before models.Category
+		if err := r.categories.FindOneAndUpdate(ctx, bson.M{"_id": id}, upd).Decode(&before); err != nil {
+			return err
+		}
+		s.Compensate(func(ctx context.Context) error {
+			_, err := r.categories.ReplaceOne(ctx, bson.M{"_id": id}, before)
+			return err
+		})
+
+		vals, err := r.parts.Distinct(ctx, "_id", bson.M{"category_id": id})
+		if err != nil {
+			return err
+		}
+		ids := make([]primitive.ObjectID, 0, len(vals))
+		for _, v := range vals {
+			if pid, ok := v.(primitive.ObjectID); ok {
+				ids = append(ids, pid)
+			}
+		}
+		if err := r.stockChanged(ctx, s, ids...); err != nil {
+			return err
+		}
+		return r.categories.FindOne(ctx, bson.M{"_id": id}).Decode(&out)
+	})
 	return out, err
 }
 
 func (r *Repo) DeleteCategory(ctx context.Context, id primitive.ObjectID) error {
-	_, err := r.categories.DeleteOne(ctx, bson.M{"_id": id})
-	return err
+	if _, err := r.categories.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return err
+	}
+	r.suggest.RemoveCategory(id)
+	return nil
 }
 
 // -------- parts --------
 func (r *Repo) CreatePart(ctx context.Context, p models.SparePart) (models.SparePart, error) {
-	res, err := r.parts.InsertOne(ctx, p)
+	p.ID = primitive.NewObjectID()
+	p.SetNumberKeys()
+	indexPart(&p)
+	err := r.atomically(ctx, func(ctx context.Context, s *txScope) error {
+		if _, err := r.parts.InsertOne(ctx, p); err != nil {
+			return err
+		}
+		s.Compensate(func(ctx context.Context) error {
+			_, err := r.parts.DeleteOne(ctx, bson.M{"_id": p.ID})
+			return err
+		})
+		if err := r.recountSearchTerms(ctx, s, models.SparePart{}, p); err != nil {
+			return err
+		}
+		return r.stockChanged(ctx, s, p.ID) // it may start out low
+	})
 	if err != nil {
 		return models.SparePart{}, err
 	}
-	p.ID = res.InsertedID.(primitive.ObjectID)
+	r.suggest.SetPart(p)
 
 	// optional: push part to category parts_list
 	_, _ = r.categories.UpdateOne(ctx, bson.M{"_id": p.CategoryID}, bson.M{"$addToSet": bson.M{"parts_list": p.ID}})
@@ -109,42 +378,218 @@ func (r *Repo) GetPart(ctx context.Context, id primitive.ObjectID) (models.Spare
 }
 
 func (r *Repo) DeletePart(ctx context.Context, id primitive.ObjectID) error {
-	_, err := r.parts.DeleteOne(ctx, bson.M{"_id": id})
-	return err
+	err := r.atomically(ctx, func(ctx context.Context, s *txScope) error {
+		var before models.SparePart
+		err := r.parts.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&before)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.Compensate(func(ctx context.Context) error {
+			_, err := r.parts.InsertOne(ctx, before)
+			return err
+		})
+		if err := r.recountSearchTerms(ctx, s, before, models.SparePart{}); err != nil {
+			return err
+		}
+		if err := r.dropFitments(ctx, s, bson.M{"part_id": id}); err != nil {
+			return err
+		}
+		return r.stockChanged(ctx, s, id) // resolves its alert
+	})
+	if err != nil {
+		return err
+	}
+	r.suggest.RemovePart(id)
+	return nil
 }
 
 func (r *Repo) UpdatePart(ctx context.Context, id primitive.ObjectID, upd bson.M) (models.SparePart, error) {
 	if len(upd) == 0 {
 		return models.SparePart{}, errors.New("nothing to update")
 	}
-	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 	var out models.SparePart
-	err := r.parts.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": upd}, opts).Decode(&out)
+	err := r.atomically(ctx, func(ctx context.Context, s *txScope) error {
+		var before models.SparePart
+		if err := r.parts.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": upd}).Decode(&before); err != nil {
+			return err
+		}
+		s.Compensate(func(ctx context.Context) error {
+			_, err := r.parts.ReplaceOne(ctx, bson.M{"_id": id}, before)
+			return err
+		})
+		// stock, thresholds or is_active may have moved
+		if err := r.stockChanged(ctx, s, id); err != nil {
+			return err
+		}
+		if err := r.parts.FindOne(ctx, bson.M{"_id": id}).Decode(&out); err != nil {
+			return err
+		}
+		if err := r.reindexPart(ctx, &out); err != nil {
+			return err
+		}
+		return r.recountSearchTerms(ctx, s, before, out)
+	})
+	if err == nil {
+		r.suggest.SetPart(out)
+	}
 	return out, err
 }
 
-func (r *Repo) ListPartsFiltered(ctx context.Context, categoryID *primitive.ObjectID, carModel, brand, q, compatibility string) ([]models.SparePart, error) {
+// reindexPart refreshes p's stored search terms if its text has changed.
+func (r *Repo) reindexPart(ctx context.Context, p *models.SparePart) error {
+	before := *p
+	indexPart(p)
+	if before.SearchVersion == p.SearchVersion && equalStrings(before.SearchTerms, p.SearchTerms) &&
+		equalStrings(before.BrandTerms, p.BrandTerms) && equalStrings(before.ModelTerms, p.ModelTerms) {
+		return nil
+	}
+	_, err := r.parts.UpdateOne(ctx, bson.M{"_id": p.ID}, bson.M{"$set": bson.M{
+		"search_terms":   p.SearchTerms,
+		"brand_terms":    p.BrandTerms,
+		"model_terms":    p.ModelTerms,
+		"search_version": p.SearchVersion,
+	}})
+	return err
+}
+
+// LoadSuggestions builds the search-box index from the catalog. The part
+// and category writes keep it current from then on.
+func (r *Repo) LoadSuggestions(ctx context.Context) error {
+	return loadSuggestions(ctx, r, r.suggest)
+}
+
+func (r *Repo) Suggest(prefix string, limit int) []Suggestion {
+	return r.suggest.Suggest(prefix, limit)
+}
+
+// ReindexParts brings the search terms of parts indexed by an older
+// analyzer, or none at all, up to date, and their counts in search_terms
+// with them.
+func (r *Repo) ReindexParts(ctx context.Context) error {
+	if err := r.countSearchTerms(ctx); err != nil {
+		return err
+	}
+	cur, err := r.parts.Find(ctx, bson.M{"search_version": bson.M{"$ne": searchVersion}})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	n := 0
+	for cur.Next(ctx) {
+		var p models.SparePart
+		if err := cur.Decode(&p); err != nil {
+			return err
+		}
+		err := r.atomically(ctx, func(ctx context.Context, s *txScope) error {
+			before := p
+			if err := r.reindexPart(ctx, &p); err != nil {
+				return err
+			}
+			return r.recountSearchTerms(ctx, s, before, p)
+		})
+		if err != nil {
+			return err
+		}
+		n++
+	}
+	if n > 0 {
+		log.Printf("search: reindexed %d parts", n)
+	}
+	return cur.Err()
+}
+
+// partSearch builds the query for the parts f matches. It checks q, brand
+// and car_model as the returned matcher does, so the indexed term arrays
+// narrow the parts down and nothing is left to check in Go.
+func (r *Repo) partSearch(ctx context.Context, f PartFilter) (bson.M, partMatcher, error) {
+	f = searchable(f)
 	filter := bson.M{"is_active": true}
 
-	if categoryID != nil {
-		filter["category_id"] = *categoryID
+	if f.CategoryID != nil {
+		filter["category_id"] = *f.CategoryID
+	}
+	if f.IDs != nil {
+		filter["_id"] = bson.M{"$in": f.IDs}
+	}
+	if f.NumberKeys != nil {
+		filter["number_keys"] = bson.M{"$in": f.NumberKeys}
+	}
+	if f.Compatibility != "" {
+		filter["compatibility"] = bson.M{"$regex": regexp.QuoteMeta(f.Compatibility), "$options": "i"}
+	}
+	if f.IsNew != nil {
+		filter["is_new"] = *f.IsNew
+	}
+	if f.InStock != nil {
+		if *f.InStock {
+			filter["$expr"] = availableAtLeast("stock", 1)
+		} else {
+			filter["$expr"] = bson.M{"$not": bson.A{availableAtLeast("stock", 1)}}
+		}
+	}
+	if f.MinPrice != nil || f.MaxPrice != nil {
+		price := bson.M{}
+		if f.MinPrice != nil {
+			price["$gte"] = *f.MinPrice
+		}
+		if f.MaxPrice != nil {
+			price["$lt"] = *f.MaxPrice
+		}
+		filter["price"] = price
+	}
+
+	var pm partMatcher
+	if f.Q == "" && f.Brand == "" && f.CarModel == "" {
+		return filter, pm, nil
 	}
-	if carModel != "" {
-		filter["car_model"] = bson.M{"$regex": regexp.QuoteMeta(carModel), "$options": "i"}
+	vocab, err := r.searchVocabulary(ctx)
+	if err != nil {
+		return nil, pm, err
 	}
-	if brand != "" {
-		filter["brand"] = bson.M{"$regex": regexp.QuoteMeta(brand), "$options": "i"}
+	pm = newPartMatcher(f, vocab)
+	var and []bson.M
+	if f.Q != "" {
+		var or []bson.M
+		if len(pm.q.Slots) > 0 {
+			or = append(or, slotsFilter("search_terms", pm.q.Slots))
+		}
+		if pm.q.Key != "" {
+			or = append(or, bson.M{"number_keys": pm.q.Key})
+		}
+		and = append(and, bson.M{"$or": or})
+	}
+	if f.Brand != "" {
+		and = append(and, slotsFilter("brand_terms", pm.brand))
 	}
-	if compatibility != "" {
-		filter["compatibility"] = bson.M{"$regex": regexp.QuoteMeta(compatibility), "$options": "i"}
+	if f.CarModel != "" {
+		and = append(and, slotsFilter("model_terms", pm.model))
 	}
-	if q != "" {
-		re := bson.M{"$regex": regexp.QuoteMeta(q), "$options": "i"}
-		filter["$or"] = []bson.M{
-			{"description": re},
-			{"brand": re},
-			{"car_model": re},
+	filter["$and"] = and
+	return filter, pm, nil
+}
+
+// slotsFilter matches the documents whose field has, for every slot, all
+// the terms of one of its alternatives, as slotsMatch does.
+func slotsFilter(field string, slots []querySlot) bson.M {
+	all := make(bson.A, 0, len(slots))
+	for _, s := range slots {
+		alts := make(bson.A, 0, len(s))
+		for _, a := range s {
+			alts = append(alts, bson.M{field: bson.M{"$all": a.Terms}})
 		}
+		all = append(all, bson.M{"$or": alts})
+	}
+	return bson.M{"$and": all}
+}
+
+func (r *Repo) ListPartsFiltered(ctx context.Context, f PartFilter) ([]models.SparePart, error) {
+	filter, pm, err := r.partSearch(ctx, f)
+	if err != nil {
+		return nil, err
 	}
 
 	cur, err := r.parts.Find(ctx, filter)
@@ -161,57 +606,239 @@ func (r *Repo) ListPartsFiltered(ctx context.Context, categoryID *primitive.Obje
 		}
 		out = append(out, p)
 	}
-	return out, nil
-}
-
-// DecreaseStock: atomic check + decrement
-func (r *Repo) DecreaseStock(ctx context.Context, partID primitive.ObjectID, qty int) (models.SparePart, error) {
-	if qty <= 0 {
-		return models.SparePart{}, errors.New("quantity must be > 0")
+	if err := cur.Err(); err != nil {
+		return nil, err
 	}
 
-	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
-	var updated models.SparePart
-
-	filter := bson.M{
-		"_id":       partID,
-		"is_active": true,
-		"stock":     bson.M{"$gte": qty},
+	if !pm.q.IsZero() {
+		df, total, err := r.termFrequencies(ctx, pm.q.Terms())
+		if err != nil {
+			return nil, err
+		}
+		rankParts(out, pm.q, df, total)
 	}
+	return out, nil
+}
 
-	err := r.parts.FindOneAndUpdate(
-		ctx,
-		filter,
-		bson.M{"$inc": bson.M{"stock": -qty}},
-		opts,
-	).Decode(&updated)
-
+func (r *Repo) PartFacets(ctx context.Context, f PartFilter) (models.PartFacets, error) {
+	out := models.NewPartFacets()
+	filter, _, err := r.partSearch(ctx, f)
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return models.SparePart{}, errors.New("not enough stock or part not found")
+		return out, err
+	}
+	byCount := bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}
+	countBy := func(field interface{}) bson.A {
+		return bson.A{
+			bson.M{"$group": bson.M{"_id": field, "count": bson.M{"$sum": 1}}},
+			bson.M{"$sort": byCount},
 		}
-		return models.SparePart{}, err
 	}
+	boundaries := bson.A{}
+	for _, b := range models.PriceBuckets {
+		boundaries = append(boundaries, b)
+	}
+	categories := append(countBy("$category_id"), bson.M{"$lookup": bson.M{
+		"from": r.categories.Name(), "localField": "_id", "foreignField": "_id", "as": "category",
+	}})
+	cur, err := r.parts.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$facet", Value: bson.M{
+			"total":     bson.A{bson.M{"$count": "count"}},
+			"brand":     countBy("$brand"),
+			"category":  categories,
+			"car_model": countBy("$car_model"),
+			"is_new":    countBy("$is_new"),
+			"in_stock":  countBy(availableAtLeast("stock", 1)),
+			"price": bson.A{bson.M{"$bucket": bson.M{
+				"groupBy":    "$price",
+				"boundaries": boundaries,
+				"default":    models.PriceBuckets[len(models.PriceBuckets)-1], // the open top bucket
+			}}},
+		}}},
+	})
+	if err != nil {
+		return out, err
+	}
+	defer cur.Close(ctx)
 
-	if updated.Stock <= 5 {
-		r.lowStockCh <- models.LowStockAlert{
-			PartID: updated.ID,
-			Name:   updated.Brand + " " + updated.CarModel,
-			Stock:  updated.Stock,
-			At:     time.Now(),
+	type stringCount struct {
+		Value string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	type boolCount struct {
+		Value bool `bson:"_id"`
+		Count int  `bson:"count"`
+	}
+	var rows []struct {
+		Total []struct {
+			Count int `bson:"count"`
+		} `bson:"total"`
+		Brand    []stringCount `bson:"brand"`
+		CarModel []stringCount `bson:"car_model"`
+		IsNew    []boolCount   `bson:"is_new"`
+		InStock  []boolCount   `bson:"in_stock"`
+		Price    []struct {
+			Value float64 `bson:"_id"`
+			Count int     `bson:"count"`
+		} `bson:"price"`
+		Category []struct {
+			Value    primitive.ObjectID `bson:"_id"`
+			Count    int                `bson:"count"`
+			Category []models.Category  `bson:"category"`
+		} `bson:"category"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return out, err
+	}
+	if len(rows) == 0 {
+		return out, nil
+	}
+	row := rows[0]
+	if len(row.Total) > 0 {
+		out.Total = row.Total[0].Count
+	}
+	for _, b := range row.Brand {
+		out.Brands = append(out.Brands, models.FacetCount{Value: b.Value, Count: b.Count})
+	}
+	for _, c := range row.Category {
+		fc := models.FacetCount{Value: c.Value.Hex(), Count: c.Count}
+		if len(c.Category) > 0 {
+			fc.Label = c.Category[0].Name
+		}
+		out.Categories = append(out.Categories, fc)
+	}
+	for _, m := range row.CarModel {
+		out.CarModels = append(out.CarModels, models.FacetCount{Value: m.Value, Count: m.Count})
+	}
+	for _, n := range row.IsNew {
+		if n.Value {
+			out.Condition.New = n.Count
+		} else {
+			out.Condition.Used = n.Count
+		}
+	}
+	for _, n := range row.InStock {
+		if n.Value {
+			out.Stock.InStock = n.Count
+		} else {
+			out.Stock.OutOfStock = n.Count
+		}
+	}
+	for _, p := range row.Price {
+		for i := range out.Price {
+			if out.Price[i].Min == p.Value {
+				out.Price[i].Count = p.Count
+			}
 		}
 	}
+	return out, nil
+}
 
-	return updated, nil
+func (r *Repo) increaseStock(ctx context.Context, partID primitive.ObjectID, qty int) error {
+	_, err := r.parts.UpdateOne(ctx, bson.M{"_id": partID}, bson.M{"$inc": bson.M{"stock": qty}})
+	return err
 }
 
 // -------- orders --------
-func (r *Repo) CreateOrder(ctx context.Context, o models.Order) (models.Order, error) {
-	res, err := r.orders.InsertOne(ctx, o)
+// PartDemand sums the quantities ordered per part since since, leaving out
+// canceled and refunded orders. Orders still waiting for payment count: their
+// items are held, so they are demand the stock already has to cover.
+func (r *Repo) PartDemand(ctx context.Context, since time.Time) (map[primitive.ObjectID]int, error) {
+	cur, err := r.orders.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"created_at": bson.M{"$gte": since},
+			"status":     bson.M{"$nin": bson.A{models.StatusCanceled, models.StatusRefunded}},
+		}}},
+		{{Key: "$unwind", Value: "$items"}},
+		{{Key: "$group", Value: bson.M{"_id": "$items.part_id", "quantity": bson.M{"$sum": "$items.quantity"}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var rows []struct {
+		PartID   primitive.ObjectID `bson:"_id"`
+		Quantity int                `bson:"quantity"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	out := make(map[primitive.ObjectID]int, len(rows))
+	for _, row := range rows {
+		out[row.PartID] = row.Quantity
+	}
+	return out, nil
+}
+
+// PlaceOrder reserves stock for every item and inserts the order as one unit:
+// either all holds and the insert are committed, or none of them are. The
+// items only leave stock when the order is paid; if that has not happened
+// by o.ReservedUntil (default now+reservationTTL) the order is canceled.
+// Item prices are taken from the parts at the moment of the reservation.
+func (r *Repo) PlaceOrder(ctx context.Context, o models.Order) (models.Order, error) {
+	if o.ID.IsZero() {
+		o.ID = primitive.NewObjectID()
+	}
+	if o.StatusHistory == nil {
+		// stored as [] rather than null so later $push calls work
+		o.StatusHistory = []models.StatusChange{}
+	}
+	if o.ReservedUntil == nil {
+		until := time.Now().Add(reservationTTL)
+		o.ReservedUntil = &until
+	}
+
+	// warehouses the caller asked for; reserveLine fills in the rest and a
+	// retried transaction has to start from the original request again
+	requested := make([]*primitive.ObjectID, len(o.Items))
+	for i, it := range o.Items {
+		requested[i] = it.WarehouseID
+	}
+
+	err := r.atomically(ctx, func(ctx context.Context, s *txScope) error {
+		holds := make([]any, 0, len(o.Items))
+		for i := range o.Items {
+			it := &o.Items[i]
+			it.WarehouseID = requested[i]
+			p, err := r.reserveLine(ctx, s, it)
+			if err != nil {
+				return err
+			}
+			it.OrderID = o.ID
+			it.Price = p.Price
+			holds = append(holds, models.Reservation{
+				ID:          primitive.NewObjectID(),
+				OrderID:     o.ID,
+				PartID:      it.PartID,
+				WarehouseID: it.WarehouseID,
+				Quantity:    it.Quantity,
+				Status:      models.ReservationActive,
+				ExpiresAt:   *o.ReservedUntil,
+				CreatedAt:   o.CreatedAt,
+			})
+		}
+		o.TotalPrice = o.CalculateTotal()
+
+		if _, err := r.reservations.InsertMany(ctx, holds); err != nil {
+			return err
+		}
+		s.Compensate(func(ctx context.Context) error {
+			_, err := r.reservations.DeleteMany(ctx, bson.M{"order_id": o.ID})
+			return err
+		})
+
+		if _, err := r.orders.InsertOne(ctx, o); err != nil {
+			return err
+		}
+		if err := r.stockChanged(ctx, s, o.PartIDs()...); err != nil {
+			return err
+		}
+		return r.orderChanged(ctx, s, models.TopicOrderCreated, o)
+	})
 	if err != nil {
 		return models.Order{}, err
 	}
-	o.ID = res.InsertedID.(primitive.ObjectID)
 	return o, nil
 }
 
@@ -221,41 +848,298 @@ func (r *Repo) GetOrder(ctx context.Context, id primitive.ObjectID) (models.Orde
 	return o, err
 }
 
-func (r *Repo) UpdateOrderStatus(ctx context.Context, id primitive.ObjectID, status string, isPaid bool) (models.Order, error) {
-	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
-	var out models.Order
-	err := r.orders.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"status": status, "is_paid": isPaid}}, opts).Decode(&out)
-	return out, err
+func (r *Repo) ListOrders(ctx context.Context, f OrderFilter, pr PageRequest) ([]models.Order, string, error) {
+	and := []bson.M{}
+	if f.CustomerID != nil {
+		and = append(and, bson.M{"customer_id": *f.CustomerID})
+	}
+	if f.Status != "" {
+		and = append(and, bson.M{"status": f.Status})
+	}
+	if f.IsPaid != nil {
+		and = append(and, bson.M{"is_paid": *f.IsPaid})
+	}
+	if !f.From.IsZero() {
+		and = append(and, bson.M{"created_at": bson.M{"$gte": f.From}})
+	}
+	if !f.To.IsZero() {
+		and = append(and, bson.M{"created_at": bson.M{"$lt": f.To}})
+	}
+
+	dir, cmp := -1, "$lt"
+	if pr.Asc {
+		dir, cmp = 1, "$gt"
+	}
+	if c := pr.After; c != nil {
+		and = append(and, bson.M{"$or": []bson.M{
+			{"created_at": bson.M{cmp: c.CreatedAt}},
+			{"created_at": c.CreatedAt, "_id": bson.M{cmp: c.ID}},
+		}})
+	}
+	filter := bson.M{}
+	if len(and) > 0 {
+		filter["$and"] = and
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: dir}, {Key: "_id", Value: dir}}).
+		SetLimit(int64(pr.Limit) + 1)
+	cur, err := r.orders.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cur.Close(ctx)
+
+	out := make([]models.Order, 0)
+	for cur.Next(ctx) {
+		var o models.Order
+		if err := cur.Decode(&o); err != nil {
+			return nil, "", err
+		}
+		out = append(out, o)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, "", err
+	}
+	out, next := trimPage(out, pr.Limit)
+	return out, next, nil
+}
+
+// UpdateOrderStatus moves an order along the lifecycle in models.Order and
+// appends the change to its status history. The write is conditional on the
+// status it was validated against, so two concurrent transitions cannot both
+// apply; the loser re-validates against the new status. Paying commits the
+// order's holds, and refunding it before it ships restocks its items.
+func (r *Repo) UpdateOrderStatus(ctx context.Context, id primitive.ObjectID, status, actor string) (models.Order, error) {
+	if status == models.StatusCanceled {
+		return r.CancelOrder(ctx, id, actor)
+	}
+	for attempt := 0; attempt < 3; attempt++ {
+		o, err := r.GetOrder(ctx, id)
+		if err != nil {
+			return models.Order{}, err
+		}
+		from, wasPaid := o.Status, o.IsPaid
+		if !o.UpdateStatus(status, actor, time.Now()) {
+			return models.Order{}, fmt.Errorf("%w from %s to %s", ErrInvalidTransition, from, status)
+		}
+		change := o.StatusHistory[len(o.StatusHistory)-1]
+
+		var out models.Order
+		err = r.atomically(ctx, func(ctx context.Context, s *txScope) error {
+			opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+			err := r.orders.FindOneAndUpdate(ctx,
+				bson.M{"_id": id, "status": from},
+				bson.M{
+					"$set":  bson.M{"status": o.Status, "is_paid": o.IsPaid},
+					"$push": bson.M{"status_history": change},
+				},
+				opts,
+			).Decode(&out)
+			if err != nil {
+				return err
+			}
+			s.Compensate(func(ctx context.Context) error {
+				_, err := r.orders.UpdateOne(ctx, bson.M{"_id": id},
+					bson.M{"$set": bson.M{"status": from, "is_paid": wasPaid}, "$pop": bson.M{"status_history": 1}})
+				return err
+			})
+			switch {
+			case status == models.StatusPaid:
+				// paid: the held items now leave stock for good
+				if err := r.settleHolds(ctx, s, id, models.ReservationCommitted); err != nil {
+					return err
+				}
+			case status == models.StatusRefunded && from != models.StatusDelivered:
+				// refunded before it shipped: the items are still on the shelf
+				if err := r.restockOrder(ctx, s, from, out); err != nil {
+					return err
+				}
+			}
+			return r.orderChanged(ctx, s, models.TopicOrderStatusChanged, out)
+		})
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		return out, err
+	}
+	return models.Order{}, ErrConflict
 }
 
-func (r *Repo) CancelOrder(ctx context.Context, id primitive.ObjectID) (models.Order, error) {
-	return r.UpdateOrderStatus(ctx, id, "canceled", false)
+// CancelOrder cancels the order and, in the same unit, releases its holds or,
+// once paid, returns every item's quantity to stock. Canceling an already
+// canceled order is a no-op, and orders that have shipped can no longer be
+// canceled.
+func (r *Repo) CancelOrder(ctx context.Context, id primitive.ObjectID, actor string) (models.Order, error) {
+	o, err := r.GetOrder(ctx, id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if o.Status == models.StatusCanceled {
+		return o, nil
+	}
+	from := o.Status
+	if !o.UpdateStatus(models.StatusCanceled, actor, time.Now()) {
+		return models.Order{}, fmt.Errorf("%w from %s to %s", ErrInvalidTransition, from, models.StatusCanceled)
+	}
+	change := o.StatusHistory[len(o.StatusHistory)-1]
+
+	var out models.Order
+	err = r.atomically(ctx, func(ctx context.Context, s *txScope) error {
+		// the status guard makes the restore happen at most once: a second
+		// cancel (or any concurrent transition) no longer matches
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		err := r.orders.FindOneAndUpdate(ctx,
+			bson.M{"_id": id, "status": from},
+			bson.M{
+				"$set":  bson.M{"status": models.StatusCanceled},
+				"$push": bson.M{"status_history": change},
+			},
+			opts,
+		).Decode(&out)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return ErrConflict
+			}
+			return err
+		}
+		s.Compensate(func(ctx context.Context) error {
+			_, err := r.orders.UpdateOne(ctx, bson.M{"_id": id},
+				bson.M{"$set": bson.M{"status": from}, "$pop": bson.M{"status_history": 1}})
+			return err
+		})
+
+		if err := r.restockOrder(ctx, s, from, out); err != nil {
+			return err
+		}
+		return r.orderChanged(ctx, s, models.TopicOrderStatusChanged, out)
+	})
+	if errors.Is(err, ErrConflict) {
+		// lost a race; if the winner canceled, report the canceled order
+		if cur, gerr := r.GetOrder(ctx, id); gerr == nil && cur.Status == models.StatusCanceled {
+			return cur, nil
+		}
+	}
+	if err != nil {
+		return models.Order{}, err
+	}
+	return out, nil
 }
 
-// -------- alerts --------
-func (r *Repo) InsertAlert(ctx context.Context, a models.LowStockAlert) error {
-	_, err := r.alerts.InsertOne(ctx, a)
-	return err
+// restockOrder gives back what the order took from stock, for an order
+// leaving status from without shipping. An order never paid only held its
+// items, so its holds are released; once paid they were committed, and each
+// line goes back to the part and the warehouse it was taken from.
+func (r *Repo) restockOrder(ctx context.Context, s *txScope, from string, o models.Order) error {
+	if err := r.settleHolds(ctx, s, o.ID, models.ReservationReleased); err != nil {
+		return err
+	}
+	if from != models.StatusCreated || o.ReservedUntil == nil {
+		for _, it := range o.Items {
+			if err := r.returnLine(ctx, s, it); err != nil {
+				return err
+			}
+		}
+	}
+	return r.stockChanged(ctx, s, o.PartIDs()...)
 }
 
-func (r *Repo) ListAlerts(ctx context.Context, limit int64) ([]models.LowStockAlert, error) {
-	opts := options.Find().SetSort(bson.M{"at": -1})
-	if limit > 0 {
-		opts.SetLimit(limit)
+// -------- customers --------
+func (r *Repo) CreateCustomer(ctx context.Context, c models.Customer) (models.Customer, error) {
+	res, err := r.customers.InsertOne(ctx, c)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return models.Customer{}, ErrDuplicate
+		}
+		return models.Customer{}, err
 	}
-	cur, err := r.alerts.Find(ctx, bson.M{}, opts)
+	c.ID = res.InsertedID.(primitive.ObjectID)
+	return c, nil
+}
+
+func (r *Repo) GetCustomer(ctx context.Context, id primitive.ObjectID) (models.Customer, error) {
+	var c models.Customer
+	err := r.customers.FindOne(ctx, bson.M{"_id": id}).Decode(&c)
+	return c, err
+}
+
+func (r *Repo) GetCustomerByEmail(ctx context.Context, email string) (models.Customer, error) {
+	var c models.Customer
+	err := r.customers.FindOne(ctx, bson.M{"email": email}).Decode(&c)
+	return c, err
+}
+
+func (r *Repo) ListCustomers(ctx context.Context) ([]models.Customer, error) {
+	cur, err := r.customers.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
 	if err != nil {
 		return nil, err
 	}
 	defer cur.Close(ctx)
 
-	out := make([]models.LowStockAlert, 0)
+	out := make([]models.Customer, 0)
 	for cur.Next(ctx) {
-		var a models.LowStockAlert
-		if err := cur.Decode(&a); err != nil {
+		var c models.Customer
+		if err := cur.Decode(&c); err != nil {
 			return nil, err
 		}
-		out = append(out, a)
+		out = append(out, c)
 	}
 	return out, nil
 }
+
+func (r *Repo) UpdateCustomer(ctx context.Context, id primitive.ObjectID, upd bson.M) (models.Customer, error) {
+	if len(upd) == 0 {
+		return models.Customer{}, errors.New("nothing to update")
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var out models.Customer
+	err := r.customers.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": upd}, opts).Decode(&out)
+	if mongo.IsDuplicateKeyError(err) {
+		return models.Customer{}, ErrDuplicate
+	}
+	return out, err
+}
+
+func (r *Repo) DeleteCustomer(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.customers.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// -------- sessions --------
+func (r *Repo) CreateSession(ctx context.Context, s models.Session) (models.Session, error) {
+	if s.ID.IsZero() {
+		s.ID = primitive.NewObjectID()
+	}
+	if _, err := r.sessions.InsertOne(ctx, s); err != nil {
+		return models.Session{}, err
+	}
+	return s, nil
+}
+
+func (r *Repo) GetSession(ctx context.Context, id primitive.ObjectID) (models.Session, error) {
+	var s models.Session
+	err := r.sessions.FindOne(ctx, bson.M{"_id": id}).Decode(&s)
+	return s, err
+}
+
+func (r *Repo) RotateSession(ctx context.Context, id primitive.ObjectID, oldHash, newHash string, expiresAt time.Time) error {
+	res, err := r.sessions.UpdateOne(ctx,
+		bson.M{"_id": id, "refresh_hash": oldHash, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"refresh_hash": newHash, "expires_at": expiresAt}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *Repo) RevokeSession(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.sessions.UpdateOne(ctx,
+		bson.M{"_id": id, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
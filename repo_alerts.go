@@ -0,0 +1,172 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// -------- alerts --------
+func (r *Repo) ListAlerts(ctx context.Context, status string, limit int64) ([]models.LowStockAlert, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().SetSort(bson.M{"at": -1})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cur, err := r.alerts.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := make([]models.LowStockAlert, 0)
+	for cur.Next(ctx) {
+		var a models.LowStockAlert
+		if err := cur.Decode(&a); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+func (r *Repo) GetAlert(ctx context.Context, id primitive.ObjectID) (models.LowStockAlert, error) {
+	var a models.LowStockAlert
+	err := r.alerts.FindOne(ctx, bson.M{"_id": id}).Decode(&a)
+	return a, err
+}
+
+func (r *Repo) CurrentAlert(ctx context.Context, partID primitive.ObjectID) (models.LowStockAlert, error) {
+	var a models.LowStockAlert
+	err := r.alerts.FindOne(ctx, bson.M{"part_id": partID, "current": true}).Decode(&a)
+	return a, err
+}
+
+func (r *Repo) UpdateAlertStatus(ctx context.Context, id primitive.ObjectID, status, actor string) (models.LowStockAlert, error) {
+	a, err := r.GetAlert(ctx, id)
+	if err != nil {
+		return models.LowStockAlert{}, err
+	}
+	from := a.Status
+	if !a.SetStatus(status, actor, time.Now()) {
+		return models.LowStockAlert{}, fmt.Errorf("%w from %s to %s", ErrInvalidTransition, from, status)
+	}
+	res, err := r.alerts.ReplaceOne(ctx, bson.M{"_id": id, "status": from}, a)
+	if err != nil {
+		return models.LowStockAlert{}, err
+	}
+	if res.MatchedCount == 0 {
+		return models.LowStockAlert{}, ErrConflict
+	}
+	return a, nil
+}
+
+// SyncLowStockAlert brings the part's current alert in line with its stock:
+// it opens one (or refreshes the open one) while available-to-promise is at
+// or below the reorder point, and resolves it otherwise. Parts that are
+// inactive or gone never alert. The alert is returned only if this call
+// opened it.
+func (r *Repo) SyncLowStockAlert(ctx context.Context, partID primitive.ObjectID) (*models.LowStockAlert, error) {
+	p, err := r.GetPart(ctx, partID)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	now := time.Now()
+
+	if err == nil && p.IsActive {
+		var cat models.Category
+		err := r.categories.FindOne(ctx, bson.M{"_id": p.CategoryID}).Decode(&cat)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+		a := newLowStockAlert(p, cat, now)
+		if a != nil {
+			res, err := r.alerts.UpdateOne(ctx,
+				bson.M{"part_id": partID, "current": true},
+				bson.M{
+					"$set": bson.M{
+						"name":          a.Name,
+						"stock":         a.Stock,
+						"reorder_point": a.ReorderPoint,
+						"safety_stock":  a.SafetyStock,
+						"critical":      a.Critical,
+						"updated_at":    now,
+					},
+					"$setOnInsert": bson.M{"status": models.AlertOpen, "at": now},
+				},
+				options.Update().SetUpsert(true),
+			)
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, nil // a concurrent sync opened it first
+			}
+			if err != nil || res.UpsertedID == nil {
+				return nil, err
+			}
+			a.ID = res.UpsertedID.(primitive.ObjectID)
+			return a, nil
+		}
+	}
+
+	_, err = r.alerts.UpdateMany(ctx,
+		bson.M{"part_id": partID, "current": true},
+		bson.M{"$set": bson.M{
+			"status":      models.AlertResolved,
+			"current":     false,
+			"resolved_at": now,
+			"resolved_by": models.ActorSystem,
+			"updated_at":  now,
+		}},
+	)
+	return nil, err
+}
+
+// newLowStockAlert returns the alert p deserves under its own and its
+// category's thresholds, or nil if it is above the reorder point.
+func newLowStockAlert(p models.SparePart, cat models.Category, now time.Time) *models.LowStockAlert {
+	reorderPoint, safetyStock := p.StockThresholds.Resolve(cat.StockThresholds)
+	if p.Available() > reorderPoint {
+		return nil
+	}
+	return &models.LowStockAlert{
+		PartID:       p.ID,
+		Name:         p.Brand + " " + p.CarModel,
+		Stock:        p.Available(),
+		ReorderPoint: reorderPoint,
+		SafetyStock:  safetyStock,
+		Critical:     p.Available() <= safetyStock,
+		Status:       models.AlertOpen,
+		Current:      true,
+		At:           now,
+		UpdatedAt:    now,
+	}
+}
+
+// ListAlertsSince returns the alerts opened after the one with id afterID,
+// oldest first.
+func (r *Repo) ListAlertsSince(ctx context.Context, afterID primitive.ObjectID, limit int64) ([]models.LowStockAlert, error) {
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cur, err := r.alerts.Find(ctx, bson.M{"_id": bson.M{"$gt": afterID}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := make([]models.LowStockAlert, 0)
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// -------- carts --------
+func (r *Repo) GetCustomerCart(ctx context.Context, customerID primitive.ObjectID) (models.Cart, error) {
+	var c models.Cart
+	err := r.carts.FindOne(ctx, bson.M{"customer_id": customerID}).Decode(&c)
+	return c, err
+}
+
+func (r *Repo) GetSessionCart(ctx context.Context, sessionHash string) (models.Cart, error) {
+	var c models.Cart
+	err := r.carts.FindOne(ctx, bson.M{"session_hash": sessionHash}).Decode(&c)
+	return c, err
+}
+
+func (r *Repo) SaveCart(ctx context.Context, c models.Cart) (models.Cart, error) {
+	if c.ID.IsZero() {
+		c.ID = primitive.NewObjectID()
+	}
+	if c.Items == nil {
+		c.Items = []models.CartItem{}
+	}
+	_, err := r.carts.ReplaceOne(ctx, bson.M{"_id": c.ID}, c, options.Replace().SetUpsert(true))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return models.Cart{}, ErrDuplicate
+		}
+		return models.Cart{}, err
+	}
+	return c, nil
+}
+
+func (r *Repo) DeleteCart(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.carts.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
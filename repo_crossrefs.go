@@ -0,0 +1,69 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// -------- cross references --------
+func (r *Repo) CreateCrossReference(ctx context.Context, x models.CrossReference) (models.CrossReference, error) {
+	x.Normalize()
+	res, err := r.crossRefs.InsertOne(ctx, x)
+	if err != nil {
+		return models.CrossReference{}, err
+	}
+	x.ID = res.InsertedID.(primitive.ObjectID)
+	return x, nil
+}
+
+func (r *Repo) GetCrossReference(ctx context.Context, id primitive.ObjectID) (models.CrossReference, error) {
+	var x models.CrossReference
+	err := r.crossRefs.FindOne(ctx, bson.M{"_id": id}).Decode(&x)
+	return x, err
+}
+
+func (r *Repo) ListCrossReferences(ctx context.Context, keys []string) ([]models.CrossReference, error) {
+	filter := bson.M{}
+	if keys != nil {
+		filter["number_keys"] = bson.M{"$in": keys}
+	}
+	cur, err := r.crossRefs.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := make([]models.CrossReference, 0)
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *Repo) ReplaceCrossReference(ctx context.Context, x models.CrossReference) (models.CrossReference, error) {
+	x.Normalize()
+	res, err := r.crossRefs.ReplaceOne(ctx, bson.M{"_id": x.ID}, x)
+	if err != nil {
+		return models.CrossReference{}, err
+	}
+	if res.MatchedCount == 0 {
+		return models.CrossReference{}, mongo.ErrNoDocuments
+	}
+	return x, nil
+}
+
+func (r *Repo) DeleteCrossReference(ctx context.Context, id primitive.ObjectID) error {
+	res, err := r.crossRefs.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
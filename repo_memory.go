@@ -0,0 +1,771 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MemoryRepo is a thread-safe, process-local Store used for tests and demos.
+// It mirrors Repo's behaviour, including the not-found errors and the
+// all-or-nothing stock checks of PlaceOrder.
+type MemoryRepo struct {
+	mu             sync.RWMutex
+	categories     map[primitive.ObjectID]models.Category
+	parts          map[primitive.ObjectID]models.SparePart
+	orders         map[primitive.ObjectID]models.Order
+	alerts         map[primitive.ObjectID]models.LowStockAlert
+	customers      map[primitive.ObjectID]models.Customer
+	sessions       map[primitive.ObjectID]models.Session
+	warehouses     map[primitive.ObjectID]models.Warehouse
+	inventory      map[inventoryKey]models.InventoryLevel
+	transfers      map[primitive.ObjectID]models.StockTransfer
+	reservations   map[primitive.ObjectID]models.Reservation
+	carts          map[primitive.ObjectID]models.Cart
+	outbox         map[primitive.ObjectID]models.OutboxEvent
+	deadLetters    map[primitive.ObjectID]models.OutboxEvent
+	webhooks       map[primitive.ObjectID]models.WebhookSubscription
+	deliveries     map[primitive.ObjectID]models.WebhookDelivery
+	suppliers      map[primitive.ObjectID]models.Supplier
+	purchaseOrders map[primitive.ObjectID]models.PurchaseOrder
+	vehicles       map[primitive.ObjectID]models.Vehicle
+	fitments       map[primitive.ObjectID]models.Fitment
+	crossRefs      map[primitive.ObjectID]models.CrossReference
+
+	suggest   *SuggestIndex
+	search    *SearchIndex
+	outboxCh  chan struct{}
+	webhookCh chan struct{}
+}
+
+func NewMemoryRepo() *MemoryRepo {
+	return &MemoryRepo{
+		categories:     map[primitive.ObjectID]models.Category{},
+		parts:          map[primitive.ObjectID]models.SparePart{},
+		orders:         map[primitive.ObjectID]models.Order{},
+		alerts:         map[primitive.ObjectID]models.LowStockAlert{},
+		customers:      map[primitive.ObjectID]models.Customer{},
+		sessions:       map[primitive.ObjectID]models.Session{},
+		warehouses:     map[primitive.ObjectID]models.Warehouse{},
+		inventory:      map[inventoryKey]models.InventoryLevel{},
+		transfers:      map[primitive.ObjectID]models.StockTransfer{},
+		reservations:   map[primitive.ObjectID]models.Reservation{},
+		carts:          map[primitive.ObjectID]models.Cart{},
+		outbox:         map[primitive.ObjectID]models.OutboxEvent{},
+		deadLetters:    map[primitive.ObjectID]models.OutboxEvent{},
+		webhooks:       map[primitive.ObjectID]models.WebhookSubscription{},
+		deliveries:     map[primitive.ObjectID]models.WebhookDelivery{},
+		suppliers:      map[primitive.ObjectID]models.Supplier{},
+		purchaseOrders: map[primitive.ObjectID]models.PurchaseOrder{},
+		vehicles:       map[primitive.ObjectID]models.Vehicle{},
+		fitments:       map[primitive.ObjectID]models.Fitment{},
+		crossRefs:      map[primitive.ObjectID]models.CrossReference{},
+		suggest:        NewSuggestIndex(),
+		search:         NewSearchIndex(),
+		outboxCh:       make(chan struct{}, 1),
+		webhookCh:      make(chan struct{}, 1),
+	}
+}
+
+// -------- categories --------
+func (m *MemoryRepo) CreateCategory(ctx context.Context, c models.Category) (models.Category, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c.ID = primitive.NewObjectID()
+	c.PartsList = append([]primitive.ObjectID(nil), c.PartsList...)
+	m.categories[c.ID] = c
+	m.suggest.SetCategory(c)
+	return copyCategory(c), nil
+}
+
+func (m *MemoryRepo) ListCategories(ctx context.Context) ([]models.Category, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]models.Category, 0, len(m.categories))
+	for _, c := range m.categories {
+		out = append(out, copyCategory(c))
+	}
+	sort.Slice(out, func(i, j int) bool { return idLess(out[i].ID, out[j].ID) })
+	return out, nil
+}
+
+func (m *MemoryRepo) GetCategory(ctx context.Context, id primitive.ObjectID) (models.Category, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.categories[id]
+	if !ok {
+		return models.Category{}, mongo.ErrNoDocuments
+	}
+	return copyCategory(c), nil
+}
+
+func (m *MemoryRepo) UpdateCategory(ctx context.Context, id primitive.ObjectID, name, desc string) (models.Category, error) {
+	if name == "" && desc == "" {
+		return models.Category{}, errors.New("nothing to update")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.categories[id]
+	if !ok {
+		return models.Category{}, mongo.ErrNoDocuments
+	}
+	if name != "" {
+		c.Name = name
+	}
+	if desc != "" {
+		c.Description = desc
+	}
+	m.categories[id] = c
+	m.suggest.SetCategory(c)
+	return copyCategory(c), nil
+}
+
+func (m *MemoryRepo) SetCategoryThresholds(ctx context.Context, id primitive.ObjectID, t models.StockThresholds) (models.Category, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.categories[id]
+	if !ok {
+		return models.Category{}, mongo.ErrNoDocuments
+	}
+	c.StockThresholds = t
+	m.categories[id] = c
+	var ids []primitive.ObjectID
+	for _, p := range m.parts {
+		if p.CategoryID == id {
+			ids = append(ids, p.ID)
+		}
+	}
+	m.stockChangedLocked(ids...)
+	return copyCategory(c), nil
+}
+
+func (m *MemoryRepo) DeleteCategory(ctx context.Context, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.categories, id)
+	m.suggest.RemoveCategory(id)
+	return nil
+}
+
+// -------- parts --------
+func (m *MemoryRepo) CreatePart(ctx context.Context, p models.SparePart) (models.SparePart, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p.ID = primitive.NewObjectID()
+	p.OEMNumbers = append([]string(nil), p.OEMNumbers...)
+	p.SetNumberKeys()
+	indexPart(&p)
+	m.parts[p.ID] = p
+
+	if c, ok := m.categories[p.CategoryID]; ok && !containsID(c.PartsList, p.ID) {
+		c.PartsList = append(c.PartsList, p.ID)
+		m.categories[c.ID] = c
+	}
+	m.stockChangedLocked(p.ID)
+	m.suggest.SetPart(p)
+	m.search.SetPart(p)
+	return p, nil
+}
+
+func (m *MemoryRepo) GetPart(ctx context.Context, id primitive.ObjectID) (models.SparePart, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.parts[id]
+	if !ok {
+		return models.SparePart{}, mongo.ErrNoDocuments
+	}
+	return p, nil
+}
+
+func (m *MemoryRepo) DeletePart(ctx context.Context, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.parts, id)
+	for fid, f := range m.fitments {
+		if f.PartID == id {
+			delete(m.fitments, fid)
+		}
+	}
+	m.stockChangedLocked(id)
+	m.suggest.RemovePart(id)
+	m.search.RemovePart(id)
+	return nil
+}
+
+func (m *MemoryRepo) UpdatePart(ctx context.Context, id primitive.ObjectID, upd bson.M) (models.SparePart, error) {
+	if len(upd) == 0 {
+		return models.SparePart{}, errors.New("nothing to update")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.parts[id]
+	if !ok {
+		return models.SparePart{}, mongo.ErrNoDocuments
+	}
+	if err := applySet(&p, upd); err != nil {
+		return models.SparePart{}, err
+	}
+	indexPart(&p)
+	m.parts[id] = p
+	m.stockChangedLocked(id)
+	m.suggest.SetPart(p)
+	m.search.SetPart(p)
+	return p, nil
+}
+
+func (m *MemoryRepo) ListPartsFiltered(ctx context.Context, f PartFilter) ([]models.SparePart, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out, pm := m.filterPartsLocked(f)
+	if !pm.q.IsZero() {
+		df, total := m.search.Frequencies(pm.q.Terms())
+		rankParts(out, pm.q, df, total)
+	}
+	return out, nil
+}
+
+// filterPartsLocked returns the parts f matches, by id, and the matcher it
+// compiled.
+func (m *MemoryRepo) filterPartsLocked(f PartFilter) ([]models.SparePart, partMatcher) {
+	f = searchable(f)
+	var pm partMatcher
+	if f.Q != "" || f.Brand != "" || f.CarModel != "" {
+		pm = newPartMatcher(f, m.search.Vocabulary())
+	}
+	out := make([]models.SparePart, 0)
+	for _, p := range m.parts {
+		if !p.IsActive {
+			continue
+		}
+		if f.CategoryID != nil && p.CategoryID != *f.CategoryID {
+			continue
+		}
+		if f.IDs != nil && !containsID(f.IDs, p.ID) {
+			continue
+		}
+		if f.NumberKeys != nil && !sharesString(f.NumberKeys, p.NumberKeys) {
+			continue
+		}
+		if f.Compatibility != "" && !containsFold(p.Compatibility, f.Compatibility) {
+			continue
+		}
+		if f.IsNew != nil && p.IsNew != *f.IsNew {
+			continue
+		}
+		if f.InStock != nil && (p.Available() > 0) != *f.InStock {
+			continue
+		}
+		if f.MinPrice != nil && p.Price < *f.MinPrice || f.MaxPrice != nil && p.Price >= *f.MaxPrice {
+			continue
+		}
+		if pm.fuzzy() && !pm.matches(p) {
+			continue
+		}
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return idLess(out[i].ID, out[j].ID) })
+	return out, pm
+}
+
+func (m *MemoryRepo) PartFacets(ctx context.Context, f PartFilter) (models.PartFacets, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	parts, _ := m.filterPartsLocked(f)
+	out := models.NewPartFacets()
+	out.Total = len(parts)
+	brands, cats, carModels := map[string]int{}, map[string]int{}, map[string]int{}
+	for _, p := range parts {
+		brands[p.Brand]++
+		cats[p.CategoryID.Hex()]++
+		carModels[p.CarModel]++
+		if p.IsNew {
+			out.Condition.New++
+		} else {
+			out.Condition.Used++
+		}
+		if p.Available() > 0 {
+			out.Stock.InStock++
+		} else {
+			out.Stock.OutOfStock++
+		}
+		for i := len(out.Price) - 1; i >= 0; i-- {
+			if p.Price >= out.Price[i].Min || i == 0 {
+				out.Price[i].Count++
+				break
+			}
+		}
+	}
+	out.Brands = facetCounts(brands)
+	out.Categories = facetCounts(cats)
+	for i, c := range out.Categories {
+		if id, err := primitive.ObjectIDFromHex(c.Value); err == nil {
+			out.Categories[i].Label = m.categories[id].Name
+		}
+	}
+	out.CarModels = facetCounts(carModels)
+	return out, nil
+}
+
+// facetCounts lists counts most first, then by value.
+func facetCounts(counts map[string]int) []models.FacetCount {
+	out := make([]models.FacetCount, 0, len(counts))
+	for v, n := range counts {
+		out = append(out, models.FacetCount{Value: v, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Value < out[j].Value
+	})
+	return out
+}
+
+func (m *MemoryRepo) Suggest(prefix string, limit int) []Suggestion {
+	return m.suggest.Suggest(prefix, limit)
+}
+
+// -------- orders --------
+func (m *MemoryRepo) PlaceOrder(ctx context.Context, o models.Order) (models.Order, error) {
+	if o.ID.IsZero() {
+		o.ID = primitive.NewObjectID()
+	}
+	o.Items = append([]models.OrderItem(nil), o.Items...)
+	if o.StatusHistory == nil {
+		o.StatusHistory = []models.StatusChange{}
+	}
+	if o.ReservedUntil == nil {
+		until := time.Now().Add(reservationTTL)
+		o.ReservedUntil = &until
+	}
+
+	m.mu.Lock()
+	var undo []func()
+	for i := range o.Items {
+		it := &o.Items[i]
+		if it.Quantity <= 0 {
+			rollbackLocked(undo)
+			m.mu.Unlock()
+			return models.Order{}, errors.New("quantity must be > 0")
+		}
+		p, err := m.reserveLineLocked(it, &undo)
+		if err != nil {
+			// nothing outside the lock has seen the partial holds
+			rollbackLocked(undo)
+			m.mu.Unlock()
+			return models.Order{}, err
+		}
+		it.OrderID = o.ID
+		it.Price = p.Price
+	}
+	for _, it := range o.Items {
+		h := models.Reservation{
+			ID:          primitive.NewObjectID(),
+			OrderID:     o.ID,
+			PartID:      it.PartID,
+			WarehouseID: it.WarehouseID,
+			Quantity:    it.Quantity,
+			Status:      models.ReservationActive,
+			ExpiresAt:   *o.ReservedUntil,
+			CreatedAt:   o.CreatedAt,
+		}
+		m.reservations[h.ID] = h
+	}
+	o.TotalPrice = o.CalculateTotal()
+	m.orders[o.ID] = copyOrder(o)
+	m.stockChangedLocked(o.PartIDs()...)
+	m.orderChangedLocked(models.TopicOrderCreated, o)
+	m.mu.Unlock()
+	return o, nil
+}
+
+func (m *MemoryRepo) GetOrder(ctx context.Context, id primitive.ObjectID) (models.Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	o, ok := m.orders[id]
+	if !ok {
+		return models.Order{}, mongo.ErrNoDocuments
+	}
+	return copyOrder(o), nil
+}
+
+func (m *MemoryRepo) PartDemand(ctx context.Context, since time.Time) (map[primitive.ObjectID]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := map[primitive.ObjectID]int{}
+	for _, o := range m.orders {
+		if o.CreatedAt.Before(since) || o.Status == models.StatusCanceled || o.Status == models.StatusRefunded {
+			continue
+		}
+		for _, it := range o.Items {
+			out[it.PartID] += it.Quantity
+		}
+	}
+	return out, nil
+}
+
+func (m *MemoryRepo) ListOrders(ctx context.Context, f OrderFilter, pr PageRequest) ([]models.Order, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// created_at is stored with millisecond precision in Mongo; compare the
+	// same way so cursors behave identically on both backends
+	ms := func(t time.Time) int64 { return t.UnixMilli() }
+	before := func(a, b models.Order) bool {
+		if ms(a.CreatedAt) != ms(b.CreatedAt) {
+			return ms(a.CreatedAt) < ms(b.CreatedAt)
+		}
+		return idLess(a.ID, b.ID)
+	}
+
+	out := make([]models.Order, 0)
+	for _, o := range m.orders {
+		if f.CustomerID != nil && o.CustomerID != *f.CustomerID {
+			continue
+		}
+		if f.Status != "" && o.Status != f.Status {
+			continue
+		}
+		if f.IsPaid != nil && o.IsPaid != *f.IsPaid {
+			continue
+		}
+		if !f.From.IsZero() && ms(o.CreatedAt) < ms(f.From) {
+			continue
+		}
+		if !f.To.IsZero() && ms(o.CreatedAt) >= ms(f.To) {
+			continue
+		}
+		if c := pr.After; c != nil {
+			at := models.Order{ID: c.ID, CreatedAt: c.CreatedAt}
+			if pr.Asc && !before(at, o) || !pr.Asc && !before(o, at) {
+				continue
+			}
+		}
+		out = append(out, copyOrder(o))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if pr.Asc {
+			return before(out[i], out[j])
+		}
+		return before(out[j], out[i])
+	})
+	if len(out) > pr.Limit+1 {
+		out = out[:pr.Limit+1]
+	}
+	out, next := trimPage(out, pr.Limit)
+	return out, next, nil
+}
+
+func (m *MemoryRepo) UpdateOrderStatus(ctx context.Context, id primitive.ObjectID, status, actor string) (models.Order, error) {
+	if status == models.StatusCanceled {
+		return m.CancelOrder(ctx, id, actor)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.orders[id]
+	if !ok {
+		return models.Order{}, mongo.ErrNoDocuments
+	}
+	o = copyOrder(o)
+	from := o.Status
+	if !o.UpdateStatus(status, actor, time.Now()) {
+		return models.Order{}, fmt.Errorf("%w from %s to %s", ErrInvalidTransition, from, status)
+	}
+	switch {
+	case status == models.StatusPaid:
+		m.settleHoldsLocked(id, models.ReservationCommitted, new([]func()))
+	case status == models.StatusRefunded && from != models.StatusDelivered:
+		m.restockOrderLocked(from, o)
+	}
+	m.orders[id] = o
+	m.orderChangedLocked(models.TopicOrderStatusChanged, o)
+	return copyOrder(o), nil
+}
+
+func (m *MemoryRepo) CancelOrder(ctx context.Context, id primitive.ObjectID, actor string) (models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.orders[id]
+	if !ok {
+		return models.Order{}, mongo.ErrNoDocuments
+	}
+	if o.Status == models.StatusCanceled {
+		return copyOrder(o), nil
+	}
+	o = copyOrder(o)
+	from := o.Status
+	if !o.UpdateStatus(models.StatusCanceled, actor, time.Now()) {
+		return models.Order{}, fmt.Errorf("%w from %s to %s", ErrInvalidTransition, from, models.StatusCanceled)
+	}
+	m.restockOrderLocked(from, o)
+	m.orders[id] = o
+	m.orderChangedLocked(models.TopicOrderStatusChanged, o)
+	return copyOrder(o), nil
+}
+
+// restockOrderLocked gives back what the order took from stock, as
+// Repo.restockOrder does.
+func (m *MemoryRepo) restockOrderLocked(from string, o models.Order) {
+	var undo []func()
+	m.settleHoldsLocked(o.ID, models.ReservationReleased, &undo)
+	if from != models.StatusCreated || o.ReservedUntil == nil {
+		for _, it := range o.Items {
+			m.returnLineLocked(it, &undo)
+		}
+	}
+	m.stockChangedLocked(o.PartIDs()...)
+}
+
+// -------- customers --------
+func (m *MemoryRepo) CreateCustomer(ctx context.Context, c models.Customer) (models.Customer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.customerTakenLocked(primitive.NilObjectID, c.Email, c.Phone) {
+		return models.Customer{}, ErrDuplicate
+	}
+	c.ID = primitive.NewObjectID()
+	m.customers[c.ID] = c
+	return c, nil
+}
+
+func (m *MemoryRepo) GetCustomer(ctx context.Context, id primitive.ObjectID) (models.Customer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.customers[id]
+	if !ok {
+		return models.Customer{}, mongo.ErrNoDocuments
+	}
+	return c, nil
+}
+
+func (m *MemoryRepo) GetCustomerByEmail(ctx context.Context, email string) (models.Customer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, c := range m.customers {
+		if c.Email == email {
+			return c, nil
+		}
+	}
+	return models.Customer{}, mongo.ErrNoDocuments
+}
+
+func (m *MemoryRepo) ListCustomers(ctx context.Context) ([]models.Customer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]models.Customer, 0, len(m.customers))
+	for _, c := range m.customers {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return idLess(out[i].ID, out[j].ID) })
+	return out, nil
+}
+
+func (m *MemoryRepo) UpdateCustomer(ctx context.Context, id primitive.ObjectID, upd bson.M) (models.Customer, error) {
+	if len(upd) == 0 {
+		return models.Customer{}, errors.New("nothing to update")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.customers[id]
+	if !ok {
+		return models.Customer{}, mongo.ErrNoDocuments
+	}
+	if err := applySet(&c, upd); err != nil {
+		return models.Customer{}, err
+	}
+	if m.customerTakenLocked(id, c.Email, c.Phone) {
+		return models.Customer{}, ErrDuplicate
+	}
+	m.customers[id] = c
+	return c, nil
+}
+
+func (m *MemoryRepo) DeleteCustomer(ctx context.Context, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.customers, id)
+	return nil
+}
+
+// customerTakenLocked mirrors the unique indexes on email and (non-empty) phone.
+func (m *MemoryRepo) customerTakenLocked(self primitive.ObjectID, email, phone string) bool {
+	for id, c := range m.customers {
+		if id == self {
+			continue
+		}
+		if c.Email == email || (phone != "" && c.Phone == phone) {
+			return true
+		}
+	}
+	return false
+}
+
+// -------- sessions --------
+func (m *MemoryRepo) CreateSession(ctx context.Context, s models.Session) (models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s.ID.IsZero() {
+		s.ID = primitive.NewObjectID()
+	}
+	m.sessions[s.ID] = s
+	return s, nil
+}
+
+func (m *MemoryRepo) GetSession(ctx context.Context, id primitive.ObjectID) (models.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		return models.Session{}, mongo.ErrNoDocuments
+	}
+	return s, nil
+}
+
+func (m *MemoryRepo) RotateSession(ctx context.Context, id primitive.ObjectID, oldHash, newHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok || s.RevokedAt != nil || s.RefreshHash != oldHash {
+		return mongo.ErrNoDocuments
+	}
+	s.RefreshHash = newHash
+	s.ExpiresAt = expiresAt
+	m.sessions[id] = s
+	return nil
+}
+
+func (m *MemoryRepo) RevokeSession(ctx context.Context, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok || s.RevokedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	s.RevokedAt = &now
+	m.sessions[id] = s
+	return nil
+}
+
+// -------- helpers --------
+
+// applySet emulates a Mongo $set on a struct: the document is round-tripped
+// through BSON so the keys in upd are the same bson field names Repo uses.
+func applySet(dst any, upd bson.M) error {
+	raw, err := bson.Marshal(dst)
+	if err != nil {
+		return err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	for k, v := range upd {
+		doc[k] = v
+	}
+	raw, err = bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, dst)
+}
+
+func containsFold(s, sub string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sharesString(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func idLess(a, b primitive.ObjectID) bool {
+	return a.Hex() < b.Hex()
+}
+
+func copyCategory(c models.Category) models.Category {
+	c.PartsList = append([]primitive.ObjectID{}, c.PartsList...)
+	return c
+}
+
+func copyOrder(o models.Order) models.Order {
+	o.Items = append([]models.OrderItem{}, o.Items...)
+	for i, it := range o.Items {
+		if it.WarehouseID != nil {
+			wid := *it.WarehouseID
+			o.Items[i].WarehouseID = &wid
+		}
+	}
+	o.StatusHistory = append([]models.StatusChange{}, o.StatusHistory...)
+	if o.ReservedUntil != nil {
+		t := *o.ReservedUntil
+		o.ReservedUntil = &t
+	}
+	return o
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// -------- alerts --------
+func (m *MemoryRepo) ListAlerts(ctx context.Context, status string, limit int64) ([]models.LowStockAlert, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]models.LowStockAlert, 0, len(m.alerts))
+	for _, a := range m.alerts {
+		if status != "" && a.Status != status {
+			continue
+		}
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].At.After(out[j].At) })
+	if limit > 0 && int64(len(out)) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (m *MemoryRepo) GetAlert(ctx context.Context, id primitive.ObjectID) (models.LowStockAlert, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	a, ok := m.alerts[id]
+	if !ok {
+		return models.LowStockAlert{}, mongo.ErrNoDocuments
+	}
+	return a, nil
+}
+
+func (m *MemoryRepo) CurrentAlert(ctx context.Context, partID primitive.ObjectID) (models.LowStockAlert, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, a := range m.alerts {
+		if a.PartID == partID && a.Current {
+			return a, nil
+		}
+	}
+	return models.LowStockAlert{}, mongo.ErrNoDocuments
+}
+
+func (m *MemoryRepo) UpdateAlertStatus(ctx context.Context, id primitive.ObjectID, status, actor string) (models.LowStockAlert, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.alerts[id]
+	if !ok {
+		return models.LowStockAlert{}, mongo.ErrNoDocuments
+	}
+	from := a.Status
+	if !a.SetStatus(status, actor, time.Now()) {
+		return models.LowStockAlert{}, fmt.Errorf("%w from %s to %s", ErrInvalidTransition, from, status)
+	}
+	m.alerts[id] = a
+	return a, nil
+}
+
+func (m *MemoryRepo) SyncLowStockAlert(ctx context.Context, partID primitive.ObjectID) (*models.LowStockAlert, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var want *models.LowStockAlert
+	if p, ok := m.parts[partID]; ok && p.IsActive {
+		want = newLowStockAlert(p, m.categories[p.CategoryID], now)
+	}
+
+	for id, a := range m.alerts {
+		if a.PartID != partID || !a.Current {
+			continue
+		}
+		if want == nil {
+			a.SetStatus(models.AlertResolved, models.ActorSystem, now)
+		} else {
+			a.Name, a.Stock, a.Critical = want.Name, want.Stock, want.Critical
+			a.ReorderPoint, a.SafetyStock = want.ReorderPoint, want.SafetyStock
+			a.UpdatedAt = now
+			want = nil
+		}
+		m.alerts[id] = a
+	}
+	if want == nil {
+		return nil, nil
+	}
+	want.ID = primitive.NewObjectID()
+	m.alerts[want.ID] = *want
+	return want, nil
+}
+
+func (m *MemoryRepo) ListAlertsSince(ctx context.Context, afterID primitive.ObjectID, limit int64) ([]models.LowStockAlert, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]models.LowStockAlert, 0)
+	for _, a := range m.alerts {
+		if idLess(afterID, a.ID) {
+			out = append(out, a)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return idLess(out[i].ID, out[j].ID) })
+	if limit > 0 && int64(len(out)) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
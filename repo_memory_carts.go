@@ -0,0 +1,72 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// -------- carts --------
+func (m *MemoryRepo) GetCustomerCart(ctx context.Context, customerID primitive.ObjectID) (models.Cart, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, c := range m.carts {
+		if c.CustomerID != nil && *c.CustomerID == customerID {
+			return copyCart(c), nil
+		}
+	}
+	return models.Cart{}, mongo.ErrNoDocuments
+}
+
+func (m *MemoryRepo) GetSessionCart(ctx context.Context, sessionHash string) (models.Cart, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, c := range m.carts {
+		if c.SessionHash != "" && c.SessionHash == sessionHash {
+			return copyCart(c), nil
+		}
+	}
+	return models.Cart{}, mongo.ErrNoDocuments
+}
+
+func (m *MemoryRepo) SaveCart(ctx context.Context, c models.Cart) (models.Cart, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if c.ID.IsZero() {
+		c.ID = primitive.NewObjectID()
+	}
+	if c.Items == nil {
+		c.Items = []models.CartItem{}
+	}
+	for id, other := range m.carts {
+		if id == c.ID {
+			continue
+		}
+		if c.CustomerID != nil && other.CustomerID != nil && *c.CustomerID == *other.CustomerID {
+			return models.Cart{}, ErrDuplicate
+		}
+		if c.SessionHash != "" && c.SessionHash == other.SessionHash {
+			return models.Cart{}, ErrDuplicate
+		}
+	}
+	m.carts[c.ID] = copyCart(c)
+	return c, nil
+}
+
+func (m *MemoryRepo) DeleteCart(ctx context.Context, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.carts, id)
+	return nil
+}
+
+func copyCart(c models.Cart) models.Cart {
+	c.Items = append([]models.CartItem{}, c.Items...)
+	return c
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// -------- cross references --------
+func (m *MemoryRepo) CreateCrossReference(ctx context.Context, x models.CrossReference) (models.CrossReference, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	x.Normalize()
+	x.ID = primitive.NewObjectID()
+	m.crossRefs[x.ID] = x
+	return copyCrossReference(x), nil
+}
+
+func (m *MemoryRepo) GetCrossReference(ctx context.Context, id primitive.ObjectID) (models.CrossReference, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	x, ok := m.crossRefs[id]
+	if !ok {
+		return models.CrossReference{}, mongo.ErrNoDocuments
+	}
+	return copyCrossReference(x), nil
+}
+
+func (m *MemoryRepo) ListCrossReferences(ctx context.Context, keys []string) ([]models.CrossReference, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]models.CrossReference, 0)
+	for _, x := range m.crossRefs {
+		if keys != nil && !sharesString(keys, x.NumberKeys) {
+			continue
+		}
+		out = append(out, copyCrossReference(x))
+	}
+	sort.Slice(out, func(i, j int) bool { return idLess(out[i].ID, out[j].ID) })
+	return out, nil
+}
+
+func (m *MemoryRepo) ReplaceCrossReference(ctx context.Context, x models.CrossReference) (models.CrossReference, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.crossRefs[x.ID]; !ok {
+		return models.CrossReference{}, mongo.ErrNoDocuments
+	}
+	x.Normalize()
+	m.crossRefs[x.ID] = x
+	return copyCrossReference(x), nil
+}
+
+func (m *MemoryRepo) DeleteCrossReference(ctx context.Context, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.crossRefs[id]; !ok {
+		return mongo.ErrNoDocuments
+	}
+	delete(m.crossRefs, id)
+	return nil
+}
+
+func copyCrossReference(x models.CrossReference) models.CrossReference {
+	x.Numbers = append([]models.PartNumberRef{}, x.Numbers...)
+	x.NumberKeys = append([]string{}, x.NumberKeys...)
+	return x
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// -------- outbox --------
+
+// stockChangedLocked is the in-memory twin of Repo.stockChanged; the event
+// lands under the same lock as the change itself.
+func (m *MemoryRepo) stockChangedLocked(ids ...primitive.ObjectID) {
+	if len(ids) == 0 {
+		return
+	}
+	m.enqueueLocked(models.NewStockChangedEvent(ids, time.Now()))
+}
+
+func (m *MemoryRepo) orderChangedLocked(topic string, o models.Order) {
+	m.enqueueLocked(models.NewOrderEvent(topic, o.ID, o.Status, time.Now()))
+}
+
+func (m *MemoryRepo) enqueueLocked(ev models.OutboxEvent) {
+	m.outbox[ev.ID] = ev
+	m.notifyOutbox()
+}
+
+func (m *MemoryRepo) notifyOutbox() {
+	select {
+	case m.outboxCh <- struct{}{}:
+	default:
+	}
+}
+
+func (m *MemoryRepo) OutboxSignal() <-chan struct{} {
+	return m.outboxCh
+}
+
+func (m *MemoryRepo) ClaimOutbox(ctx context.Context, now time.Time, lease time.Duration, n int) ([]models.OutboxEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	due := make([]models.OutboxEvent, 0)
+	for _, ev := range m.outbox {
+		if ev.NextAttemptAt.After(now) || (ev.LockedUntil != nil && ev.LockedUntil.After(now)) {
+			continue
+		}
+		due = append(due, ev)
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > n {
+		due = due[:n]
+	}
+	until := now.Add(lease)
+	for i := range due {
+		due[i].LockedUntil = &until
+		m.outbox[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (m *MemoryRepo) CompleteOutbox(ctx context.Context, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.outbox, id)
+	return nil
+}
+
+func (m *MemoryRepo) RetryOutbox(ctx context.Context, id primitive.ObjectID, lastErr string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ev, ok := m.outbox[id]
+	if !ok {
+		return nil
+	}
+	ev.Attempts++
+	ev.NextAttemptAt = at
+	ev.LastError = lastErr
+	ev.LockedUntil = nil
+	m.outbox[id] = ev
+	return nil
+}
+
+func (m *MemoryRepo) DeadLetterOutbox(ctx context.Context, id primitive.ObjectID, lastErr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ev, ok := m.outbox[id]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	delete(m.outbox, id)
+	now := time.Now()
+	ev.Attempts++
+	ev.LastError = lastErr
+	ev.LockedUntil = nil
+	ev.DeadAt = &now
+	m.deadLetters[id] = ev
+	return nil
+}
+
+func (m *MemoryRepo) ListDeadLetters(ctx context.Context, limit int64) ([]models.OutboxEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]models.OutboxEvent, 0, len(m.deadLetters))
+	for _, ev := range m.deadLetters {
+		out = append(out, ev)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].DeadAt.After(*out[j].DeadAt) })
+	if limit > 0 && int64(len(out)) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (m *MemoryRepo) RequeueDeadLetter(ctx context.Context, id primitive.ObjectID) (models.OutboxEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ev, ok := m.deadLetters[id]
+	if !ok {
+		return models.OutboxEvent{}, mongo.ErrNoDocuments
+	}
+	delete(m.deadLetters, id)
+	ev.Attempts = 0
+	ev.NextAttemptAt = time.Now()
+	ev.DeadAt = nil
+	m.outbox[id] = ev
+	m.notifyOutbox()
+	return ev, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// reserveLineLocked is the in-memory twin of Repo.reserveLine. Every change
+// it makes is recorded in undo so the caller can roll a whole order back.
+func (m *MemoryRepo) reserveLineLocked(it *models.OrderItem, undo *[]func()) (models.SparePart, error) {
+	var candidates []primitive.ObjectID
+	if it.WarehouseID != nil {
+		if wh, ok := m.warehouses[*it.WarehouseID]; ok && !wh.IsActive {
+			return models.SparePart{}, fmt.Errorf("warehouse %s: %w", wh.ID.Hex(), ErrWarehouseInactive)
+		}
+		candidates = []primitive.ObjectID{*it.WarehouseID}
+	} else {
+		levels := m.partInventoryLocked(it.PartID)
+		if len(levels) == 0 {
+			return m.holdPartLocked(it.PartID, it.Quantity, undo)
+		}
+		for _, l := range levels {
+			if m.warehouses[l.WarehouseID].IsActive {
+				candidates = append(candidates, l.WarehouseID)
+			}
+		}
+	}
+
+	for _, wid := range candidates {
+		k := inventoryKey{wid, it.PartID}
+		l, ok := m.inventory[k]
+		if !ok || l.Available() < it.Quantity {
+			continue
+		}
+		if err := m.canHoldLocked(it.PartID, it.Quantity); err != nil {
+			return models.SparePart{}, err
+		}
+		wid := wid
+		m.shiftStockLocked(&wid, it.PartID, 0, it.Quantity, undo)
+		it.WarehouseID = &wid
+		return m.parts[it.PartID], nil
+	}
+	return models.SparePart{}, fmt.Errorf("part %s: %w", it.PartID.Hex(), ErrNotEnoughStock)
+}
+
+func (m *MemoryRepo) holdPartLocked(partID primitive.ObjectID, qty int, undo *[]func()) (models.SparePart, error) {
+	if err := m.canHoldLocked(partID, qty); err != nil {
+		return models.SparePart{}, err
+	}
+	m.shiftStockLocked(nil, partID, 0, qty, undo)
+	return m.parts[partID], nil
+}
+
+func (m *MemoryRepo) canHoldLocked(partID primitive.ObjectID, qty int) error {
+	p, ok := m.parts[partID]
+	if !ok || !p.IsActive || p.Available() < qty {
+		return fmt.Errorf("part %s: %w", partID.Hex(), ErrNotEnoughStock)
+	}
+	return nil
+}
+
+// settleHoldsLocked is the in-memory twin of Repo.settleHolds.
+func (m *MemoryRepo) settleHoldsLocked(orderID primitive.ObjectID, status string, undo *[]func()) {
+	for id, h := range m.reservations {
+		if h.OrderID != orderID || h.Status != models.ReservationActive {
+			continue
+		}
+		h.Status = status
+		m.reservations[id] = h
+		id := id
+		*undo = append(*undo, func() {
+			h := m.reservations[id]
+			h.Status = models.ReservationActive
+			m.reservations[id] = h
+		})
+
+		taken := 0
+		if status == models.ReservationCommitted {
+			taken = h.Quantity
+		}
+		m.shiftStockLocked(h.WarehouseID, h.PartID, -taken, -h.Quantity, undo)
+	}
+}
+
+// shiftStockLocked adds the deltas to the part and, when warehouseID is set,
+// to its level there.
+func (m *MemoryRepo) shiftStockLocked(warehouseID *primitive.ObjectID, partID primitive.ObjectID, stock, reserved int, undo *[]func()) {
+	if p, ok := m.parts[partID]; ok {
+		p.Stock += stock
+		p.Reserved += reserved
+		m.parts[partID] = p
+	}
+	if warehouseID != nil {
+		k := inventoryKey{*warehouseID, partID}
+		if l, ok := m.inventory[k]; ok {
+			l.Quantity += stock
+			l.Reserved += reserved
+			l.UpdatedAt = time.Now()
+			m.inventory[k] = l
+		}
+	}
+	*undo = append(*undo, func() {
+		m.shiftStockLocked(warehouseID, partID, -stock, -reserved, new([]func()))
+	})
+}
+
+func (m *MemoryRepo) ReleaseExpiredReservations(ctx context.Context, now time.Time) (int, error) {
+	m.mu.RLock()
+	expired := map[primitive.ObjectID]bool{}
+	for _, h := range m.reservations {
+		if h.Status == models.ReservationActive && !h.ExpiresAt.After(now) {
+			expired[h.OrderID] = true
+		}
+	}
+	m.mu.RUnlock()
+
+	n := 0
+	var firstErr error
+	for oid := range expired {
+		_, err := m.CancelOrder(ctx, oid, models.ActorSystem)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// the order is gone; free its holds on their own
+			m.mu.Lock()
+			m.settleHoldsLocked(oid, models.ReservationReleased, new([]func()))
+			m.mu.Unlock()
+			err = nil
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		n++
+	}
+	return n, firstErr
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// -------- suppliers --------
+func (m *MemoryRepo) CreateSupplier(ctx context.Context, s models.Supplier) (models.Supplier, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s.ID = primitive.NewObjectID()
+	s = copySupplier(s)
+	m.suppliers[s.ID] = s
+	return copySupplier(s), nil
+}
+
+func (m *MemoryRepo) ListSuppliers(ctx context.Context) ([]models.Supplier, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]models.Supplier, 0, len(m.suppliers))
+	for _, s := range m.suppliers {
+		out = append(out, copySupplier(s))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (m *MemoryRepo) GetSupplier(ctx context.Context, id primitive.ObjectID) (models.Supplier, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.suppliers[id]
+	if !ok {
+		return models.Supplier{}, mongo.ErrNoDocuments
+	}
+	return copySupplier(s), nil
+}
+
+func (m *MemoryRepo) UpdateSupplier(ctx context.Context, id primitive.ObjectID, upd bson.M) (models.Supplier, error) {
+	if len(upd) == 0 {
+		return models.Supplier{}, errors.New("nothing to update")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.suppliers[id]
+	if !ok {
+		return models.Supplier{}, mongo.ErrNoDocuments
+	}
+	s = copySupplier(s)
+	if err := applySet(&s, upd); err != nil {
+		return models.Supplier{}, err
+	}
+	m.suppliers[id] = s
+	return copySupplier(s), nil
+}
+
+func (m *MemoryRepo) DeleteSupplier(ctx context.Context, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.suppliers[id]; !ok {
+		return mongo.ErrNoDocuments
+	}
+	for _, po := range m.purchaseOrders {
+		if po.SupplierID == id {
+			return ErrSupplierInUse
+		}
+	}
+	delete(m.suppliers, id)
+	return nil
+}
+
+func (m *MemoryRepo) SetSupplierPrice(ctx context.Context, id primitive.ObjectID, p models.SupplierPrice) (models.Supplier, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.suppliers[id]
+	if !ok {
+		return models.Supplier{}, mongo.ErrNoDocuments
+	}
+	s = copySupplier(s)
+	replaced := false
+	for i := range s.Prices {
+		if s.Prices[i].PartID == p.PartID {
+			s.Prices[i], replaced = p, true
+		}
+	}
+	if !replaced {
+		s.Prices = append(s.Prices, p)
+	}
+	m.suppliers[id] = s
+	return copySupplier(s), nil
+}
+
+func (m *MemoryRepo) RemoveSupplierPrice(ctx context.Context, id, partID primitive.ObjectID) (models.Supplier, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.suppliers[id]
+	if !ok {
+		return models.Supplier{}, mongo.ErrNoDocuments
+	}
+	if _, ok := s.PriceFor(partID); !ok {
+		return models.Supplier{}, mongo.ErrNoDocuments
+	}
+	prices := make([]models.SupplierPrice, 0, len(s.Prices))
+	for _, p := range s.Prices {
+		if p.PartID != partID {
+			prices = append(prices, p)
+		}
+	}
+	s.Prices = prices
+	m.suppliers[id] = s
+	return copySupplier(s), nil
+}
+
+// -------- purchase orders --------
+func (m *MemoryRepo) CreatePurchaseOrder(ctx context.Context, po models.PurchaseOrder) (models.PurchaseOrder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	po.ID = primitive.NewObjectID()
+	po.CalcTotal()
+	m.purchaseOrders[po.ID] = copyPurchaseOrder(po)
+	return po, nil
+}
+
+func (m *MemoryRepo) GetPurchaseOrder(ctx context.Context, id primitive.ObjectID) (models.PurchaseOrder, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	po, ok := m.purchaseOrders[id]
+	if !ok {
+		return models.PurchaseOrder{}, mongo.ErrNoDocuments
+	}
+	return copyPurchaseOrder(po), nil
+}
+
+func (m *MemoryRepo) ListPurchaseOrders(ctx context.Context, status string, supplierID *primitive.ObjectID) ([]models.PurchaseOrder, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]models.PurchaseOrder, 0)
+	for _, po := range m.purchaseOrders {
+		if status != "" && po.Status != status {
+			continue
+		}
+		if supplierID != nil && po.SupplierID != *supplierID {
+			continue
+		}
+		out = append(out, copyPurchaseOrder(po))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return idLess(out[j].ID, out[i].ID)
+	})
+	return out, nil
+}
+
+func (m *MemoryRepo) DeletePurchaseOrder(ctx context.Context, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	po, ok := m.purchaseOrders[id]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	if po.Status != models.PurchaseDraft {
+		return fmt.Errorf("%w: it is %s", ErrPurchaseState, po.Status)
+	}
+	delete(m.purchaseOrders, id)
+	return nil
+}
+
+func (m *MemoryRepo) SendPurchaseOrder(ctx context.Context, id primitive.ObjectID) (models.PurchaseOrder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	po, ok := m.purchaseOrders[id]
+	if !ok {
+		return models.PurchaseOrder{}, mongo.ErrNoDocuments
+	}
+	sup, ok := m.suppliers[po.SupplierID]
+	if !ok {
+		return models.PurchaseOrder{}, mongo.ErrNoDocuments
+	}
+	if po.Status != models.PurchaseDraft {
+		return models.PurchaseOrder{}, fmt.Errorf("%w: it is %s", ErrPurchaseState, po.Status)
+	}
+	now := time.Now()
+	expected := now.AddDate(0, 0, sup.LeadTimeDays)
+	po = copyPurchaseOrder(po)
+	po.Status = models.PurchaseSent
+	po.SentAt, po.ExpectedAt = &now, &expected
+	po.UpdatedAt = now
+	m.purchaseOrders[id] = po
+	return copyPurchaseOrder(po), nil
+}
+
+func (m *MemoryRepo) ReceivePurchaseOrder(ctx context.Context, id primitive.ObjectID, warehouseID *primitive.ObjectID, received map[primitive.ObjectID]int, actor string) (models.PurchaseOrder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	po, ok := m.purchaseOrders[id]
+	if !ok {
+		return models.PurchaseOrder{}, mongo.ErrNoDocuments
+	}
+	if err := checkReceipt(po, received); err != nil {
+		return models.PurchaseOrder{}, err
+	}
+
+	po = copyPurchaseOrder(po)
+	if po.WarehouseID == nil {
+		po.WarehouseID = warehouseID
+	}
+	for pid, n := range received {
+		levels := len(m.partInventoryLocked(pid))
+		if po.WarehouseID == nil && levels > 0 {
+			return models.PurchaseOrder{}, ErrReceiptWarehouse
+		}
+		// a first level takes over the part's stock, which cannot hold
+		// anything outside a warehouse
+		if po.WarehouseID != nil && levels == 0 && n > 0 && m.parts[pid].Reserved > 0 {
+			return models.PurchaseOrder{}, ErrUnallocatedHolds
+		}
+	}
+	now := time.Now()
+	completed := po.Receive(received, now)
+	var undo []func() // nothing below can fail, so this is never replayed
+	var changed []primitive.ObjectID
+	for _, l := range po.Lines {
+		n := received[l.PartID]
+		if n <= 0 {
+			continue
+		}
+		changed = append(changed, l.PartID)
+		if po.WarehouseID != nil {
+			if len(m.partInventoryLocked(l.PartID)) == 0 {
+				m.moveInventoryLocked(*po.WarehouseID, l.PartID, m.parts[l.PartID].Stock, &undo)
+			}
+			m.moveInventoryLocked(*po.WarehouseID, l.PartID, n, &undo)
+		}
+		m.addStockLocked(l.PartID, n)
+	}
+	for _, l := range completed {
+		if l.AlertID == nil {
+			continue
+		}
+		if a, ok := m.alerts[*l.AlertID]; ok && a.Current {
+			a.SetStatus(models.AlertResolved, actor, now)
+			m.alerts[a.ID] = a
+		}
+	}
+	m.purchaseOrders[id] = po
+	m.stockChangedLocked(changed...)
+	return copyPurchaseOrder(po), nil
+}
+
+func (m *MemoryRepo) PendingPurchaseAlertIDs(ctx context.Context) (map[primitive.ObjectID]bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	open := make([]models.PurchaseOrder, 0)
+	for _, po := range m.purchaseOrders {
+		if po.Status != models.PurchaseReceived {
+			open = append(open, po)
+		}
+	}
+	return pendingAlertIDs(open), nil
+}
+
+func (m *MemoryRepo) OnOrderByPart(ctx context.Context) (map[primitive.ObjectID]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	open := make([]models.PurchaseOrder, 0)
+	for _, po := range m.purchaseOrders {
+		if po.Status != models.PurchaseReceived {
+			open = append(open, po)
+		}
+	}
+	return outstandingByPart(open), nil
+}
+
+func copySupplier(s models.Supplier) models.Supplier {
+	s.Prices = append([]models.SupplierPrice{}, s.Prices...)
+	return s
+}
+
+func copyPurchaseOrder(po models.PurchaseOrder) models.PurchaseOrder {
+	po.Lines = append([]models.PurchaseOrderLine{}, po.Lines...)
+	return po
+}
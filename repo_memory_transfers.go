@@ -0,0 +1,122 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// -------- transfers --------
+func (m *MemoryRepo) CreateTransfer(ctx context.Context, t models.StockTransfer) (models.StockTransfer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t.ID = primitive.NewObjectID()
+	if t.Discrepancies == nil {
+		t.Discrepancies = []models.TransferDiscrepancy{}
+	}
+	m.transfers[t.ID] = copyTransfer(t)
+	return t, nil
+}
+
+func (m *MemoryRepo) GetTransfer(ctx context.Context, id primitive.ObjectID) (models.StockTransfer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, ok := m.transfers[id]
+	if !ok {
+		return models.StockTransfer{}, mongo.ErrNoDocuments
+	}
+	return copyTransfer(t), nil
+}
+
+func (m *MemoryRepo) ListTransfers(ctx context.Context, status string) ([]models.StockTransfer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]models.StockTransfer, 0)
+	for _, t := range m.transfers {
+		if status != "" && t.Status != status {
+			continue
+		}
+		out = append(out, copyTransfer(t))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return idLess(out[j].ID, out[i].ID)
+	})
+	return out, nil
+}
+
+func (m *MemoryRepo) DispatchTransfer(ctx context.Context, id primitive.ObjectID) (models.StockTransfer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.transfers[id]
+	if !ok {
+		return models.StockTransfer{}, mongo.ErrNoDocuments
+	}
+	if t.Status != models.TransferDraft {
+		return models.StockTransfer{}, fmt.Errorf("%w: it is %s", ErrTransferState, t.Status)
+	}
+
+	var undo []func()
+	for _, l := range t.Lines {
+		k := inventoryKey{t.FromWarehouseID, l.PartID}
+		if m.inventory[k].Available() < l.Quantity {
+			rollbackLocked(undo)
+			return models.StockTransfer{}, fmt.Errorf("part %s: %w", l.PartID.Hex(), ErrNotEnoughStock)
+		}
+		m.moveInventoryLocked(t.FromWarehouseID, l.PartID, -l.Quantity, &undo)
+		m.addStockLocked(l.PartID, -l.Quantity)
+		l := l
+		undo = append(undo, func() { m.addStockLocked(l.PartID, l.Quantity) })
+	}
+
+	now := time.Now()
+	t.Status = models.TransferInTransit
+	t.DispatchedAt = &now
+	m.transfers[id] = t
+	m.stockChangedLocked(t.PartIDs()...)
+	return copyTransfer(t), nil
+}
+
+func (m *MemoryRepo) ReceiveTransfer(ctx context.Context, id primitive.ObjectID, received map[primitive.ObjectID]int) (models.StockTransfer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.transfers[id]
+	if !ok {
+		return models.StockTransfer{}, mongo.ErrNoDocuments
+	}
+	if t.Status != models.TransferInTransit {
+		return models.StockTransfer{}, fmt.Errorf("%w: it is %s", ErrTransferState, t.Status)
+	}
+
+	t = copyTransfer(t)
+	t.Receive(received, time.Now())
+	var undo []func() // nothing below can fail, so this is never replayed
+	for _, l := range t.Lines {
+		if l.ReceivedQuantity == 0 {
+			continue
+		}
+		m.moveInventoryLocked(t.ToWarehouseID, l.PartID, l.ReceivedQuantity, &undo)
+		m.addStockLocked(l.PartID, l.ReceivedQuantity)
+	}
+	m.transfers[id] = t
+	m.stockChangedLocked(t.PartIDs()...)
+	return copyTransfer(t), nil
+}
+
+func copyTransfer(t models.StockTransfer) models.StockTransfer {
+	t.Lines = append([]models.TransferLine{}, t.Lines...)
+	t.Discrepancies = append([]models.TransferDiscrepancy{}, t.Discrepancies...)
+	return t
+}
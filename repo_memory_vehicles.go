@@ -0,0 +1,208 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// -------- vehicles --------
+func (m *MemoryRepo) CreateVehicle(ctx context.Context, v models.Vehicle) (models.Vehicle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v.Normalize()
+	v.ID = primitive.NewObjectID()
+	m.vehicles[v.ID] = v
+	return v, nil
+}
+
+func (m *MemoryRepo) GetVehicle(ctx context.Context, id primitive.ObjectID) (models.Vehicle, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	v, ok := m.vehicles[id]
+	if !ok {
+		return models.Vehicle{}, mongo.ErrNoDocuments
+	}
+	return v, nil
+}
+
+func (m *MemoryRepo) ListVehicles(ctx context.Context, f VehicleFilter) ([]models.Vehicle, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]models.Vehicle, 0)
+	for _, v := range m.vehicles {
+		if vehicleMatches(f, v) {
+			out = append(out, v)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		switch {
+		case a.MakeKey != b.MakeKey:
+			return a.MakeKey < b.MakeKey
+		case a.ModelKey != b.ModelKey:
+			return a.ModelKey < b.ModelKey
+		case a.YearFrom != b.YearFrom:
+			return a.YearFrom < b.YearFrom
+		}
+		return idLess(a.ID, b.ID)
+	})
+	return out, nil
+}
+
+func (m *MemoryRepo) ReplaceVehicle(ctx context.Context, v models.Vehicle) (models.Vehicle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.vehicles[v.ID]; !ok {
+		return models.Vehicle{}, mongo.ErrNoDocuments
+	}
+	v.Normalize()
+	m.vehicles[v.ID] = v
+	return v, nil
+}
+
+func (m *MemoryRepo) DeleteVehicle(ctx context.Context, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.vehicles[id]; !ok {
+		return mongo.ErrNoDocuments
+	}
+	delete(m.vehicles, id)
+	for fid, f := range m.fitments {
+		if f.VehicleID == id {
+			delete(m.fitments, fid)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryRepo) ListVehicleMakes(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.vehicleNamesLocked("", func(v models.Vehicle) (string, string) { return v.MakeKey, v.Make }), nil
+}
+
+func (m *MemoryRepo) ListVehicleModels(ctx context.Context, vehicleMake string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.vehicleNamesLocked(models.VehicleKey(vehicleMake), func(v models.Vehicle) (string, string) { return v.ModelKey, v.Model }), nil
+}
+
+// vehicleNamesLocked mirrors Repo.vehicleNames; makeKey, when set, keeps
+// only that make.
+func (m *MemoryRepo) vehicleNamesLocked(makeKey string, name func(models.Vehicle) (key, name string)) []string {
+	vehicles := make([]models.Vehicle, 0, len(m.vehicles))
+	for _, v := range m.vehicles {
+		if makeKey == "" || v.MakeKey == makeKey {
+			vehicles = append(vehicles, v)
+		}
+	}
+	sort.Slice(vehicles, func(i, j int) bool { return idLess(vehicles[i].ID, vehicles[j].ID) })
+
+	byKey := map[string]string{}
+	keys := make([]string, 0)
+	for _, v := range vehicles {
+		k, n := name(v)
+		if _, seen := byKey[k]; !seen {
+			byKey[k] = n
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, byKey[k])
+	}
+	return out
+}
+
+// -------- fitments --------
+func (m *MemoryRepo) AddFitment(ctx context.Context, f models.Fitment) (models.Fitment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, cur := range m.fitments {
+		if cur.PartID == f.PartID && cur.VehicleID == f.VehicleID {
+			cur.Note = f.Note
+			m.fitments[id] = cur
+			return cur, nil
+		}
+	}
+	f.ID = primitive.NewObjectID()
+	m.fitments[f.ID] = f
+	return f, nil
+}
+
+func (m *MemoryRepo) RemoveFitment(ctx context.Context, partID, vehicleID primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, f := range m.fitments {
+		if f.PartID == partID && f.VehicleID == vehicleID {
+			delete(m.fitments, id)
+			return nil
+		}
+	}
+	return mongo.ErrNoDocuments
+}
+
+func (m *MemoryRepo) PartFitments(ctx context.Context, partID primitive.ObjectID) ([]models.Fitment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]models.Fitment, 0)
+	for _, f := range m.fitments {
+		if f.PartID == partID {
+			out = append(out, f)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return idLess(out[i].ID, out[j].ID) })
+	return out, nil
+}
+
+func (m *MemoryRepo) FittingPartIDs(ctx context.Context, f VehicleFilter) ([]primitive.ObjectID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := map[primitive.ObjectID]bool{}
+	out := make([]primitive.ObjectID, 0)
+	for _, ft := range m.fitments {
+		v, ok := m.vehicles[ft.VehicleID]
+		if !ok || seen[ft.PartID] || !vehicleMatches(f, v) {
+			continue
+		}
+		seen[ft.PartID] = true
+		out = append(out, ft.PartID)
+	}
+	return out, nil
+}
+
+// vehicleMatches mirrors vehicleQuery.
+func vehicleMatches(f VehicleFilter, v models.Vehicle) bool {
+	switch {
+	case f.Make != "" && v.MakeKey != models.VehicleKey(f.Make):
+		return false
+	case f.Model != "" && v.ModelKey != models.VehicleKey(f.Model):
+		return false
+	case f.Year != 0 && !v.FitsYear(f.Year):
+		return false
+	case f.EngineCode != "" && v.EngineCode != "" && v.EngineCode != models.EngineKey(f.EngineCode):
+		return false
+	case f.BodyType != "" && v.BodyType != "" && v.BodyType != strings.ToLower(f.BodyType):
+		return false
+	case f.IDs != nil && !containsID(f.IDs, v.ID):
+		return false
+	}
+	return true
+}
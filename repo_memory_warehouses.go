@@ -0,0 +1,202 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type inventoryKey struct {
+	warehouseID primitive.ObjectID
+	partID      primitive.ObjectID
+}
+
+// -------- warehouses --------
+func (m *MemoryRepo) CreateWarehouse(ctx context.Context, w models.Warehouse) (models.Warehouse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.ID = primitive.NewObjectID()
+	m.warehouses[w.ID] = w
+	return w, nil
+}
+
+func (m *MemoryRepo) ListWarehouses(ctx context.Context) ([]models.Warehouse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]models.Warehouse, 0, len(m.warehouses))
+	for _, w := range m.warehouses {
+		out = append(out, w)
+	}
+	sort.Slice(out, func(i, j int) bool { return idLess(out[i].ID, out[j].ID) })
+	return out, nil
+}
+
+func (m *MemoryRepo) GetWarehouse(ctx context.Context, id primitive.ObjectID) (models.Warehouse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	w, ok := m.warehouses[id]
+	if !ok {
+		return models.Warehouse{}, mongo.ErrNoDocuments
+	}
+	return w, nil
+}
+
+func (m *MemoryRepo) UpdateWarehouse(ctx context.Context, id primitive.ObjectID, upd bson.M) (models.Warehouse, error) {
+	if len(upd) == 0 {
+		return models.Warehouse{}, errors.New("nothing to update")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, ok := m.warehouses[id]
+	if !ok {
+		return models.Warehouse{}, mongo.ErrNoDocuments
+	}
+	if err := applySet(&w, upd); err != nil {
+		return models.Warehouse{}, err
+	}
+	m.warehouses[id] = w
+	return w, nil
+}
+
+func (m *MemoryRepo) DeleteWarehouse(ctx context.Context, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, l := range m.inventory {
+		if k.warehouseID == id && l.Quantity > 0 {
+			return ErrWarehouseNotEmpty
+		}
+	}
+	for k := range m.inventory {
+		if k.warehouseID == id {
+			delete(m.inventory, k)
+		}
+	}
+	delete(m.warehouses, id)
+	return nil
+}
+
+// -------- inventory --------
+func (m *MemoryRepo) ListInventory(ctx context.Context, warehouseID primitive.ObjectID) ([]models.InventoryLevel, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]models.InventoryLevel, 0)
+	for k, l := range m.inventory {
+		if k.warehouseID == warehouseID {
+			out = append(out, l)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return idLess(out[i].PartID, out[j].PartID) })
+	return out, nil
+}
+
+func (m *MemoryRepo) PartInventory(ctx context.Context, partID primitive.ObjectID) ([]models.InventoryLevel, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.partInventoryLocked(partID), nil
+}
+
+func (m *MemoryRepo) partInventoryLocked(partID primitive.ObjectID) []models.InventoryLevel {
+	out := make([]models.InventoryLevel, 0)
+	for k, l := range m.inventory {
+		if k.partID == partID {
+			out = append(out, l)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Quantity != out[j].Quantity {
+			return out[i].Quantity > out[j].Quantity
+		}
+		return idLess(out[i].WarehouseID, out[j].WarehouseID)
+	})
+	return out
+}
+
+func (m *MemoryRepo) SetStock(ctx context.Context, warehouseID, partID primitive.ObjectID, qty int) (models.InventoryLevel, error) {
+	if qty < 0 {
+		return models.InventoryLevel{}, errors.New("quantity must be >= 0")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.parts[partID]
+	if !ok {
+		return models.InventoryLevel{}, mongo.ErrNoDocuments
+	}
+	k := inventoryKey{warehouseID, partID}
+	l := m.inventory[k]
+	if l.Reserved > qty {
+		return models.InventoryLevel{}, ErrBelowReserved
+	}
+	if len(m.partInventoryLocked(partID)) > 0 {
+		p.Stock += qty - l.Quantity
+	} else {
+		// the first level takes over the stock the part was counted with
+		if p.Reserved > 0 {
+			return models.InventoryLevel{}, ErrUnallocatedHolds
+		}
+		p.Stock = qty
+	}
+	m.parts[partID] = p
+
+	if l.ID.IsZero() {
+		l = models.InventoryLevel{ID: primitive.NewObjectID(), WarehouseID: warehouseID, PartID: partID}
+	}
+	l.Quantity = qty
+	l.UpdatedAt = time.Now()
+	m.inventory[k] = l
+	m.stockChangedLocked(partID)
+	return l, nil
+}
+
+// returnLineLocked puts a fulfilled line back where it came from.
+func (m *MemoryRepo) returnLineLocked(it models.OrderItem, undo *[]func()) {
+	if it.WarehouseID != nil {
+		m.moveInventoryLocked(*it.WarehouseID, it.PartID, it.Quantity, undo)
+	}
+	m.addStockLocked(it.PartID, it.Quantity)
+	*undo = append(*undo, func() { m.addStockLocked(it.PartID, -it.Quantity) })
+}
+
+func (m *MemoryRepo) addStockLocked(partID primitive.ObjectID, delta int) {
+	if p, ok := m.parts[partID]; ok {
+		p.Stock += delta
+		m.parts[partID] = p
+	}
+}
+
+func (m *MemoryRepo) moveInventoryLocked(warehouseID, partID primitive.ObjectID, delta int, undo *[]func()) {
+	k := inventoryKey{warehouseID, partID}
+	l, ok := m.inventory[k]
+	if !ok {
+		l = models.InventoryLevel{ID: primitive.NewObjectID(), WarehouseID: warehouseID, PartID: partID}
+	}
+	l.Quantity += delta
+	l.UpdatedAt = time.Now()
+	m.inventory[k] = l
+	*undo = append(*undo, func() {
+		l := m.inventory[k]
+		l.Quantity -= delta
+		m.inventory[k] = l
+	})
+}
+
+func rollbackLocked(undo []func()) {
+	for i := len(undo) - 1; i >= 0; i-- {
+		undo[i]()
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// -------- webhooks --------
+func (m *MemoryRepo) CreateWebhook(ctx context.Context, s models.WebhookSubscription) (models.WebhookSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s.ID = primitive.NewObjectID()
+	s.Events = append([]string{}, s.Events...)
+	m.webhooks[s.ID] = s
+	return s, nil
+}
+
+func (m *MemoryRepo) ListWebhooks(ctx context.Context) ([]models.WebhookSubscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]models.WebhookSubscription, 0, len(m.webhooks))
+	for _, s := range m.webhooks {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (m *MemoryRepo) GetWebhook(ctx context.Context, id primitive.ObjectID) (models.WebhookSubscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.webhooks[id]
+	if !ok {
+		return models.WebhookSubscription{}, mongo.ErrNoDocuments
+	}
+	return s, nil
+}
+
+func (m *MemoryRepo) UpdateWebhook(ctx context.Context, id primitive.ObjectID, upd bson.M) (models.WebhookSubscription, error) {
+	if len(upd) == 0 {
+		return models.WebhookSubscription{}, errors.New("nothing to update")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.webhooks[id]
+	if !ok {
+		return models.WebhookSubscription{}, mongo.ErrNoDocuments
+	}
+	if err := applySet(&s, upd); err != nil {
+		return models.WebhookSubscription{}, err
+	}
+	m.webhooks[id] = s
+	return s, nil
+}
+
+func (m *MemoryRepo) DeleteWebhook(ctx context.Context, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[id]; !ok {
+		return mongo.ErrNoDocuments
+	}
+	delete(m.webhooks, id)
+	return nil
+}
+
+func (m *MemoryRepo) EnqueueWebhookDeliveries(ctx context.Context, eventID, event string, payload []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queued := map[primitive.ObjectID]bool{}
+	for _, d := range m.deliveries {
+		if d.EventID == eventID {
+			queued[d.SubscriptionID] = true
+		}
+	}
+
+	n := 0
+	now := time.Now()
+	for _, s := range m.webhooks {
+		if !s.Active || !s.Wants(event) || queued[s.ID] {
+			continue
+		}
+		d := models.NewWebhookDelivery(s.ID, eventID, event, payload, webhookMaxAttempts, now)
+		m.deliveries[d.ID] = d
+		n++
+	}
+	if n > 0 {
+		m.notifyWebhooks()
+	}
+	return n, nil
+}
+
+func (m *MemoryRepo) CreateWebhookDelivery(ctx context.Context, d models.WebhookDelivery) (models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if d.ID.IsZero() {
+		d.ID = primitive.NewObjectID()
+	}
+	m.deliveries[d.ID] = d
+	return d, nil
+}
+
+func (m *MemoryRepo) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, n int) ([]models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	due := make([]models.WebhookDelivery, 0)
+	for _, d := range m.deliveries {
+		if d.Status != models.DeliveryPending || d.NextAttemptAt.After(now) ||
+			(d.LockedUntil != nil && d.LockedUntil.After(now)) {
+			continue
+		}
+		due = append(due, d)
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > n {
+		due = due[:n]
+	}
+	until := now.Add(lease)
+	for i := range due {
+		due[i].LockedUntil = &until
+		m.deliveries[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (m *MemoryRepo) SaveWebhookDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d.LockedUntil = nil
+	m.deliveries[d.ID] = d
+	return nil
+}
+
+func (m *MemoryRepo) ListWebhookDeliveries(ctx context.Context, subscriptionID primitive.ObjectID, limit int64) ([]models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]models.WebhookDelivery, 0)
+	for _, d := range m.deliveries {
+		if d.SubscriptionID == subscriptionID {
+			out = append(out, d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return idLess(out[j].ID, out[i].ID)
+	})
+	if limit > 0 && int64(len(out)) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (m *MemoryRepo) notifyWebhooks() {
+	select {
+	case m.webhookCh <- struct{}{}:
+	default:
+	}
+}
+
+func (m *MemoryRepo) WebhookSignal() <-chan struct{} {
+	return m.webhookCh
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// -------- outbox --------
+
+// stockChanged records, inside the caller's unit, that the parts' stock or
+// thresholds moved. The low-stock worker picks the event up once the unit
+// has committed.
+func (r *Repo) stockChanged(ctx context.Context, s *txScope, ids ...primitive.ObjectID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.enqueue(ctx, s, models.NewStockChangedEvent(ids, time.Now()))
+}
+
+// orderChanged records, inside the caller's unit, that the order was placed
+// or moved to a new status.
+func (r *Repo) orderChanged(ctx context.Context, s *txScope, topic string, o models.Order) error {
+	return r.enqueue(ctx, s, models.NewOrderEvent(topic, o.ID, o.Status, time.Now()))
+}
+
+func (r *Repo) enqueue(ctx context.Context, s *txScope, ev models.OutboxEvent) error {
+	if _, err := r.outbox.InsertOne(ctx, ev); err != nil {
+		return err
+	}
+	s.Compensate(func(ctx context.Context) error {
+		_, err := r.outbox.DeleteOne(ctx, bson.M{"_id": ev.ID})
+		return err
+	})
+	s.OnCommit(r.notifyOutbox)
+	return nil
+}
+
+// notifyOutbox wakes the worker without ever blocking the writer; a missed
+// nudge only delays delivery until the next poll.
+func (r *Repo) notifyOutbox() {
+	select {
+	case r.outboxCh <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Repo) OutboxSignal() <-chan struct{} {
+	return r.outboxCh
+}
+
+func (r *Repo) ClaimOutbox(ctx context.Context, now time.Time, lease time.Duration, n int) ([]models.OutboxEvent, error) {
+	out := make([]models.OutboxEvent, 0, n)
+	for len(out) < n {
+		var ev models.OutboxEvent
+		err := r.outbox.FindOneAndUpdate(ctx,
+			bson.M{
+				"next_attempt_at": bson.M{"$lte": now},
+				"$or": bson.A{
+					bson.M{"locked_until": bson.M{"$exists": false}},
+					bson.M{"locked_until": bson.M{"$lte": now}},
+				},
+			},
+			bson.M{"$set": bson.M{"locked_until": now.Add(lease)}},
+			options.FindOneAndUpdate().
+				SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+				SetReturnDocument(options.After),
+		).Decode(&ev)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, ev)
+	}
+	return out, nil
+}
+
+func (r *Repo) CompleteOutbox(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.outbox.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (r *Repo) RetryOutbox(ctx context.Context, id primitive.ObjectID, lastErr string, at time.Time) error {
+	_, err := r.outbox.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$inc":   bson.M{"attempts": 1},
+		"$set":   bson.M{"next_attempt_at": at, "last_error": lastErr},
+		"$unset": bson.M{"locked_until": ""},
+	})
+	return err
+}
+
+func (r *Repo) DeadLetterOutbox(ctx context.Context, id primitive.ObjectID, lastErr string) error {
+	return r.atomically(ctx, func(ctx context.Context, s *txScope) error {
+		var ev models.OutboxEvent
+		if err := r.outbox.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&ev); err != nil {
+			return err
+		}
+		s.Compensate(func(ctx context.Context) error {
+			_, err := r.outbox.InsertOne(ctx, ev)
+			return err
+		})
+
+		now := time.Now()
+		ev.Attempts++
+		ev.LastError = lastErr
+		ev.LockedUntil = nil
+		ev.DeadAt = &now
+		_, err := r.deadLetters.InsertOne(ctx, ev)
+		return err
+	})
+}
+
+func (r *Repo) ListDeadLetters(ctx context.Context, limit int64) ([]models.OutboxEvent, error) {
+	opts := options.Find().SetSort(bson.M{"dead_at": -1})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cur, err := r.deadLetters.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := make([]models.OutboxEvent, 0)
+	for cur.Next(ctx) {
+		var ev models.OutboxEvent
+		if err := cur.Decode(&ev); err != nil {
+			return nil, err
+		}
+		out = append(out, ev)
+	}
+	return out, nil
+}
+
+// RequeueDeadLetter moves a dead letter back into the outbox with a fresh
+// attempt budget.
+func (r *Repo) RequeueDeadLetter(ctx context.Context, id primitive.ObjectID) (models.OutboxEvent, error) {
+	var ev models.OutboxEvent
+	err := r.atomically(ctx, func(ctx context.Context, s *txScope) error {
+		if err := r.deadLetters.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&ev); err != nil {
+			return err
+		}
+		dead := ev
+		s.Compensate(func(ctx context.Context) error {
+			_, err := r.deadLetters.InsertOne(ctx, dead)
+			return err
+		})
+
+		ev.Attempts = 0
+		ev.NextAttemptAt = time.Now()
+		ev.DeadAt = nil
+		_, err := r.outbox.InsertOne(ctx, ev)
+		return err
+	})
+	if err != nil {
+		return models.OutboxEvent{}, err
+	}
+	r.notifyOutbox()
+	return ev, nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrBelowReserved = errors.New("quantity is below what is reserved for unpaid orders")
+
+// availableAtLeast is an $expr that holds when qtyField minus the reserved
+// amount is at least n. Documents written before reservations existed have
+// no reserved field, which counts as zero.
+func availableAtLeast(qtyField string, n int) bson.M {
+	return bson.M{"$gte": bson.A{
+		bson.M{"$subtract": bson.A{"$" + qtyField, bson.M{"$ifNull": bson.A{"$reserved", 0}}}},
+		n,
+	}}
+}
+
+// reserveLine holds it.Quantity of it.PartID for an unpaid order. With
+// it.WarehouseID set only that warehouse is tried, and refused with
+// ErrWarehouseInactive if it is deactivated; otherwise the active warehouse
+// holding the most stock that can promise the whole line is chosen. Parts
+// with no warehouse levels at all are held on SparePart alone.
+func (r *Repo) reserveLine(ctx context.Context, s *txScope, it *models.OrderItem) (models.SparePart, error) {
+	var candidates []primitive.ObjectID
+	if it.WarehouseID != nil {
+		var wh models.Warehouse
+		err := r.warehouses.FindOne(ctx, bson.M{"_id": *it.WarehouseID}).Decode(&wh)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return models.SparePart{}, err
+		}
+		if err == nil && !wh.IsActive {
+			return models.SparePart{}, fmt.Errorf("warehouse %s: %w", wh.ID.Hex(), ErrWarehouseInactive)
+		}
+		candidates = []primitive.ObjectID{*it.WarehouseID}
+	} else {
+		levels, err := r.PartInventory(ctx, it.PartID)
+		if err != nil {
+			return models.SparePart{}, err
+		}
+		if len(levels) == 0 {
+			return r.holdPart(ctx, s, it.PartID, it.Quantity)
+		}
+		active, err := r.activeWarehouses(ctx)
+		if err != nil {
+			return models.SparePart{}, err
+		}
+		for _, l := range levels {
+			if active[l.WarehouseID] && l.Available() >= it.Quantity {
+				candidates = append(candidates, l.WarehouseID)
+			}
+		}
+	}
+
+	for _, wid := range candidates {
+		res, err := r.inventory.UpdateOne(ctx,
+			bson.M{"warehouse_id": wid, "part_id": it.PartID, "$expr": availableAtLeast("quantity", it.Quantity)},
+			bson.M{"$inc": bson.M{"reserved": it.Quantity}, "$set": bson.M{"updated_at": time.Now()}},
+		)
+		if err != nil {
+			return models.SparePart{}, err
+		}
+		if res.ModifiedCount == 0 {
+			continue // drained concurrently, try the next one
+		}
+		wid, qty := wid, it.Quantity
+		s.Compensate(func(ctx context.Context) error {
+			_, err := r.inventory.UpdateOne(ctx,
+				bson.M{"warehouse_id": wid, "part_id": it.PartID},
+				bson.M{"$inc": bson.M{"reserved": -qty}})
+			return err
+		})
+
+		p, err := r.holdPart(ctx, s, it.PartID, it.Quantity)
+		if err != nil {
+			return models.SparePart{}, err
+		}
+		it.WarehouseID = &wid
+		return p, nil
+	}
+	return models.SparePart{}, fmt.Errorf("part %s: %w", it.PartID.Hex(), ErrNotEnoughStock)
+}
+
+// activeWarehouses lists the warehouses orders may be fulfilled from.
+func (r *Repo) activeWarehouses(ctx context.Context) (map[primitive.ObjectID]bool, error) {
+	cur, err := r.warehouses.Find(ctx, bson.M{"is_active": true}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	out := map[primitive.ObjectID]bool{}
+	for cur.Next(ctx) {
+		var wh models.Warehouse
+		if err := cur.Decode(&wh); err != nil {
+			return nil, err
+		}
+		out[wh.ID] = true
+	}
+	return out, cur.Err()
+}
+
+// holdPart is the guarded SparePart.Reserved increment with its compensation.
+func (r *Repo) holdPart(ctx context.Context, s *txScope, partID primitive.ObjectID, qty int) (models.SparePart, error) {
+	var p models.SparePart
+	err := r.parts.FindOneAndUpdate(ctx,
+		bson.M{"_id": partID, "is_active": true, "$expr": availableAtLeast("stock", qty)},
+		bson.M{"$inc": bson.M{"reserved": qty}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&p)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.SparePart{}, fmt.Errorf("part %s: %w", partID.Hex(), ErrNotEnoughStock)
+		}
+		return models.SparePart{}, err
+	}
+	s.Compensate(func(ctx context.Context) error {
+		_, err := r.parts.UpdateOne(ctx, bson.M{"_id": partID}, bson.M{"$inc": bson.M{"reserved": -qty}})
+		return err
+	})
+	return p, nil
+}
+
+// settleHolds moves every active hold of an order to status: committed
+// takes the held quantity out of stock, released gives it back to
+// available-to-promise. Each hold is settled at most once.
+func (r *Repo) settleHolds(ctx context.Context, s *txScope, orderID primitive.ObjectID, status string) error {
+	cur, err := r.reservations.Find(ctx, bson.M{"order_id": orderID, "status": models.ReservationActive})
+	if err != nil {
+		return err
+	}
+	var holds []models.Reservation
+	if err := cur.All(ctx, &holds); err != nil {
+		return err
+	}
+
+	for _, h := range holds {
+		res, err := r.reservations.UpdateOne(ctx,
+			bson.M{"_id": h.ID, "status": models.ReservationActive},
+			bson.M{"$set": bson.M{"status": status}})
+		if err != nil {
+			return err
+		}
+		if res.ModifiedCount == 0 {
+			continue
+		}
+		h := h
+		s.Compensate(func(ctx context.Context) error {
+			_, err := r.reservations.UpdateOne(ctx, bson.M{"_id": h.ID},
+				bson.M{"$set": bson.M{"status": models.ReservationActive}})
+			return err
+		})
+
+		taken := 0
+		if status == models.ReservationCommitted {
+			taken = h.Quantity
+		}
+		if err := r.shiftStock(ctx, h.WarehouseID, h.PartID, -taken, -h.Quantity); err != nil {
+			return err
+		}
+		s.Compensate(func(ctx context.Context) error {
+			return r.shiftStock(ctx, h.WarehouseID, h.PartID, taken, h.Quantity)
+		})
+	}
+	return nil
+}
+
+// shiftStock adds the deltas to the part and, when warehouseID is set, to
+// its level there.
+func (r *Repo) shiftStock(ctx context.Context, warehouseID *primitive.ObjectID, partID primitive.ObjectID, stock, reserved int) error {
+	_, err := r.parts.UpdateOne(ctx, bson.M{"_id": partID},
+		bson.M{"$inc": bson.M{"stock": stock, "reserved": reserved}})
+	if err != nil || warehouseID == nil {
+		return err
+	}
+	_, err = r.inventory.UpdateOne(ctx,
+		bson.M{"warehouse_id": *warehouseID, "part_id": partID},
+		bson.M{"$inc": bson.M{"quantity": stock, "reserved": reserved}, "$set": bson.M{"updated_at": time.Now()}})
+	return err
+}
+
+// ReleaseExpiredReservations cancels every order whose holds ran out before
+// it was paid; CancelOrder releases the holds in the same unit.
+func (r *Repo) ReleaseExpiredReservations(ctx context.Context, now time.Time) (int, error) {
+	ids, err := r.reservations.Distinct(ctx, "order_id",
+		bson.M{"status": models.ReservationActive, "expires_at": bson.M{"$lte": now}})
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	var firstErr error
+	for _, v := range ids {
+		oid, ok := v.(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		_, err := r.CancelOrder(ctx, oid, models.ActorSystem)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// the order is gone; free its holds on their own
+			err = r.atomically(ctx, func(ctx context.Context, s *txScope) error {
+				return r.settleHolds(ctx, s, oid, models.ReservationReleased)
+			})
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		n++
+	}
+	return n, firstErr
+}
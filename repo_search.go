@@ -0,0 +1,181 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The search_terms collection counts, for every search term, the active
+// parts that have it: {_id: term, parts: n}. Part writes keep it current
+// inside their own transaction, so every instance expands query words
+// against the same vocabulary and ranks with the same document frequencies.
+// The document whose id is searchTotalKey, which no term can be, counts the
+// active parts. Terms no part has any more stay behind with a count of zero.
+
+const searchTotalKey = ""
+
+// searchVocabTTL is how long an instance expands query words against the
+// vocabulary it last read before reading it again. Its own writes make it
+// read at once; other instances' writes show up within the TTL.
+const searchVocabTTL = 30 * time.Second
+
+// vocabCache is the vocabulary as last read from search_terms.
+type vocabCache struct {
+	mu     sync.Mutex
+	terms  []vocabTerm
+	loaded time.Time
+}
+
+func (c *vocabCache) invalidate() {
+	c.mu.Lock()
+	c.loaded = time.Time{}
+	c.mu.Unlock()
+}
+
+// searchVocabulary lists the terms active parts have, which query words are
+// expanded against. It is shared between callers, who must not change it.
+func (r *Repo) searchVocabulary(ctx context.Context) ([]vocabTerm, error) {
+	c := &r.vocab
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.terms != nil && time.Since(c.loaded) < searchVocabTTL {
+		return c.terms, nil
+	}
+
+	opts := options.Find().SetProjection(bson.M{"_id": 1}).SetSort(bson.M{"_id": 1})
+	cur, err := r.searchTerms.Find(ctx, bson.M{"parts": bson.M{"$gt": 0}, "_id": bson.M{"$ne": searchTotalKey}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	terms := make([]string, 0)
+	for cur.Next(ctx) {
+		var row struct {
+			Term string `bson:"_id"`
+		}
+		if err := cur.Decode(&row); err != nil {
+			return nil, err
+		}
+		terms = append(terms, row.Term)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+	c.terms, c.loaded = newVocabulary(terms), time.Now()
+	return c.terms, nil
+}
+
+// termFrequencies returns how many active parts have each of terms, and how
+// many active parts there are.
+func (r *Repo) termFrequencies(ctx context.Context, terms []string) (map[string]int, int, error) {
+	ids := append([]string{searchTotalKey}, terms...)
+	cur, err := r.searchTerms.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+	df := make(map[string]int, len(terms))
+	total := 0
+	for cur.Next(ctx) {
+		var row struct {
+			Term  string `bson:"_id"`
+			Parts int    `bson:"parts"`
+		}
+		if err := cur.Decode(&row); err != nil {
+			return nil, 0, err
+		}
+		if row.Term == searchTotalKey {
+			total = row.Parts
+		} else if row.Parts > 0 {
+			df[row.Term] = row.Parts
+		}
+	}
+	return df, total, cur.Err()
+}
+
+// recountSearchTerms moves a part's counts in search_terms from the terms
+// before had to those after has. An inactive part, or the zero part for one
+// created or deleted, counts for nothing.
+func (r *Repo) recountSearchTerms(ctx context.Context, s *txScope, before, after models.SparePart) error {
+	delta := map[string]int{}
+	count := func(p models.SparePart, by int) {
+		if !p.IsActive {
+			return
+		}
+		delta[searchTotalKey] += by
+		for _, t := range p.SearchTerms {
+			delta[t] += by
+		}
+	}
+	count(before, -1)
+	count(after, 1)
+	vocabMoved := false
+	for t, n := range delta {
+		vocabMoved = vocabMoved || n != 0 && t != searchTotalKey
+	}
+
+	inc := func(ctx context.Context, sign int) error {
+		var writes []mongo.WriteModel
+		for t, n := range delta {
+			if n == 0 {
+				continue
+			}
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": t}).
+				SetUpdate(bson.M{"$inc": bson.M{"parts": sign * n}}).
+				SetUpsert(true))
+		}
+		if len(writes) == 0 {
+			return nil
+		}
+		_, err := r.searchTerms.BulkWrite(ctx, writes)
+		return err
+	}
+	if err := inc(ctx, 1); err != nil {
+		return err
+	}
+	s.Compensate(func(ctx context.Context) error { return inc(ctx, -1) })
+	s.OnCommit(func() {
+		if vocabMoved {
+			r.vocab.invalidate()
+		}
+	})
+	return nil
+}
+
+// countSearchTerms fills an empty search_terms from the parts' stored
+// terms, for a database that predates it.
+func (r *Repo) countSearchTerms(ctx context.Context) error {
+	n, err := r.searchTerms.CountDocuments(ctx, bson.M{})
+	if err != nil || n > 0 {
+		return err
+	}
+	active := bson.M{"is_active": true}
+	cur, err := r.parts.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: active}},
+		{{Key: "$unwind", Value: "$search_terms"}},
+		{{Key: "$group", Value: bson.M{"_id": "$search_terms", "parts": bson.M{"$sum": 1}}}},
+		{{Key: "$merge", Value: bson.M{"into": r.searchTerms.Name(), "whenMatched": "replace"}}},
+	})
+	if err != nil {
+		return err
+	}
+	cur.Close(ctx)
+	total, err := r.parts.CountDocuments(ctx, active)
+	if err != nil {
+		return err
+	}
+	_, err = r.searchTerms.UpdateOne(ctx, bson.M{"_id": searchTotalKey},
+		bson.M{"$set": bson.M{"parts": total}}, options.Update().SetUpsert(true))
+	if err == nil {
+		log.Printf("search: counted the terms of %d parts", total)
+	}
+	return err
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrSupplierInUse = errors.New("supplier has purchase orders")
+	// ErrPurchaseState is wrapped with the status the order was found in.
+	ErrPurchaseState = errors.New("purchase order is not in the required state")
+	// ErrOverReceipt is wrapped with the part that got more than is
+	// outstanding on its line.
+	ErrOverReceipt = errors.New("received more than is outstanding")
+	// ErrReceiptWarehouse refuses goods that would raise a part's stock
+	// outside the warehouses it is stocked in.
+	ErrReceiptWarehouse = errors.New("part is stocked per warehouse, say which warehouse the goods arrived at")
+)
+
+// openPurchaseStatuses are the states in which a purchase order still has
+// goods to come.
+var openPurchaseStatuses = []string{models.PurchaseDraft, models.PurchaseSent, models.PurchasePartiallyReceived}
+
+// -------- suppliers --------
+func (r *Repo) CreateSupplier(ctx context.Context, s models.Supplier) (models.Supplier, error) {
+	if s.Prices == nil {
+		s.Prices = []models.SupplierPrice{}
+	}
+	res, err := r.suppliers.InsertOne(ctx, s)
+	if err != nil {
+		return models.Supplier{}, err
+	}
+	s.ID = res.InsertedID.(primitive.ObjectID)
+	return s, nil
+}
+
+func (r *Repo) ListSuppliers(ctx context.Context) ([]models.Supplier, error) {
+	cur, err := r.suppliers.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := make([]models.Supplier, 0)
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *Repo) GetSupplier(ctx context.Context, id primitive.ObjectID) (models.Supplier, error) {
+	var s models.Supplier
+	err := r.suppliers.FindOne(ctx, bson.M{"_id": id}).Decode(&s)
+	return s, err
+}
+
+func (r *Repo) UpdateSupplier(ctx context.Context, id primitive.ObjectID, upd bson.M) (models.Supplier, error) {
+	if len(upd) == 0 {
+		return models.Supplier{}, errors.New("nothing to update")
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var out models.Supplier
+	err := r.suppliers.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": upd}, opts).Decode(&out)
+	return out, err
+}
+
+// DeleteSupplier refuses suppliers that purchase orders refer to; deactivate
+// those instead.
+func (r *Repo) DeleteSupplier(ctx context.Context, id primitive.ObjectID) error {
+	n, err := r.purchaseOrders.CountDocuments(ctx, bson.M{"supplier_id": id}, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrSupplierInUse
+	}
+	res, err := r.suppliers.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// SetSupplierPrice adds or replaces the supplier's price for p.PartID.
+func (r *Repo) SetSupplierPrice(ctx context.Context, id primitive.ObjectID, p models.SupplierPrice) (models.Supplier, error) {
+	res, err := r.suppliers.UpdateOne(ctx,
+		bson.M{"_id": id, "prices.part_id": p.PartID},
+		bson.M{"$set": bson.M{"prices.$": p}},
+	)
+	if err != nil {
+		return models.Supplier{}, err
+	}
+	if res.MatchedCount == 0 {
+		res, err = r.suppliers.UpdateOne(ctx,
+			bson.M{"_id": id, "prices.part_id": bson.M{"$ne": p.PartID}},
+			bson.M{"$push": bson.M{"prices": p}},
+		)
+		if err != nil {
+			return models.Supplier{}, err
+		}
+		if res.MatchedCount == 0 {
+			if _, err := r.GetSupplier(ctx, id); err != nil {
+				return models.Supplier{}, err
+			}
+			return models.Supplier{}, ErrConflict // priced concurrently
+		}
+	}
+	return r.GetSupplier(ctx, id)
+}
+
+func (r *Repo) RemoveSupplierPrice(ctx context.Context, id, partID primitive.ObjectID) (models.Supplier, error) {
+	res, err := r.suppliers.UpdateOne(ctx,
+		bson.M{"_id": id, "prices.part_id": partID},
+		bson.M{"$pull": bson.M{"prices": bson.M{"part_id": partID}}},
+	)
+	if err != nil {
+		return models.Supplier{}, err
+	}
+	if res.MatchedCount == 0 {
+		return models.Supplier{}, mongo.ErrNoDocuments
+	}
+	return r.GetSupplier(ctx, id)
+}
+
+// -------- purchase orders --------
+func (r *Repo) CreatePurchaseOrder(ctx context.Context, po models.PurchaseOrder) (models.PurchaseOrder, error) {
+	po.CalcTotal()
+	res, err := r.purchaseOrders.InsertOne(ctx, po)
+	if err != nil {
+		return models.PurchaseOrder{}, err
+	}
+	po.ID = res.InsertedID.(primitive.ObjectID)
+	return po, nil
+}
+
+func (r *Repo) GetPurchaseOrder(ctx context.Context, id primitive.ObjectID) (models.PurchaseOrder, error) {
+	var po models.PurchaseOrder
+	err := r.purchaseOrders.FindOne(ctx, bson.M{"_id": id}).Decode(&po)
+	return po, err
+}
+
+func (r *Repo) ListPurchaseOrders(ctx context.Context, status string, supplierID *primitive.ObjectID) ([]models.PurchaseOrder, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	if supplierID != nil {
+		filter["supplier_id"] = *supplierID
+	}
+	cur, err := r.purchaseOrders.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := make([]models.PurchaseOrder, 0)
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeletePurchaseOrder discards a draft; orders that were sent are history.
+func (r *Repo) DeletePurchaseOrder(ctx context.Context, id primitive.ObjectID) error {
+	res, err := r.purchaseOrders.DeleteOne(ctx, bson.M{"_id": id, "status": models.PurchaseDraft})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		po, err := r.GetPurchaseOrder(ctx, id)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: it is %s", ErrPurchaseState, po.Status)
+	}
+	return nil
+}
+
+// SendPurchaseOrder marks a draft as sent and works out when it should
+// arrive from the supplier's lead time.
+func (r *Repo) SendPurchaseOrder(ctx context.Context, id primitive.ObjectID) (models.PurchaseOrder, error) {
+	po, err := r.GetPurchaseOrder(ctx, id)
+	if err != nil {
+		return models.PurchaseOrder{}, err
+	}
+	sup, err := r.GetSupplier(ctx, po.SupplierID)
+	if err != nil {
+		return models.PurchaseOrder{}, err
+	}
+	now := time.Now()
+	expected := now.AddDate(0, 0, sup.LeadTimeDays)
+
+	var out models.PurchaseOrder
+	err = r.purchaseOrders.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": models.PurchaseDraft},
+		bson.M{"$set": bson.M{
+			"status":      models.PurchaseSent,
+			"sent_at":     now,
+			"expected_at": expected,
+			"updated_at":  now,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&out)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		cur, gerr := r.GetPurchaseOrder(ctx, id)
+		if gerr != nil {
+			return models.PurchaseOrder{}, gerr
+		}
+		return models.PurchaseOrder{}, fmt.Errorf("%w: it is %s", ErrPurchaseState, cur.Status)
+	}
+	return out, err
+}
+
+// ReceivePurchaseOrder books goods arriving against a sent order: stock goes
+// up, and into the warehouse the goods arrived at, and the alert of every
+// line received in full is resolved by actor. If the part is still low after
+// that, the outbox sync opens a fresh alert. An order without a warehouse
+// takes warehouseID as its own; with neither, only parts not yet stocked per
+// warehouse can be received, so part stock stays the sum of the levels. A
+// part received into a warehouse before it has any level gets its first
+// there, holding the stock it had, as with SetStock.
+func (r *Repo) ReceivePurchaseOrder(ctx context.Context, id primitive.ObjectID, warehouseID *primitive.ObjectID, received map[primitive.ObjectID]int, actor string) (models.PurchaseOrder, error) {
+	var out models.PurchaseOrder
+	err := r.atomically(ctx, func(ctx context.Context, s *txScope) error {
+		po, err := r.GetPurchaseOrder(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkReceipt(po, received); err != nil {
+			return err
+		}
+		before := po
+		before.Lines = append([]models.PurchaseOrderLine{}, po.Lines...)
+		if po.WarehouseID == nil {
+			po.WarehouseID = warehouseID
+		}
+		if po.WarehouseID == nil {
+			pids := make([]primitive.ObjectID, 0, len(received))
+			for pid := range received {
+				pids = append(pids, pid)
+			}
+			n, err := r.inventory.CountDocuments(ctx, bson.M{"part_id": bson.M{"$in": pids}}, options.Count().SetLimit(1))
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				return ErrReceiptWarehouse
+			}
+		}
+		now := time.Now()
+		completed := po.Receive(received, now)
+
+		// guarded on the previous state so two receipts cannot both book
+		// the same outstanding quantity
+		res, err := r.purchaseOrders.ReplaceOne(ctx,
+			bson.M{"_id": id, "status": before.Status, "updated_at": before.UpdatedAt}, po)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return ErrConflict
+		}
+		s.Compensate(func(ctx context.Context) error {
+			_, err := r.purchaseOrders.ReplaceOne(ctx, bson.M{"_id": id}, before)
+			return err
+		})
+
+		var changed []primitive.ObjectID
+		for _, l := range po.Lines {
+			pid, n := l.PartID, received[l.PartID]
+			if n <= 0 {
+				continue
+			}
+			changed = append(changed, pid)
+			if po.WarehouseID != nil {
+				wid := *po.WarehouseID
+				if err := r.allocateStock(ctx, s, wid, pid); err != nil {
+					return err
+				}
+				if err := r.moveInventory(ctx, wid, pid, n); err != nil {
+					return err
+				}
+				s.Compensate(func(ctx context.Context) error {
+					return r.moveInventory(ctx, wid, pid, -n)
+				})
+			}
+			if err := r.increaseStock(ctx, pid, n); err != nil {
+				return err
+			}
+			s.Compensate(func(ctx context.Context) error {
+				return r.increaseStock(ctx, pid, -n)
+			})
+		}
+
+		for _, l := range completed {
+			if l.AlertID == nil {
+				continue
+			}
+			if err := r.resolveAlert(ctx, s, *l.AlertID, actor, now); err != nil {
+				return err
+			}
+		}
+
+		out = po
+		return r.stockChanged(ctx, s, changed...)
+	})
+	return out, err
+}
+
+// resolveAlert resolves the alert if it is still current; one staff or the
+// stock sync already resolved is left alone.
+func (r *Repo) resolveAlert(ctx context.Context, s *txScope, id primitive.ObjectID, actor string, at time.Time) error {
+	var before models.LowStockAlert
+	err := r.alerts.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "current": true},
+		bson.M{"$set": bson.M{
+			"status":      models.AlertResolved,
+			"current":     false,
+			"resolved_at": at,
+			"resolved_by": actor,
+			"updated_at":  at,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&before)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.Compensate(func(ctx context.Context) error {
+		_, err := r.alerts.ReplaceOne(ctx, bson.M{"_id": id}, before)
+		return err
+	})
+	return nil
+}
+
+// PendingPurchaseAlertIDs returns the alerts that an open purchase order
+// already has a line for.
+func (r *Repo) PendingPurchaseAlertIDs(ctx context.Context) (map[primitive.ObjectID]bool, error) {
+	cur, err := r.purchaseOrders.Find(ctx,
+		bson.M{"status": bson.M{"$in": openPurchaseStatuses}, "lines.alert_id": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"lines.alert_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var pos []models.PurchaseOrder
+	if err := cur.All(ctx, &pos); err != nil {
+		return nil, err
+	}
+	return pendingAlertIDs(pos), nil
+}
+
+// OnOrderByPart sums what open purchase orders, drafts included, still wait
+// for per part.
+func (r *Repo) OnOrderByPart(ctx context.Context) (map[primitive.ObjectID]int, error) {
+	cur, err := r.purchaseOrders.Find(ctx,
+		bson.M{"status": bson.M{"$in": openPurchaseStatuses}},
+		options.Find().SetProjection(bson.M{"lines": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var pos []models.PurchaseOrder
+	if err := cur.All(ctx, &pos); err != nil {
+		return nil, err
+	}
+	return outstandingByPart(pos), nil
+}
+
+func outstandingByPart(pos []models.PurchaseOrder) map[primitive.ObjectID]int {
+	out := map[primitive.ObjectID]int{}
+	for _, po := range pos {
+		for _, l := range po.Lines {
+			if n := l.Outstanding(); n > 0 {
+				out[l.PartID] += n
+			}
+		}
+	}
+	return out
+}
+
+func pendingAlertIDs(pos []models.PurchaseOrder) map[primitive.ObjectID]bool {
+	out := map[primitive.ObjectID]bool{}
+	for _, po := range pos {
+		for _, l := range po.Lines {
+			if l.AlertID != nil {
+				out[*l.AlertID] = true
+			}
+		}
+	}
+	return out
+}
+
+// checkReceipt rejects receipts against orders that are not out with the
+// supplier, and lines getting more than they still wait for.
+func checkReceipt(po models.PurchaseOrder, received map[primitive.ObjectID]int) error {
+	if po.Status != models.PurchaseSent && po.Status != models.PurchasePartiallyReceived {
+		return fmt.Errorf("%w: it is %s", ErrPurchaseState, po.Status)
+	}
+	for _, l := range po.Lines {
+		if received[l.PartID] > l.Outstanding() {
+			return fmt.Errorf("%w: part %s", ErrOverReceipt, l.PartID.Hex())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrTransferState is wrapped with the status the transfer was found in.
+var ErrTransferState = errors.New("transfer is not in the required state")
+
+// -------- transfers --------
+func (r *Repo) CreateTransfer(ctx context.Context, t models.StockTransfer) (models.StockTransfer, error) {
+	if t.Discrepancies == nil {
+		t.Discrepancies = []models.TransferDiscrepancy{}
+	}
+	res, err := r.transfers.InsertOne(ctx, t)
+	if err != nil {
+		return models.StockTransfer{}, err
+	}
+	t.ID = res.InsertedID.(primitive.ObjectID)
+	return t, nil
+}
+
+func (r *Repo) GetTransfer(ctx context.Context, id primitive.ObjectID) (models.StockTransfer, error) {
+	var t models.StockTransfer
+	err := r.transfers.FindOne(ctx, bson.M{"_id": id}).Decode(&t)
+	return t, err
+}
+
+func (r *Repo) ListTransfers(ctx context.Context, status string) ([]models.StockTransfer, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	cur, err := r.transfers.Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := make([]models.StockTransfer, 0)
+	for cur.Next(ctx) {
+		var t models.StockTransfer
+		if err := cur.Decode(&t); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// DispatchTransfer takes every line out of the source warehouse, never
+// touching stock held for unpaid orders; if any line is short the whole
+// dispatch is rolled back and the transfer stays a draft.
+func (r *Repo) DispatchTransfer(ctx context.Context, id primitive.ObjectID) (models.StockTransfer, error) {
+	var out models.StockTransfer
+	err := r.atomically(ctx, func(ctx context.Context, s *txScope) error {
+		if err := r.moveTransfer(ctx, s, id, models.TransferDraft, bson.M{
+			"status":        models.TransferInTransit,
+			"dispatched_at": time.Now(),
+		}, &out); err != nil {
+			return err
+		}
+
+		for _, l := range out.Lines {
+			res, err := r.inventory.UpdateOne(ctx,
+				bson.M{"warehouse_id": out.FromWarehouseID, "part_id": l.PartID, "$expr": availableAtLeast("quantity", l.Quantity)},
+				bson.M{"$inc": bson.M{"quantity": -l.Quantity}, "$set": bson.M{"updated_at": time.Now()}},
+			)
+			if err != nil {
+				return err
+			}
+			if res.ModifiedCount == 0 {
+				return fmt.Errorf("part %s: %w", l.PartID.Hex(), ErrNotEnoughStock)
+			}
+			l := l
+			s.Compensate(func(ctx context.Context) error {
+				return r.moveInventory(ctx, out.FromWarehouseID, l.PartID, l.Quantity)
+			})
+
+			// in-transit stock is not available anywhere, so the part total
+			// drops now and comes back on receipt
+			if err := r.increaseStock(ctx, l.PartID, -l.Quantity); err != nil {
+				return err
+			}
+			s.Compensate(func(ctx context.Context) error {
+				return r.increaseStock(ctx, l.PartID, l.Quantity)
+			})
+		}
+		return r.stockChanged(ctx, s, out.PartIDs()...)
+	})
+	return out, err
+}
+
+// ReceiveTransfer books what actually arrived into the destination
+// warehouse and records any shipped/received mismatch.
+func (r *Repo) ReceiveTransfer(ctx context.Context, id primitive.ObjectID, received map[primitive.ObjectID]int) (models.StockTransfer, error) {
+	var out models.StockTransfer
+	err := r.atomically(ctx, func(ctx context.Context, s *txScope) error {
+		t, err := r.GetTransfer(ctx, id)
+		if err != nil {
+			return err
+		}
+		t.Receive(received, time.Now())
+
+		if err := r.moveTransfer(ctx, s, id, models.TransferInTransit, bson.M{
+			"status":        t.Status,
+			"lines":         t.Lines,
+			"discrepancies": t.Discrepancies,
+			"received_at":   t.ReceivedAt,
+		}, &out); err != nil {
+			return err
+		}
+
+		for _, l := range out.Lines {
+			if l.ReceivedQuantity == 0 {
+				continue
+			}
+			if err := r.moveInventory(ctx, out.ToWarehouseID, l.PartID, l.ReceivedQuantity); err != nil {
+				return err
+			}
+			l := l
+			s.Compensate(func(ctx context.Context) error {
+				return r.moveInventory(ctx, out.ToWarehouseID, l.PartID, -l.ReceivedQuantity)
+			})
+			if err := r.increaseStock(ctx, l.PartID, l.ReceivedQuantity); err != nil {
+				return err
+			}
+			s.Compensate(func(ctx context.Context) error {
+				return r.increaseStock(ctx, l.PartID, -l.ReceivedQuantity)
+			})
+		}
+		return r.stockChanged(ctx, s, out.PartIDs()...)
+	})
+	return out, err
+}
+
+// moveTransfer applies set only if the transfer is still in status from,
+// and registers the compensation that restores the previous document.
+func (r *Repo) moveTransfer(ctx context.Context, s *txScope, id primitive.ObjectID, from string, set bson.M, out *models.StockTransfer) error {
+	var before models.StockTransfer
+	err := r.transfers.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": from},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&before)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			cur, gerr := r.GetTransfer(ctx, id)
+			if gerr != nil {
+				return gerr
+			}
+			return fmt.Errorf("%w: it is %s", ErrTransferState, cur.Status)
+		}
+		return err
+	}
+	s.Compensate(func(ctx context.Context) error {
+		_, err := r.transfers.ReplaceOne(ctx, bson.M{"_id": id}, before)
+		return err
+	})
+	return r.transfers.FindOne(ctx, bson.M{"_id": id}).Decode(out)
+}
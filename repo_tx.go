@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// txScope collects compensating actions for the steps of a multi-document
+// write. Inside a real transaction they are never run (the server rolls
+// everything back); without transactions they undo the completed steps.
+type txScope struct {
+	undo      []func(ctx context.Context) error
+	committed []func()
+}
+
+// Compensate registers fn to be run if a later step of the scope fails.
+func (s *txScope) Compensate(fn func(ctx context.Context) error) {
+	s.undo = append(s.undo, fn)
+}
+
+// OnCommit registers fn to be run once the whole scope has succeeded.
+func (s *txScope) OnCommit(fn func()) {
+	s.committed = append(s.committed, fn)
+}
+
+func (s *txScope) commit() {
+	for _, fn := range s.committed {
+		fn()
+	}
+}
+
+func (s *txScope) rollback(ctx context.Context) {
+	for i := len(s.undo) - 1; i >= 0; i-- {
+		if err := s.undo[i](ctx); err != nil {
+			log.Printf("compensation failed: %v", err)
+		}
+	}
+}
+
+// noTx is set once we learn the deployment is a standalone mongod.
+var noTx atomic.Bool
+
+// atomically runs fn as a single unit: inside a MongoDB transaction when the
+// deployment supports it, otherwise as a saga whose compensations are run in
+// reverse order when fn fails.
+func (r *Repo) atomically(ctx context.Context, fn func(ctx context.Context, s *txScope) error) error {
+	if !noTx.Load() {
+		var s *txScope
+		err := r.db.Client().UseSession(ctx, func(sc mongo.SessionContext) error {
+			_, err := sc.WithTransaction(sc, func(sc mongo.SessionContext) (any, error) {
+				s = &txScope{} // a retried transaction starts over
+				return nil, fn(sc, s)
+			})
+			return err
+		})
+		if err == nil {
+			s.commit()
+		}
+		if !isTxUnsupported(err) {
+			return err
+		}
+		noTx.Store(true)
+		log.Println("mongo transactions unavailable, falling back to compensating writes")
+	}
+
+	s := &txScope{}
+	if err := fn(ctx, s); err != nil {
+		// the caller's context may already be done; compensations must still run
+		cctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s.rollback(cctx)
+		return err
+	}
+	s.commit()
+	return nil
+}
+
+func isTxUnsupported(err error) bool {
+	var ce mongo.CommandError
+	if !errors.As(err, &ce) {
+		return false
+	}
+	return ce.Code == 20 || strings.Contains(ce.Message, "Transaction numbers are only allowed")
+}
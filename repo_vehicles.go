@@ -0,0 +1,242 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// -------- vehicles --------
+func (r *Repo) CreateVehicle(ctx context.Context, v models.Vehicle) (models.Vehicle, error) {
+	v.Normalize()
+	res, err := r.vehicles.InsertOne(ctx, v)
+	if err != nil {
+		return models.Vehicle{}, err
+	}
+	v.ID = res.InsertedID.(primitive.ObjectID)
+	return v, nil
+}
+
+func (r *Repo) GetVehicle(ctx context.Context, id primitive.ObjectID) (models.Vehicle, error) {
+	var v models.Vehicle
+	err := r.vehicles.FindOne(ctx, bson.M{"_id": id}).Decode(&v)
+	return v, err
+}
+
+func (r *Repo) ListVehicles(ctx context.Context, f VehicleFilter) ([]models.Vehicle, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "make_key", Value: 1}, {Key: "model_key", Value: 1}, {Key: "year_from", Value: 1}, {Key: "_id", Value: 1}})
+	cur, err := r.vehicles.Find(ctx, vehicleQuery(f), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := make([]models.Vehicle, 0)
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *Repo) ReplaceVehicle(ctx context.Context, v models.Vehicle) (models.Vehicle, error) {
+	v.Normalize()
+	res, err := r.vehicles.ReplaceOne(ctx, bson.M{"_id": v.ID}, v)
+	if err != nil {
+		return models.Vehicle{}, err
+	}
+	if res.MatchedCount == 0 {
+		return models.Vehicle{}, mongo.ErrNoDocuments
+	}
+	return v, nil
+}
+
+func (r *Repo) DeleteVehicle(ctx context.Context, id primitive.ObjectID) error {
+	return r.atomically(ctx, func(ctx context.Context, s *txScope) error {
+		var before models.Vehicle
+		if err := r.vehicles.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&before); err != nil {
+			return err
+		}
+		s.Compensate(func(ctx context.Context) error {
+			_, err := r.vehicles.InsertOne(ctx, before)
+			return err
+		})
+		return r.dropFitments(ctx, s, bson.M{"vehicle_id": id})
+	})
+}
+
+func (r *Repo) ListVehicleMakes(ctx context.Context) ([]string, error) {
+	return r.vehicleNames(ctx, bson.M{}, "make_key", "$make")
+}
+
+func (r *Repo) ListVehicleModels(ctx context.Context, vehicleMake string) ([]string, error) {
+	return r.vehicleNames(ctx, bson.M{"make_key": models.VehicleKey(vehicleMake)}, "model_key", "$model")
+}
+
+// vehicleNames lists one name per distinct key among the vehicles match
+// selects, spelled as in the earliest vehicle carrying it.
+func (r *Repo) vehicleNames(ctx context.Context, match bson.M, key, name string) ([]string, error) {
+	cur, err := r.vehicles.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$" + key, "name": bson.M{"$first": name}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var rows []struct {
+		Name string `bson:"name"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.Name)
+	}
+	return out, nil
+}
+
+// -------- fitments --------
+func (r *Repo) AddFitment(ctx context.Context, f models.Fitment) (models.Fitment, error) {
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var out models.Fitment
+	err := r.fitments.FindOneAndUpdate(ctx,
+		bson.M{"part_id": f.PartID, "vehicle_id": f.VehicleID},
+		bson.M{
+			"$set":         bson.M{"note": f.Note},
+			"$setOnInsert": bson.M{"created_at": f.CreatedAt},
+		},
+		opts,
+	).Decode(&out)
+	return out, err
+}
+
+func (r *Repo) RemoveFitment(ctx context.Context, partID, vehicleID primitive.ObjectID) error {
+	res, err := r.fitments.DeleteOne(ctx, bson.M{"part_id": partID, "vehicle_id": vehicleID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *Repo) PartFitments(ctx context.Context, partID primitive.ObjectID) ([]models.Fitment, error) {
+	cur, err := r.fitments.Find(ctx, bson.M{"part_id": partID}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := make([]models.Fitment, 0)
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *Repo) FittingPartIDs(ctx context.Context, f VehicleFilter) ([]primitive.ObjectID, error) {
+	cur, err := r.vehicles.Find(ctx, vehicleQuery(f), options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var vehicles []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cur.All(ctx, &vehicles); err != nil {
+		return nil, err
+	}
+	out := make([]primitive.ObjectID, 0)
+	if len(vehicles) == 0 {
+		return out, nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(vehicles))
+	for _, v := range vehicles {
+		ids = append(ids, v.ID)
+	}
+
+	vals, err := r.fitments.Distinct(ctx, "part_id", bson.M{"vehicle_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vals {
+		if id, ok := v.(primitive.ObjectID); ok {
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
+
+// dropFitments deletes the fitments filter selects, restoring them if the
+// surrounding operation is rolled back.
+func (r *Repo) dropFitments(ctx context.Context, s *txScope, filter bson.M) error {
+	cur, err := r.fitments.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	var before []models.Fitment
+	if err := cur.All(ctx, &before); err != nil {
+		return err
+	}
+	if len(before) == 0 {
+		return nil
+	}
+	if _, err := r.fitments.DeleteMany(ctx, filter); err != nil {
+		return err
+	}
+	s.Compensate(func(ctx context.Context) error {
+		docs := make([]any, 0, len(before))
+		for _, f := range before {
+			docs = append(docs, f)
+		}
+		_, err := r.fitments.InsertMany(ctx, docs)
+		if mongo.IsDuplicateKeyError(err) {
+			return nil
+		}
+		return err
+	})
+	return nil
+}
+
+// vehicleQuery translates f. A variant without an engine code or body type
+// is taken to cover all of them; both fields are omitted when empty, hence
+// the nil.
+func vehicleQuery(f VehicleFilter) bson.M {
+	var and []bson.M
+	if f.Make != "" {
+		and = append(and, bson.M{"make_key": models.VehicleKey(f.Make)})
+	}
+	if f.Model != "" {
+		and = append(and, bson.M{"model_key": models.VehicleKey(f.Model)})
+	}
+	if f.Year != 0 {
+		and = append(and,
+			bson.M{"year_from": bson.M{"$lte": f.Year}},
+			bson.M{"$or": []bson.M{{"year_to": 0}, {"year_to": bson.M{"$gte": f.Year}}}},
+		)
+	}
+	if f.EngineCode != "" {
+		and = append(and, bson.M{"engine_code": bson.M{"$in": bson.A{nil, "", models.EngineKey(f.EngineCode)}}})
+	}
+	if f.BodyType != "" {
+		and = append(and, bson.M{"body_type": bson.M{"$in": bson.A{nil, "", strings.ToLower(f.BodyType)}}})
+	}
+	if f.IDs != nil {
+		and = append(and, bson.M{"_id": bson.M{"$in": f.IDs}})
+	}
+	if len(and) == 0 {
+		return bson.M{}
+	}
+	return bson.M{"$and": and}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrWarehouseNotEmpty = errors.New("warehouse still holds stock")
+	// ErrUnallocatedHolds refuses a part's first warehouse level while unpaid
+	// orders hold stock the part was counted with before it had levels.
+	ErrUnallocatedHolds = errors.New("part has stock held for unpaid orders outside any warehouse")
+	// ErrWarehouseInactive refuses an order line that names a deactivated
+	// warehouse to fulfil it.
+	ErrWarehouseInactive = errors.New("warehouse is not active")
+)
+
+// -------- warehouses --------
+func (r *Repo) CreateWarehouse(ctx context.Context, w models.Warehouse) (models.Warehouse, error) {
+	res, err := r.warehouses.InsertOne(ctx, w)
+	if err != nil {
+		return models.Warehouse{}, err
+	}
+	w.ID = res.InsertedID.(primitive.ObjectID)
+	return w, nil
+}
+
+func (r *Repo) ListWarehouses(ctx context.Context) ([]models.Warehouse, error) {
+	cur, err := r.warehouses.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := make([]models.Warehouse, 0)
+	for cur.Next(ctx) {
+		var w models.Warehouse
+		if err := cur.Decode(&w); err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, nil
+}
+
+func (r *Repo) GetWarehouse(ctx context.Context, id primitive.ObjectID) (models.Warehouse, error) {
+	var w models.Warehouse
+	err := r.warehouses.FindOne(ctx, bson.M{"_id": id}).Decode(&w)
+	return w, err
+}
+
+func (r *Repo) UpdateWarehouse(ctx context.Context, id primitive.ObjectID, upd bson.M) (models.Warehouse, error) {
+	if len(upd) == 0 {
+		return models.Warehouse{}, errors.New("nothing to update")
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var out models.Warehouse
+	err := r.warehouses.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": upd}, opts).Decode(&out)
+	return out, err
+}
+
+// DeleteWarehouse refuses to drop a location that still has stock, since
+// that stock would silently vanish from the part totals' breakdown.
+func (r *Repo) DeleteWarehouse(ctx context.Context, id primitive.ObjectID) error {
+	n, err := r.inventory.CountDocuments(ctx, bson.M{"warehouse_id": id, "quantity": bson.M{"$gt": 0}})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrWarehouseNotEmpty
+	}
+	if _, err := r.inventory.DeleteMany(ctx, bson.M{"warehouse_id": id}); err != nil {
+		return err
+	}
+	_, err = r.warehouses.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// -------- inventory --------
+func (r *Repo) ListInventory(ctx context.Context, warehouseID primitive.ObjectID) ([]models.InventoryLevel, error) {
+	return r.findInventory(ctx, bson.M{"warehouse_id": warehouseID}, options.Find().SetSort(bson.M{"part_id": 1}))
+}
+
+func (r *Repo) PartInventory(ctx context.Context, partID primitive.ObjectID) ([]models.InventoryLevel, error) {
+	return r.findInventory(ctx, bson.M{"part_id": partID}, options.Find().SetSort(bson.M{"quantity": -1}))
+}
+
+func (r *Repo) findInventory(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.InventoryLevel, error) {
+	cur, err := r.inventory.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := make([]models.InventoryLevel, 0)
+	for cur.Next(ctx) {
+		var l models.InventoryLevel
+		if err := cur.Decode(&l); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, nil
+}
+
+// SetStock sets a part's level in one warehouse and moves SparePart.Stock by
+// the same delta, so the part total stays the sum over warehouses. A part's
+// first level takes over the stock it was counted with until then: that
+// stock is taken to be in this warehouse, and qty is its new count.
+func (r *Repo) SetStock(ctx context.Context, warehouseID, partID primitive.ObjectID, qty int) (models.InventoryLevel, error) {
+	if qty < 0 {
+		return models.InventoryLevel{}, errors.New("quantity must be >= 0")
+	}
+
+	var out models.InventoryLevel
+	var part models.SparePart
+	err := r.atomically(ctx, func(ctx context.Context, s *txScope) error {
+		if err := r.parts.FindOne(ctx, bson.M{"_id": partID}).Decode(&part); err != nil {
+			return err
+		}
+		n, err := r.inventory.CountDocuments(ctx, bson.M{"part_id": partID}, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		// the part's stock as it stands before this level, and a guard that
+		// it has not moved since it was read
+		unallocated, guard := 0, bson.M{"_id": partID}
+		if n == 0 {
+			if part.Reserved > 0 {
+				return ErrUnallocatedHolds
+			}
+			unallocated = part.Stock
+			guard["stock"] = part.Stock
+			guard["reserved"] = bson.M{"$not": bson.M{"$gt": 0}}
+		}
+
+		var before models.InventoryLevel
+		err = r.inventory.FindOneAndUpdate(ctx,
+			bson.M{"warehouse_id": warehouseID, "part_id": partID, "reserved": bson.M{"$not": bson.M{"$gt": qty}}},
+			bson.M{"$set": bson.M{"quantity": qty, "updated_at": time.Now()}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+		).Decode(&before)
+		if mongo.IsDuplicateKeyError(err) {
+			// the level exists but holds more than qty for unpaid orders
+			return ErrBelowReserved
+		}
+		inserted := errors.Is(err, mongo.ErrNoDocuments)
+		if err != nil && !inserted {
+			return err
+		}
+		s.Compensate(func(ctx context.Context) error {
+			if inserted {
+				_, err := r.inventory.DeleteOne(ctx, bson.M{"warehouse_id": warehouseID, "part_id": partID})
+				return err
+			}
+			_, err := r.inventory.UpdateOne(ctx,
+				bson.M{"warehouse_id": warehouseID, "part_id": partID},
+				bson.M{"$set": bson.M{"quantity": before.Quantity}})
+			return err
+		})
+
+		delta := qty - before.Quantity - unallocated
+		res, err := r.parts.UpdateOne(ctx, guard, bson.M{"$inc": bson.M{"stock": delta}})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			// an order took or held the unallocated stock meanwhile
+			return ErrConflict
+		}
+		s.Compensate(func(ctx context.Context) error {
+			return r.increaseStock(ctx, partID, -delta)
+		})
+
+		if err := r.stockChanged(ctx, s, partID); err != nil {
+			return err
+		}
+		return r.inventory.FindOne(ctx, bson.M{"warehouse_id": warehouseID, "part_id": partID}).Decode(&out)
+	})
+	return out, err
+}
+
+// returnLine puts a fulfilled line back where it came from.
+func (r *Repo) returnLine(ctx context.Context, s *txScope, it models.OrderItem) error {
+	if it.WarehouseID != nil {
+		if err := r.moveInventory(ctx, *it.WarehouseID, it.PartID, it.Quantity); err != nil {
+			return err
+		}
+		s.Compensate(func(ctx context.Context) error {
+			return r.moveInventory(ctx, *it.WarehouseID, it.PartID, -it.Quantity)
+		})
+	}
+	if err := r.increaseStock(ctx, it.PartID, it.Quantity); err != nil {
+		return err
+	}
+	s.Compensate(func(ctx context.Context) error {
+		return r.increaseStock(ctx, it.PartID, -it.Quantity)
+	})
+	return nil
+}
+
+// moveInventory adds delta to a warehouse level, creating it if needed.
+// allocateStock gives a part that has no inventory levels yet its first one,
+// in warehouseID, holding the stock the part was counted with until then,
+// the way SetStock's first level takes it over, so that stock can still be
+// sold. A part that has levels is left alone.
+func (r *Repo) allocateStock(ctx context.Context, s *txScope, warehouseID, partID primitive.ObjectID) error {
+	n, err := r.inventory.CountDocuments(ctx, bson.M{"part_id": partID}, options.Count().SetLimit(1))
+	if err != nil || n > 0 {
+		return err
+	}
+	var part models.SparePart
+	if err := r.parts.FindOne(ctx, bson.M{"_id": partID}).Decode(&part); err != nil {
+		return err
+	}
+	if part.Reserved > 0 {
+		return ErrUnallocatedHolds
+	}
+	// touching the part, guarded on the stock read, fails when an order
+	// took or held it meanwhile and, in a transaction, conflicts with one
+	// that does so later
+	res, err := r.parts.UpdateOne(ctx,
+		bson.M{"_id": partID, "stock": part.Stock, "reserved": bson.M{"$not": bson.M{"$gt": 0}}},
+		bson.M{"$inc": bson.M{"stock": 0}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrConflict
+	}
+	l := models.InventoryLevel{
+		ID: primitive.NewObjectID(), WarehouseID: warehouseID, PartID: partID,
+		Quantity: part.Stock, UpdatedAt: time.Now(),
+	}
+	if _, err := r.inventory.InsertOne(ctx, l); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrConflict // another write gave it a level first
+		}
+		return err
+	}
+	s.Compensate(func(ctx context.Context) error {
+		_, err := r.inventory.DeleteOne(ctx, bson.M{"_id": l.ID})
+		return err
+	})
+	return nil
+}
+
+func (r *Repo) moveInventory(ctx context.Context, warehouseID, partID primitive.ObjectID, delta int) error {
+	_, err := r.inventory.UpdateOne(ctx,
+		bson.M{"warehouse_id": warehouseID, "part_id": partID},
+		bson.M{"$inc": bson.M{"quantity": delta}, "$set": bson.M{"updated_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// -------- webhooks --------
+func (r *Repo) CreateWebhook(ctx context.Context, s models.WebhookSubscription) (models.WebhookSubscription, error) {
+	res, err := r.webhooks.InsertOne(ctx, s)
+	if err != nil {
+		return models.WebhookSubscription{}, err
+	}
+	s.ID = res.InsertedID.(primitive.ObjectID)
+	return s, nil
+}
+
+func (r *Repo) ListWebhooks(ctx context.Context) ([]models.WebhookSubscription, error) {
+	cur, err := r.webhooks.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := make([]models.WebhookSubscription, 0)
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *Repo) GetWebhook(ctx context.Context, id primitive.ObjectID) (models.WebhookSubscription, error) {
+	var s models.WebhookSubscription
+	err := r.webhooks.FindOne(ctx, bson.M{"_id": id}).Decode(&s)
+	return s, err
+}
+
+func (r *Repo) UpdateWebhook(ctx context.Context, id primitive.ObjectID, upd bson.M) (models.WebhookSubscription, error) {
+	if len(upd) == 0 {
+		return models.WebhookSubscription{}, errors.New("nothing to update")
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var out models.WebhookSubscription
+	err := r.webhooks.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": upd}, opts).Decode(&out)
+	return out, err
+}
+
+// DeleteWebhook removes the subscription; its pending deliveries are failed
+// by the dispatcher when it finds the subscription gone.
+func (r *Repo) DeleteWebhook(ctx context.Context, id primitive.ObjectID) error {
+	res, err := r.webhooks.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// EnqueueWebhookDeliveries queues the event for every active subscription
+// that wants it. Queuing the same eventID twice is a no-op, so the outbox
+// may retry the fan-out.
+func (r *Repo) EnqueueWebhookDeliveries(ctx context.Context, eventID, event string, payload []byte) (int, error) {
+	cur, err := r.webhooks.Find(ctx, bson.M{"active": true, "events": event})
+	if err != nil {
+		return 0, err
+	}
+	var subs []models.WebhookSubscription
+	if err := cur.All(ctx, &subs); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	now := time.Now()
+	for _, s := range subs {
+		d := models.NewWebhookDelivery(s.ID, eventID, event, payload, webhookMaxAttempts, now)
+		_, err := r.deliveries.InsertOne(ctx, d)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	if n > 0 {
+		r.notifyWebhooks()
+	}
+	return n, nil
+}
+
+func (r *Repo) CreateWebhookDelivery(ctx context.Context, d models.WebhookDelivery) (models.WebhookDelivery, error) {
+	if d.ID.IsZero() {
+		d.ID = primitive.NewObjectID()
+	}
+	if _, err := r.deliveries.InsertOne(ctx, d); err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	return d, nil
+}
+
+func (r *Repo) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, n int) ([]models.WebhookDelivery, error) {
+	out := make([]models.WebhookDelivery, 0, n)
+	for len(out) < n {
+		var d models.WebhookDelivery
+		err := r.deliveries.FindOneAndUpdate(ctx,
+			bson.M{
+				"status":          models.DeliveryPending,
+				"next_attempt_at": bson.M{"$lte": now},
+				"$or": bson.A{
+					bson.M{"locked_until": bson.M{"$exists": false}},
+					bson.M{"locked_until": bson.M{"$lte": now}},
+				},
+			},
+			bson.M{"$set": bson.M{"locked_until": now.Add(lease)}},
+			options.FindOneAndUpdate().
+				SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+				SetReturnDocument(options.After),
+		).Decode(&d)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// SaveWebhookDelivery stores the outcome of an attempt and releases the
+// lease.
+func (r *Repo) SaveWebhookDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	d.LockedUntil = nil
+	_, err := r.deliveries.ReplaceOne(ctx, bson.M{"_id": d.ID}, d)
+	return err
+}
+
+func (r *Repo) ListWebhookDeliveries(ctx context.Context, subscriptionID primitive.ObjectID, limit int64) ([]models.WebhookDelivery, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cur, err := r.deliveries.Find(ctx, bson.M{"subscription_id": subscriptionID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := make([]models.WebhookDelivery, 0)
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *Repo) notifyWebhooks() {
+	select {
+	case r.webhookCh <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Repo) WebhookSignal() <-chan struct{} {
+	return r.webhookCh
+}
@@ -2,8 +2,14 @@ package main
 
 import "net/http"
 
-func RegisterRoutes(mux *http.ServeMux, r *Repo) {
-	mux.HandleFunc("/health", func(w http.ResponseWriter, req *http.Request) {
+// RegisterRoutes mounts every handler behind Authorize, which applies the
+// permissions table from rbac.go. events feeds the streaming endpoints.
+func RegisterRoutes(mux *http.ServeMux, r Store, tokens *TokenIssuer, events *EventHub) {
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, Authorize(h))
+	}
+
+	handle("/health", func(w http.ResponseWriter, req *http.Request) {
 		if req.Method != http.MethodGet {
 			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
 			return
@@ -11,16 +17,57 @@ func RegisterRoutes(mux *http.ServeMux, r *Repo) {
 		WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 	})
 
-	mux.HandleFunc("/categories", CategoriesHandler(r))
-	mux.HandleFunc("/categories/", CategoryByIDHandler(r))
+	handle("/auth/login", LoginHandler(r, tokens))
+	handle("/auth/refresh", RefreshHandler(r, tokens))
+	handle("/auth/logout", LogoutHandler(r))
+
+	handle("/categories", CategoriesHandler(r))
+	handle("/categories/", CategoryByIDHandler(r))
+
+	handle("/parts", PartsHandler(r))
+	handle("/parts/", PartByIDHandler(r))
+
+	handle("/cross-references", CrossReferencesHandler(r))
+	handle("/cross-references/", CrossReferenceByIDHandler(r))
+
+	handle("/warehouses", WarehousesHandler(r))
+	handle("/warehouses/", WarehouseByIDHandler(r))
+
+	handle("/transfers", TransfersHandler(r))
+	handle("/transfers/", TransferByIDHandler(r))
+
+	handle("/search/suggest", SuggestHandler(r))
+
+	handle("/vehicle/search", VehicleSearchHandler(r))
+	handle("/vehicle/vin/", VINSearchHandler(r))
+	handle("/vehicles", VehiclesHandler(r))
+	handle("/vehicles/", VehicleByIDHandler(r))
+
+	handle("/customers", CustomersHandler(r))
+	handle("/customers/", CustomerByIDHandler(r))
+
+	handle("/orders", OrdersHandler(r))
+	handle("/orders/", OrderByIDHandler(r))
+
+	handle("/cart", CartHandler(r))
+	handle("/cart/", CartHandler(r))
+
+	handle("/alerts", AlertsHandler(r))
+	handle("/alerts/", AlertByIDHandler(r))
+	handle("/alerts/stream", AlertStreamHandler(r, events))
+
+	handle("/outbox/dead-letters", DeadLettersHandler(r))
+	handle("/outbox/dead-letters/", DeadLettersHandler(r))
 
-	mux.HandleFunc("/parts", PartsHandler(r))
-	mux.HandleFunc("/parts/", PartByIDHandler(r))
+	handle("/webhooks", WebhooksHandler(r))
+	handle("/webhooks/", WebhookByIDHandler(r))
 
-	mux.HandleFunc("/vehicle/search", VehicleSearchHandler(r))
+	handle("/suppliers", SuppliersHandler(r))
+	handle("/suppliers/", SupplierByIDHandler(r))
 
-	mux.HandleFunc("/orders", OrdersHandler(r))
-	mux.HandleFunc("/orders/", OrderByIDHandler(r))
+	handle("/purchase-orders", PurchaseOrdersHandler(r))
+	handle("/purchase-orders/", PurchaseOrderByIDHandler(r))
+	handle("/purchase-orders/from-alerts", PurchaseOrdersFromAlertsHandler(r))
 
-	mux.HandleFunc("/alerts", AlertsHandler(r))
+	handle("/inventory/reorder-suggestions", ReorderSuggestionsHandler(r))
 }
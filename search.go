@@ -0,0 +1,343 @@
+package main
+
+import (
+	"carparts/models"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// searchVersion is stored with each part's search terms. Bump it whenever
+// analyze changes so ReindexParts recomputes them.
+const searchVersion = 2
+
+// BM25 parameters, and the boost for a query that is a part's number.
+const (
+	bm25K1         = 1.2
+	bm25B          = 0.75
+	numberKeyBoost = 10
+)
+
+// stopwords are dropped from both indexed text and queries.
+var stopwords = map[string]bool{
+	// English
+	"a": true, "an": true, "and": true, "for": true, "of": true, "the": true, "to": true, "with": true,
+	// Russian
+	"в": true, "во": true, "для": true, "и": true, "или": true, "на": true, "по": true, "с": true, "со": true,
+	// Kazakh
+	"және": true, "мен": true, "немесе": true, "үшін": true,
+}
+
+// partSearchFields are the texts a part is found by, weighted by how much a
+// hit in them says about the part.
+var partSearchFields = []struct {
+	text   func(p *models.SparePart) string
+	weight float64
+}{
+	{func(p *models.SparePart) string { return p.Brand }, 3},
+	{func(p *models.SparePart) string { return p.CarModel }, 3},
+	{func(p *models.SparePart) string { return p.Compatibility }, 2},
+	{func(p *models.SparePart) string { return p.Description }, 1},
+}
+
+// tokenize splits text into lower-case runs of letters and digits, with ё
+// folded into е.
+func tokenize(text string) []string {
+	text = strings.ReplaceAll(strings.ToLower(text), "ё", "е")
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// words splits text into the tokens search looks at: tokens without stop
+// words or single letters.
+func words(text string) []string {
+	toks := tokenize(text)
+	out := make([]string, 0, len(toks))
+	for _, t := range toks {
+		if stopwords[t] {
+			continue
+		}
+		if rs := []rune(t); len(rs) == 1 && !unicode.IsDigit(rs[0]) {
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// analyze turns text into search terms: its words, stemmed. Repeats are
+// kept, for term frequencies.
+func analyze(text string) []string {
+	ws := words(text)
+	for i, w := range ws {
+		ws[i] = stem(w)
+	}
+	return ws
+}
+
+// indexPart fills in the part's search terms: the distinct terms of its
+// search fields, and of its brand and car model apart.
+func indexPart(p *models.SparePart) {
+	p.SearchTerms = nil
+	for _, f := range partSearchFields {
+		p.SearchTerms = appendTerms(p.SearchTerms, f.text(p))
+	}
+	p.BrandTerms = appendTerms(nil, p.Brand)
+	p.ModelTerms = appendTerms(nil, p.CarModel)
+	p.SearchVersion = searchVersion
+}
+
+// appendTerms adds the terms of text that terms does not have yet.
+func appendTerms(terms []string, text string) []string {
+	for _, t := range analyze(text) {
+		if !sharesString([]string{t}, terms) {
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// termAlt is one way to satisfy a query word: a text has all of Terms.
+// Weight scales the score, by how far the alternative strays from what was
+// typed.
+type termAlt struct {
+	Terms  []string
+	Weight float64
+}
+
+// querySlot is a query word, or a phrase from the synonym dictionary, with
+// the alternatives it can be matched by.
+type querySlot []termAlt
+
+// terms lists every term the slot's alternatives use.
+func (s querySlot) terms() []string {
+	var out []string
+	for _, a := range s {
+		for _, t := range a.Terms {
+			if !sharesString([]string{t}, out) {
+				out = append(out, t)
+			}
+		}
+	}
+	return out
+}
+
+// best is the alternative a text with terms has, with the highest weight,
+// or nil.
+func (s querySlot) best(has map[string]bool) *termAlt {
+	var best *termAlt
+	for i, a := range s {
+		ok := true
+		for _, t := range a.Terms {
+			if !has[t] {
+				ok = false
+				break
+			}
+		}
+		if ok && (best == nil || a.Weight > best.Weight) {
+			best = &s[i]
+		}
+	}
+	return best
+}
+
+// compileQuery turns text into slots, one per word or synonym phrase. Words
+// are expanded against vocab, the indexed terms, for transliterations and
+// typos; with prefix, also to the terms they start.
+func compileQuery(text string, vocab []vocabTerm, prefix bool) []querySlot {
+	ws := words(text)
+	stems := make([]string, len(ws))
+	for i, w := range ws {
+		stems[i] = stem(w)
+	}
+	var slots []querySlot
+	seen := map[string]bool{}
+	for i := 0; i < len(ws); {
+		alts, n := synonymAt(stems[i:])
+		if n == 0 {
+			alts, n = expandWord(ws[i], vocab, prefix), 1
+		}
+		if k := strings.Join(stems[i:i+n], " "); !seen[k] {
+			seen[k] = true
+			slots = append(slots, alts)
+		}
+		i += n
+	}
+	return slots
+}
+
+// slotsMatch reports whether a text with terms satisfies every slot.
+func slotsMatch(slots []querySlot, terms []string) bool {
+	has := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		has[t] = true
+	}
+	for _, s := range slots {
+		if s.best(has) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// partQuery is a parsed q. A part matches when it satisfies every slot, or
+// when Key is one of its part numbers.
+type partQuery struct {
+	Slots []querySlot
+	Key   string // q as a part number; only set when q has a digit
+}
+
+func parsePartQuery(q string, vocab []vocabTerm) partQuery {
+	pq := partQuery{Slots: compileQuery(q, vocab, false)}
+	if strings.ContainsAny(q, "0123456789") {
+		pq.Key = models.PartNumberKey(q)
+	}
+	return pq
+}
+
+func (q partQuery) IsZero() bool { return len(q.Slots) == 0 && q.Key == "" }
+
+// Terms lists every term the query can match on, for document frequencies.
+func (q partQuery) Terms() []string {
+	var out []string
+	for _, s := range q.Slots {
+		for _, t := range s.terms() {
+			if !sharesString([]string{t}, out) {
+				out = append(out, t)
+			}
+		}
+	}
+	return out
+}
+
+func (q partQuery) matches(p models.SparePart) bool {
+	if q.Key != "" && sharesString([]string{q.Key}, p.NumberKeys) {
+		return true
+	}
+	return len(q.Slots) > 0 && slotsMatch(q.Slots, p.SearchTerms)
+}
+
+// fieldQuery is a parsed brand or car_model filter. It is matched against
+// that field's terms alone, with prefixes allowed, so "bos" still finds
+// Bosch.
+type fieldQuery []querySlot
+
+func parseFieldQuery(text string, vocab []vocabTerm) fieldQuery {
+	return compileQuery(text, vocab, true)
+}
+
+func (q fieldQuery) matches(terms []string) bool {
+	return slotsMatch(q, terms)
+}
+
+// rankParts scores the parts q matched with BM25 over the weighted search
+// fields and sorts them best first. Each slot counts its best alternative
+// the part has, a phrase by the mean over its terms. df holds how many
+// active parts have each term and total how many active parts there are;
+// the average length is taken over the matches, which is close enough for
+// ordering them.
+func rankParts(parts []models.SparePart, q partQuery, df map[string]int, total int) {
+	type doc struct {
+		tf  map[string]float64
+		len float64
+	}
+	docs := make([]doc, len(parts))
+	avgLen := 0.0
+	for i := range parts {
+		d := doc{tf: map[string]float64{}}
+		for _, f := range partSearchFields {
+			terms := analyze(f.text(&parts[i]))
+			d.len += f.weight * float64(len(terms))
+			for _, t := range terms {
+				d.tf[t] += f.weight
+			}
+		}
+		docs[i] = d
+		avgLen += d.len
+	}
+	if len(parts) > 0 {
+		avgLen /= float64(len(parts))
+	}
+	if avgLen == 0 {
+		avgLen = 1
+	}
+
+	for i := range parts {
+		score := 0.0
+		has := make(map[string]bool, len(docs[i].tf))
+		for t := range docs[i].tf {
+			has[t] = true
+		}
+		for _, s := range q.Slots {
+			a := s.best(has)
+			if a == nil {
+				continue
+			}
+			sum := 0.0
+			for _, t := range a.Terms {
+				tf := docs[i].tf[t]
+				n := float64(df[t])
+				idf := math.Log(1 + (float64(total)-n+0.5)/(n+0.5))
+				sum += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*docs[i].len/avgLen))
+			}
+			score += a.Weight * sum / float64(len(a.Terms))
+		}
+		if q.Key != "" && sharesString([]string{q.Key}, parts[i].NumberKeys) {
+			score += numberKeyBoost
+		}
+		parts[i].Score = math.Round(score*1000) / 1000
+	}
+	sort.SliceStable(parts, func(i, j int) bool {
+		if parts[i].Score != parts[j].Score {
+			return parts[i].Score > parts[j].Score
+		}
+		return idLess(parts[i].ID, parts[j].ID)
+	})
+}
+
+// partMatcher is the fuzzy part of a PartFilter, q, brand and car_model,
+// compiled against the search vocabulary.
+type partMatcher struct {
+	f            PartFilter
+	q            partQuery
+	brand, model fieldQuery
+}
+
+// searchable clears the fields of f that hold nothing to search for, only
+// stop words, single letters or punctuation, so that they filter nothing
+// rather than everything.
+func searchable(f PartFilter) PartFilter {
+	for _, field := range []*string{&f.Q, &f.Brand, &f.CarModel} {
+		if len(words(*field)) == 0 {
+			*field = ""
+		}
+	}
+	return f
+}
+
+// newPartMatcher compiles the fuzzy fields of f, which searchable has
+// cleared of empty ones.
+func newPartMatcher(f PartFilter, vocab []vocabTerm) partMatcher {
+	m := partMatcher{f: f}
+	if f.Q != "" {
+		m.q = parsePartQuery(f.Q, vocab)
+	}
+	if f.Brand != "" {
+		m.brand = parseFieldQuery(f.Brand, vocab)
+	}
+	if f.CarModel != "" {
+		m.model = parseFieldQuery(f.CarModel, vocab)
+	}
+	return m
+}
+
+// fuzzy reports whether the filter has fields only matches can check.
+func (m partMatcher) fuzzy() bool { return m.f.Q != "" || m.f.Brand != "" || m.f.CarModel != "" }
+
+func (m partMatcher) matches(p models.SparePart) bool {
+	return (m.f.Q == "" || m.q.matches(p)) &&
+		(m.f.Brand == "" || m.brand.matches(p.BrandTerms)) &&
+		(m.f.CarModel == "" || m.model.matches(p.ModelTerms))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"carparts/models"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SearchIndex holds what search needs to know about the whole catalog for
+// the MemoryRepo: the distinct search terms of active parts, which query
+// words are expanded against, and how many parts have each, for ranking. Its
+// part writes keep it current. The Repo keeps the same counts in the
+// search_terms collection instead, for every instance to share.
+type SearchIndex struct {
+	mu    sync.RWMutex
+	df    map[string]int
+	parts map[primitive.ObjectID][]string // the terms each active part is counted under
+	vocab []vocabTerm                     // nil once a term comes or goes, until asked for
+}
+
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{
+		df:    map[string]int{},
+		parts: map[primitive.ObjectID][]string{},
+	}
+}
+
+// SetPart counts p under its search terms, in place of whatever it was
+// counted under before. Inactive parts count for nothing.
+func (x *SearchIndex) SetPart(p models.SparePart) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.setPartLocked(p)
+}
+
+// RemovePart stops counting the part.
+func (x *SearchIndex) RemovePart(id primitive.ObjectID) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.removePartLocked(id)
+}
+
+func (x *SearchIndex) setPartLocked(p models.SparePart) {
+	x.removePartLocked(p.ID)
+	if !p.IsActive {
+		return
+	}
+	terms := append([]string{}, p.SearchTerms...)
+	for _, t := range terms {
+		x.df[t]++
+		if x.df[t] == 1 {
+			x.vocab = nil
+		}
+	}
+	x.parts[p.ID] = terms
+}
+
+func (x *SearchIndex) removePartLocked(id primitive.ObjectID) {
+	for _, t := range x.parts[id] {
+		x.df[t]--
+		if x.df[t] == 0 {
+			delete(x.df, t)
+			x.vocab = nil
+		}
+	}
+	delete(x.parts, id)
+}
+
+// Vocabulary lists the distinct terms in order. It is shared between
+// callers, who must not change it.
+func (x *SearchIndex) Vocabulary() []vocabTerm {
+	x.mu.RLock()
+	v := x.vocab
+	x.mu.RUnlock()
+	if v != nil {
+		return v
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.vocab == nil {
+		terms := make([]string, 0, len(x.df))
+		for t := range x.df {
+			terms = append(terms, t)
+		}
+		sort.Strings(terms)
+		x.vocab = newVocabulary(terms)
+	}
+	return x.vocab
+}
+
+// Frequencies returns how many active parts have each of terms, and how many
+// active parts there are.
+func (x *SearchIndex) Frequencies(terms []string) (map[string]int, int) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	df := make(map[string]int, len(terms))
+	for _, t := range terms {
+		if n := x.df[t]; n > 0 {
+			df[t] = n
+		}
+	}
+	return df, len(x.parts)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMemorySearchFollowsPartWrites(t *testing.T) {
+	m := NewMemoryRepo()
+	ctx := context.Background()
+	c, err := m.CreateCategory(ctx, models.Category{Name: "Brakes"})
+	if err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+	mk := func(brand, model string) models.SparePart {
+		p, err := m.CreatePart(ctx, models.SparePart{CategoryID: c.ID, Brand: brand, CarModel: model, Price: 10, IsActive: true})
+		if err != nil {
+			t.Fatalf("create part: %v", err)
+		}
+		return p
+	}
+	search := func(q string) []models.SparePart {
+		parts, err := m.ListPartsFiltered(ctx, PartFilter{Q: q})
+		if err != nil {
+			t.Fatalf("search %q: %v", q, err)
+		}
+		return parts
+	}
+	a := mk("Bosch", "Camry")
+	b := mk("Denso", "Camry")
+
+	if got := search("denzo"); len(got) != 1 || got[0].ID != b.ID {
+		t.Fatalf("denzo found %+v, want the Denso part", got)
+	}
+	if df, total := m.search.Frequencies([]string{"camry", "bosch"}); total != 2 || df["camry"] != 2 || df["bosch"] != 1 {
+		t.Errorf("frequencies = %v of %d", df, total)
+	}
+
+	// a deactivated part leaves the vocabulary, so the typo no longer expands
+	if _, err := m.UpdatePart(ctx, b.ID, bson.M{"is_active": false}); err != nil {
+		t.Fatalf("deactivate: %v", err)
+	}
+	if got := search("denzo"); len(got) != 0 {
+		t.Errorf("denzo found %d parts after deactivation", len(got))
+	}
+
+	if _, err := m.UpdatePart(ctx, a.ID, bson.M{"brand": "Brembo"}); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if got := search("brembo"); len(got) != 1 || got[0].ID != a.ID {
+		t.Errorf("brembo found %+v, want the renamed part", got)
+	}
+	if got := search("bosh"); len(got) != 0 {
+		t.Errorf("bosh found %d parts after the rename", len(got))
+	}
+
+	if err := m.DeletePart(ctx, a.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if df, total := m.search.Frequencies([]string{"camry"}); total != 0 || len(df) != 0 {
+		t.Errorf("after delete: frequencies = %v of %d", df, total)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"sort"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestStem(t *testing.T) {
+	for _, tc := range []struct{ word, want string }{
+		// Russian
+		{"колодки", "колодк"},
+		{"колодка", "колодк"},
+		{"тормозные", "тормозн"},
+		{"фильтров", "фильтр"},
+		{"амортизаторы", "амортизатор"},
+		// Kazakh
+		{"сүзгісі", "сүзг"},
+		{"қалыптары", "қалып"},
+		{"дөңгелектер", "дөңгелек"},
+		// English
+		{"pads", "pad"},
+		{"filters", "filter"},
+		{"brakes", "brake"},
+		{"running", "run"},
+		// neither
+		{"2108", "2108"},
+		{"w211", "w211"},
+	} {
+		if got := stem(tc.word); got != tc.want {
+			t.Errorf("stem(%q) = %q, want %q", tc.word, got, tc.want)
+		}
+	}
+}
+
+func TestFoldWord(t *testing.T) {
+	for _, tc := range []struct{ word, want string }{
+		{"camry", "kamri"},
+		{"камри", "kamri"},
+		{"toyota", "toiota"},
+		{"тойота", "toiota"},
+		{"тайота", "taiota"},
+		{"жигули", "zhiguli"},
+		{"қалып", "kalip"},
+		{"ferrari", "ferari"},
+		{"chevrolet", "chevrolet"},
+		{"шевроле", "shevrole"},
+	} {
+		if got := foldWord(tc.word); got != tc.want {
+			t.Errorf("foldWord(%q) = %q, want %q", tc.word, got, tc.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, tc := range []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"kamri", "kamri", 1, 0},
+		{"kamri", "kamry", 1, 1},  // substitution
+		{"toiota", "toita", 2, 1}, // deletion
+		{"filter", "filtre", 2, 1},
+		{"abcd", "bacd", 1, 1}, // a swap is one edit
+		{"toiota", "taiota", 2, 1},
+		{"kitten", "sitting", 3, 3},
+		{"kitten", "sitting", 1, 2}, // gives up past the limit
+		{"ab", "abcde", 1, 2},
+	} {
+		if got := editDistance(tc.a, tc.b, tc.limit); got != tc.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tc.a, tc.b, tc.limit, got, tc.want)
+		}
+	}
+	for n, want := range map[int]int{2: 0, 3: 0, 4: 1, 5: 1, 6: 2, 10: 2} {
+		if got := fuzzyLimit(n); got != want {
+			t.Errorf("fuzzyLimit(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestExpandWord(t *testing.T) {
+	vocab := newVocabulary([]string{"toyota", "camry", "corolla", "bosch", "brake"})
+	for _, tc := range []struct {
+		word   string
+		prefix bool
+		want   string  // a term the word must expand to
+		weight float64 // with this weight
+	}{
+		{"тойота", false, "toyota", weightTranslit},
+		{"камри", false, "camry", weightTranslit},
+		{"kamri", false, "camry", weightTranslit},
+		{"тайота", false, "toyota", weightFuzzy},
+		{"corola", false, "corolla", weightTranslit}, // doubled letters collapse
+		{"corrolla", false, "corolla", weightTranslit},
+		{"bos", true, "bosch", weightPrefix},
+	} {
+		alts := expandWord(tc.word, vocab, tc.prefix)
+		found := false
+		for _, a := range alts {
+			if len(a.Terms) == 1 && a.Terms[0] == tc.want {
+				found = true
+				if a.Weight != tc.weight {
+					t.Errorf("%q -> %q weighs %v, want %v", tc.word, tc.want, a.Weight, tc.weight)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%q expands to %+v, want %q among them", tc.word, alts, tc.want)
+		}
+	}
+	// short words are not fuzzed: "bos" is no typo of "bosch" without prefix
+	for _, a := range expandWord("bos", vocab, false) {
+		if a.Terms[0] == "bosch" {
+			t.Errorf("bos expanded to bosch without prefix matching")
+		}
+	}
+}
+
+func TestSynonymAt(t *testing.T) {
+	alts, n := synonymAt(analyze("колодки"))
+	if n != 1 || !hasAlt(alts, analyze("brake pads")) {
+		t.Errorf("колодки: %d terms, alternatives %+v, want brake pads among them", n, alts)
+	}
+	alts, n = synonymAt(analyze("brake pads front"))
+	if n != 2 || !hasAlt(alts, analyze("колодки")) {
+		t.Errorf("brake pads: %d terms, alternatives %+v, want колодки among them", n, alts)
+	}
+	if _, n := synonymAt(analyze("camry")); n != 0 {
+		t.Errorf("camry spans %d synonym terms, want 0", n)
+	}
+}
+
+func hasAlt(alts []termAlt, terms []string) bool {
+	for _, a := range alts {
+		if equalStrings(a.Terms, terms) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMemorySearchExamples(t *testing.T) {
+	m := NewMemoryRepo()
+	ctx := context.Background()
+	c, err := m.CreateCategory(ctx, models.Category{Name: "Brakes"})
+	if err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+	mk := func(brand, model, desc string) primitive.ObjectID {
+		p, err := m.CreatePart(ctx, models.SparePart{
+			CategoryID: c.ID, Brand: brand, CarModel: model, Description: desc, Price: 10, IsActive: true,
+		})
+		if err != nil {
+			t.Fatalf("create part: %v", err)
+		}
+		return p.ID
+	}
+	camry := mk("Toyota", "Camry", "brake pads, front")
+	corolla := mk("Toyota", "Corolla", "oil filter")
+	lada := mk("Lada", "Vesta", "тормозные колодки")
+	all := []primitive.ObjectID{camry, corolla, lada}
+
+	for _, tc := range []struct {
+		f    PartFilter
+		want []primitive.ObjectID // in rank order when q is set
+	}{
+		{PartFilter{Q: "тойота камри"}, []primitive.ObjectID{camry}},
+		{PartFilter{Q: "toyota kamri"}, []primitive.ObjectID{camry}},
+		{PartFilter{Q: "Тайота"}, []primitive.ObjectID{corolla, camry}}, // the shorter text first
+		{PartFilter{Q: "колодки"}, []primitive.ObjectID{lada, camry}},
+		{PartFilter{Q: "brake pads"}, []primitive.ObjectID{camry, lada}},
+		{PartFilter{Brand: "тойота", CarModel: "королла"}, []primitive.ObjectID{corolla}},
+		{PartFilter{Brand: "toy"}, []primitive.ObjectID{camry, corolla}},
+		// nothing to search for filters nothing
+		{PartFilter{Q: "и для"}, all},
+		{PartFilter{Q: "a b"}, all},
+		{PartFilter{Q: "--"}, all},
+		{PartFilter{Q: "nissan"}, nil},
+	} {
+		got, err := m.ListPartsFiltered(ctx, tc.f)
+		if err != nil {
+			t.Fatalf("%+v: %v", tc.f, err)
+		}
+		ids := make([]primitive.ObjectID, len(got))
+		for i, p := range got {
+			ids[i] = p.ID
+		}
+		if tc.f.Q == "" || len(words(tc.f.Q)) == 0 {
+			// no ranking, so compare as sets
+			ids, tc.want = sortedIDs(ids), sortedIDs(tc.want)
+		}
+		if !equalIDs(ids, tc.want) {
+			t.Errorf("%+v found %v, want %v", tc.f, ids, tc.want)
+		}
+	}
+}
+
+func sortedIDs(ids []primitive.ObjectID) []primitive.ObjectID {
+	out := append([]primitive.ObjectID(nil), ids...)
+	sort.Slice(out, func(i, j int) bool { return idLess(out[i], out[j]) })
+	return out
+}
+
+func equalIDs(a, b []primitive.ObjectID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRankPartsBM25(t *testing.T) {
+	part := func(brand, desc string) models.SparePart {
+		p := models.SparePart{ID: primitive.NewObjectID(), Brand: brand, Description: desc, IsActive: true}
+		indexPart(&p)
+		return p
+	}
+	inBrand := part("Bosch", "brake pads")
+	inDesc := part("Denso", "brake pads, fits bosch calipers")
+	repeated := part("Febi", "bosch pads, bosch fit")
+	numbered := part("Valeo", "wiper blades")
+	numbered.PartNumber = "0 986 494 030"
+	numbered.SetNumberKeys()
+	parts := []models.SparePart{inDesc, repeated, numbered, inBrand}
+	vocab := newVocabulary([]string{"bosch", "brake", "pad", "denso", "febi", "valeo"})
+	df := map[string]int{"bosch": 3, "pad": 3, "brake": 2}
+
+	// a hit in the brand outweighs two in the description, which outweigh
+	// one
+	q := parsePartQuery("bosch", vocab)
+	ranked := append([]models.SparePart(nil), parts[:2]...)
+	ranked = append(ranked, inBrand)
+	rankParts(ranked, q, df, 100)
+	if ranked[0].ID != inBrand.ID || ranked[len(ranked)-1].ID != inDesc.ID {
+		t.Errorf("bosch ranked %s, %s, %s; want the brand hit first and the lone description hit last",
+			ranked[0].Brand, ranked[1].Brand, ranked[2].Brand)
+	}
+	for i := 1; i < len(ranked); i++ {
+		if ranked[i].Score > ranked[i-1].Score {
+			t.Errorf("scores out of order: %v", ranked)
+		}
+	}
+
+	// a rare term counts for more than a common one
+	rare := map[string]int{"brake": 1, "pad": 90}
+	twoWords := partQuery{Slots: []querySlot{
+		{{Terms: []string{"brake"}, Weight: weightExact}},
+		{{Terms: []string{"pad"}, Weight: weightExact}},
+	}}
+	ranked = []models.SparePart{part("A", "pads"), part("B", "brake")}
+	rankParts(ranked, twoWords, rare, 100)
+	if ranked[0].Brand != "B" {
+		t.Errorf("the part with the rare term ranked %s first", ranked[0].Brand)
+	}
+
+	// a query that is a part's number puts that part first
+	q = parsePartQuery("0986494030", vocab)
+	ranked = append([]models.SparePart(nil), parts...)
+	rankParts(ranked, q, df, 100)
+	if ranked[0].ID != numbered.ID || ranked[0].Score < numberKeyBoost {
+		t.Errorf("part number query ranked %s (%v) first", ranked[0].Brand, ranked[0].Score)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import "unicode"
+
+// stem reduces a lower-case word to the stem search matches on. The script
+// picks the stemmer: Cyrillic words with a letter only Kazakh uses go to the
+// Kazakh one, other Cyrillic words to Russian, Latin words to English.
+// Anything else, numbers included, is kept as is.
+func stem(word string) string {
+	rs := []rune(word)
+	cyrillic, latin, kazakh := false, false, false
+	for _, r := range rs {
+		switch {
+		case isKazakhLetter(r):
+			kazakh = true
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic = true
+		case r < 0x80 && unicode.IsLetter(r):
+			latin = true
+		}
+	}
+	switch {
+	case kazakh && !latin:
+		return string(stemKazakh(rs))
+	case cyrillic && !latin:
+		return string(stemRussian(rs))
+	case latin && !cyrillic && !kazakh:
+		return string(stemEnglish(rs))
+	}
+	return word
+}
+
+func isKazakhLetter(r rune) bool {
+	switch r {
+	case 'ә', 'ғ', 'қ', 'ң', 'ө', 'ұ', 'ү', 'һ', 'і':
+		return true
+	}
+	return false
+}
+
+func hasSuffix(w []rune, suf string) bool {
+	s := []rune(suf)
+	if len(s) > len(w) {
+		return false
+	}
+	for i := range s {
+		if w[len(w)-len(s)+i] != s[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// longestSuffix returns the longest of sufs w ends with at or after index
+// from, or "" when none does.
+func longestSuffix(w []rune, from int, sufs []string) string {
+	best := ""
+	for _, s := range sufs {
+		n := len([]rune(s))
+		if n > len([]rune(best)) && len(w)-n >= from && hasSuffix(w, s) {
+			best = s
+		}
+	}
+	return best
+}
+
+// -------- Russian --------
+// stemRussian is the Snowball Russian stemmer.
+
+var (
+	ruGerund1      = []string{"в", "вши", "вшись"}
+	ruGerund2      = []string{"ив", "ивши", "ившись", "ыв", "ывши", "ывшись"}
+	ruAdjective    = []string{"ее", "ие", "ые", "ое", "ими", "ыми", "ей", "ий", "ый", "ой", "ем", "им", "ым", "ом", "его", "ого", "ему", "ому", "их", "ых", "ую", "юю", "ая", "яя", "ою", "ею"}
+	ruParticiple1  = []string{"ем", "нн", "вш", "ющ", "щ"}
+	ruParticiple2  = []string{"ивш", "ывш", "ующ"}
+	ruReflexive    = []string{"ся", "сь"}
+	ruVerb1        = []string{"ла", "на", "ете", "йте", "ли", "й", "л", "ем", "н", "ло", "но", "ет", "ют", "ны", "ть", "ешь", "нно"}
+	ruVerb2        = []string{"ила", "ыла", "ена", "ейте", "уйте", "ите", "или", "ыли", "ей", "уй", "ил", "ыл", "им", "ым", "ен", "ило", "ыло", "ено", "ят", "ует", "уют", "ит", "ыт", "ены", "ить", "ыть", "ишь", "ую", "ю"}
+	ruNoun         = []string{"а", "ев", "ов", "ие", "ье", "е", "иями", "ями", "ами", "еи", "ии", "и", "ией", "ей", "ой", "ий", "й", "иям", "ям", "ием", "ем", "ам", "ом", "о", "у", "ах", "иях", "ях", "ы", "ь", "ию", "ью", "ю", "ия", "ья", "я"}
+	ruSuperlative  = []string{"ейш", "ейше"}
+	ruDerivational = []string{"ост", "ость"}
+)
+
+func isRuVowel(r rune) bool {
+	switch r {
+	case 'а', 'е', 'и', 'о', 'у', 'ы', 'э', 'ю', 'я':
+		return true
+	}
+	return false
+}
+
+func stemRussian(w []rune) []rune {
+	for i, r := range w {
+		if r == 'ё' {
+			w[i] = 'е'
+		}
+	}
+	// rv starts after the first vowel; r1 after the first consonant that
+	// follows a vowel, and r2 likewise within r1
+	rv, r1, r2 := len(w), len(w), len(w)
+	for i, r := range w {
+		if isRuVowel(r) {
+			rv = i + 1
+			break
+		}
+	}
+	for i := 1; i < len(w); i++ {
+		if !isRuVowel(w[i]) && isRuVowel(w[i-1]) {
+			r1 = i + 1
+			break
+		}
+	}
+	for i := r1 + 1; i < len(w); i++ {
+		if !isRuVowel(w[i]) && isRuVowel(w[i-1]) {
+			r2 = i + 1
+			break
+		}
+	}
+
+	// cut removes the longest suffix from either group found in rv; group
+	// one also needs а or я in front of it.
+	cut := func(group1, group2 []string) bool {
+		s1 := longestSuffix(w, rv, group1)
+		s2 := longestSuffix(w, rv, group2)
+		n1, n2 := len([]rune(s1)), len([]rune(s2))
+		if n2 > 0 && n2 >= n1 {
+			w = w[:len(w)-n2]
+			return true
+		}
+		if n1 > 0 && len(w)-n1-1 >= 0 && (w[len(w)-n1-1] == 'а' || w[len(w)-n1-1] == 'я') {
+			w = w[:len(w)-n1]
+			return true
+		}
+		return false
+	}
+
+	// step 1
+	if !cut(ruGerund1, ruGerund2) {
+		if s := longestSuffix(w, rv, ruReflexive); s != "" {
+			w = w[:len(w)-len([]rune(s))]
+		}
+		if s := longestSuffix(w, rv, ruAdjective); s != "" {
+			w = w[:len(w)-len([]rune(s))]
+			cut(ruParticiple1, ruParticiple2)
+		} else if !cut(ruVerb1, ruVerb2) {
+			if s := longestSuffix(w, rv, ruNoun); s != "" {
+				w = w[:len(w)-len([]rune(s))]
+			}
+		}
+	}
+	// step 2
+	if len(w) > rv && w[len(w)-1] == 'и' {
+		w = w[:len(w)-1]
+	}
+	// step 3
+	if s := longestSuffix(w, r2, ruDerivational); s != "" {
+		w = w[:len(w)-len([]rune(s))]
+	}
+	// step 4
+	if s := longestSuffix(w, rv, ruSuperlative); s != "" {
+		w = w[:len(w)-len([]rune(s))]
+	}
+	switch {
+	case len(w)-2 >= rv && hasSuffix(w, "нн"):
+		w = w[:len(w)-1]
+	case len(w) > rv && w[len(w)-1] == 'ь':
+		w = w[:len(w)-1]
+	}
+	return w
+}
+
+// -------- Kazakh --------
+// Kazakh is agglutinative: stemKazakh peels plural, possessive and case
+// endings off the end, longest first, while at least kzMinStem letters
+// remain. It is deliberately light; index and query go through the same
+// rules, so over-stemming only merges a few unrelated words.
+
+const kzMinStem = 3
+
+var kzSuffixes = []string{
+	// plural
+	"лар", "лер", "дар", "дер", "тар", "тер",
+	// possessive
+	"ымыз", "іміз", "ыңыз", "іңіз", "мыз", "міз", "ңыз", "ңіз", "ым", "ім", "ың", "ің", "сы", "сі", "м", "ң", "ы", "і",
+	// genitive, dative, accusative
+	"ның", "нің", "дың", "дің", "тың", "тің", "ға", "ге", "қа", "ке", "на", "не", "ны", "ні", "ды", "ді", "ты", "ті", "а", "е", "н",
+	// locative, ablative, instrumental
+	"нда", "нде", "да", "де", "та", "те", "нан", "нен", "дан", "ден", "тан", "тен", "мен", "бен", "пен",
+}
+
+func stemKazakh(w []rune) []rune {
+	for round := 0; round < 3; round++ {
+		s := longestSuffix(w, kzMinStem, kzSuffixes)
+		if s == "" {
+			break
+		}
+		w = w[:len(w)-len([]rune(s))]
+	}
+	return w
+}
+
+// -------- English --------
+// stemEnglish covers step 1 of Porter2: plurals, possessives and -ed/-ing,
+// which is where part names vary.
+
+func isEnVowel(r rune) bool {
+	switch r {
+	case 'a', 'e', 'i', 'o', 'u', 'y':
+		return true
+	}
+	return false
+}
+
+func hasEnVowel(w []rune) bool {
+	for _, r := range w {
+		if isEnVowel(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func stemEnglish(w []rune) []rune {
+	if len(w) <= 2 {
+		return w
+	}
+	switch {
+	case hasSuffix(w, "'s"):
+		w = w[:len(w)-2]
+	case hasSuffix(w, "'"):
+		w = w[:len(w)-1]
+	}
+
+	switch {
+	case hasSuffix(w, "sses"):
+		w = w[:len(w)-2]
+	case hasSuffix(w, "ies"), hasSuffix(w, "ied"):
+		if len(w) > 4 {
+			w = w[:len(w)-2]
+		} else {
+			w = w[:len(w)-1]
+		}
+	case hasSuffix(w, "ss"), hasSuffix(w, "us"):
+	case hasSuffix(w, "s") && len(w) > 2:
+		if hasEnVowel(w[:len(w)-2]) {
+			w = w[:len(w)-1]
+		}
+	}
+
+	switch {
+	case hasSuffix(w, "eedly"):
+		return w[:len(w)-2]
+	case hasSuffix(w, "eed"):
+		return w
+	}
+	for _, suf := range []string{"ingly", "edly", "ing", "ed"} {
+		if !hasSuffix(w, suf) {
+			continue
+		}
+		base := w[:len(w)-len(suf)]
+		if !hasEnVowel(base) {
+			break
+		}
+		w = base
+		n := len(w)
+		switch {
+		case hasSuffix(w, "at"), hasSuffix(w, "bl"), hasSuffix(w, "iz"):
+			w = append(w, 'e')
+		case n >= 2 && w[n-1] == w[n-2] && !isEnVowel(w[n-1]) && w[n-1] != 'l' && w[n-1] != 's' && w[n-1] != 'z':
+			w = w[:n-1]
+		case isShortEnWord(w):
+			w = append(w, 'e')
+		}
+		break
+	}
+	return w
+}
+
+// isShortEnWord reports a single-syllable word ending consonant, vowel,
+// consonant, like "hop" or "brak", which lost an e before -ing.
+func isShortEnWord(w []rune) bool {
+	n := len(w)
+	if n < 3 {
+		return false
+	}
+	groups := 0
+	for i, r := range w {
+		if isEnVowel(r) && (i == 0 || !isEnVowel(w[i-1])) {
+			groups++
+		}
+	}
+	c := w[n-1]
+	return groups == 1 && !isEnVowel(c) && c != 'w' && c != 'x' && isEnVowel(w[n-2]) && !isEnVowel(w[n-3])
+}
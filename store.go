@@ -0,0 +1,309 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Lookups that find nothing return mongo.ErrNoDocuments from every backend,
+// so handlers can check for it without knowing which store they talk to.
+
+type CategoryStore interface {
+	CreateCategory(ctx context.Context, c models.Category) (models.Category, error)
+	ListCategories(ctx context.Context) ([]models.Category, error)
+	GetCategory(ctx context.Context, id primitive.ObjectID) (models.Category, error)
+	UpdateCategory(ctx context.Context, id primitive.ObjectID, name, desc string) (models.Category, error)
+	// SetCategoryThresholds replaces the category's thresholds; nil fields
+	// are cleared.
+	SetCategoryThresholds(ctx context.Context, id primitive.ObjectID, t models.StockThresholds) (models.Category, error)
+	DeleteCategory(ctx context.Context, id primitive.ObjectID) error
+}
+
+// PartFilter narrows ListPartsFiltered to active parts matching every set
+// field. Q, Brand and CarModel match by word, forgiving typos and
+// transliteration and taking synonyms; Brand and CarModel also match word
+// prefixes. Compatibility matches a case-insensitive substring.
+type PartFilter struct {
+	CategoryID    *primitive.ObjectID
+	CarModel      string
+	Brand         string
+	Q             string // description, brand, car model or part number
+	Compatibility string
+	IsNew         *bool
+	InStock       *bool    // some stock is not reserved
+	MinPrice      *float64 // inclusive
+	MaxPrice      *float64 // exclusive, like the price facet's buckets
+	// IDs, when not nil, keeps only these parts; empty matches nothing.
+	IDs []primitive.ObjectID
+	// NumberKeys, when not nil, keeps parts carrying any of these part
+	// numbers, folded by models.PartNumberKey.
+	NumberKeys []string
+}
+
+type PartStore interface {
+	CreatePart(ctx context.Context, p models.SparePart) (models.SparePart, error)
+	GetPart(ctx context.Context, id primitive.ObjectID) (models.SparePart, error)
+	DeletePart(ctx context.Context, id primitive.ObjectID) error
+	UpdatePart(ctx context.Context, id primitive.ObjectID, upd bson.M) (models.SparePart, error)
+	ListPartsFiltered(ctx context.Context, f PartFilter) ([]models.SparePart, error)
+	// PartFacets counts the parts ListPartsFiltered would return by brand,
+	// category, car model, condition, price bucket and stock.
+	PartFacets(ctx context.Context, f PartFilter) (models.PartFacets, error)
+}
+
+// OrderFilter narrows ListOrders. Zero fields do not filter; To is exclusive.
+type OrderFilter struct {
+	CustomerID *primitive.ObjectID
+	Status     string
+	IsPaid     *bool
+	From       time.Time
+	To         time.Time
+}
+
+type OrderStore interface {
+	PlaceOrder(ctx context.Context, o models.Order) (models.Order, error)
+	GetOrder(ctx context.Context, id primitive.ObjectID) (models.Order, error)
+	// ListOrders returns one page sorted by created_at and the cursor of the
+	// next page ("" when there is none).
+	ListOrders(ctx context.Context, f OrderFilter, pr PageRequest) ([]models.Order, string, error)
+	// UpdateOrderStatus returns ErrInvalidTransition for moves the order
+	// lifecycle does not allow. actor is recorded in the status history.
+	UpdateOrderStatus(ctx context.Context, id primitive.ObjectID, status, actor string) (models.Order, error)
+	// CancelOrder returns the items to stock exactly once; canceling a
+	// canceled order succeeds without touching stock.
+	CancelOrder(ctx context.Context, id primitive.ObjectID, actor string) (models.Order, error)
+	// PartDemand sums the quantities ordered per part since since, leaving
+	// out canceled and refunded orders. Unpaid orders count, since their
+	// items are held.
+	PartDemand(ctx context.Context, since time.Time) (map[primitive.ObjectID]int, error)
+}
+
+// CustomerStore returns ErrDuplicate when an email or phone is already taken.
+type CustomerStore interface {
+	CreateCustomer(ctx context.Context, c models.Customer) (models.Customer, error)
+	GetCustomer(ctx context.Context, id primitive.ObjectID) (models.Customer, error)
+	GetCustomerByEmail(ctx context.Context, email string) (models.Customer, error)
+	ListCustomers(ctx context.Context) ([]models.Customer, error)
+	UpdateCustomer(ctx context.Context, id primitive.ObjectID, upd bson.M) (models.Customer, error)
+	DeleteCustomer(ctx context.Context, id primitive.ObjectID) error
+}
+
+// WarehouseStore keeps per-location stock. SparePart.Stock stays the total
+// over all warehouses for parts that have levels.
+type WarehouseStore interface {
+	CreateWarehouse(ctx context.Context, w models.Warehouse) (models.Warehouse, error)
+	ListWarehouses(ctx context.Context) ([]models.Warehouse, error)
+	GetWarehouse(ctx context.Context, id primitive.ObjectID) (models.Warehouse, error)
+	UpdateWarehouse(ctx context.Context, id primitive.ObjectID, upd bson.M) (models.Warehouse, error)
+	// DeleteWarehouse returns ErrWarehouseNotEmpty while it still holds stock.
+	DeleteWarehouse(ctx context.Context, id primitive.ObjectID) error
+	ListInventory(ctx context.Context, warehouseID primitive.ObjectID) ([]models.InventoryLevel, error)
+	// PartInventory lists a part's levels, fullest warehouse first.
+	PartInventory(ctx context.Context, partID primitive.ObjectID) ([]models.InventoryLevel, error)
+	SetStock(ctx context.Context, warehouseID, partID primitive.ObjectID, qty int) (models.InventoryLevel, error)
+}
+
+// TransferStore moves stock between warehouses. Dispatch and receive return
+// ErrTransferState when the transfer is not draft or in_transit respectively.
+type TransferStore interface {
+	CreateTransfer(ctx context.Context, t models.StockTransfer) (models.StockTransfer, error)
+	GetTransfer(ctx context.Context, id primitive.ObjectID) (models.StockTransfer, error)
+	// ListTransfers returns newest first; an empty status lists all of them.
+	ListTransfers(ctx context.Context, status string) ([]models.StockTransfer, error)
+	DispatchTransfer(ctx context.Context, id primitive.ObjectID) (models.StockTransfer, error)
+	// ReceiveTransfer takes the counted quantity per part; parts left out
+	// arrived in full.
+	ReceiveTransfer(ctx context.Context, id primitive.ObjectID, received map[primitive.ObjectID]int) (models.StockTransfer, error)
+}
+
+// ReservationStore backs the expiry worker. Holds themselves are created by
+// PlaceOrder, committed by the move to paid and released by CancelOrder.
+type ReservationStore interface {
+	// ReleaseExpiredReservations cancels the orders whose holds expired by
+	// now and reports how many it handled.
+	ReleaseExpiredReservations(ctx context.Context, now time.Time) (int, error)
+}
+
+// CartStore keeps one cart per customer and per anonymous session.
+// SaveCart inserts carts with a zero ID and replaces the others.
+type CartStore interface {
+	GetCustomerCart(ctx context.Context, customerID primitive.ObjectID) (models.Cart, error)
+	GetSessionCart(ctx context.Context, sessionHash string) (models.Cart, error)
+	SaveCart(ctx context.Context, c models.Cart) (models.Cart, error)
+	DeleteCart(ctx context.Context, id primitive.ObjectID) error
+}
+
+type SessionStore interface {
+	CreateSession(ctx context.Context, s models.Session) (models.Session, error)
+	GetSession(ctx context.Context, id primitive.ObjectID) (models.Session, error)
+	// RotateSession swaps the refresh hash only if it still equals oldHash,
+	// so a refresh token can be redeemed once.
+	RotateSession(ctx context.Context, id primitive.ObjectID, oldHash, newHash string, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, id primitive.ObjectID) error
+}
+
+// AlertStore keeps at most one unresolved low-stock alert per part.
+// UpdateAlertStatus returns ErrInvalidTransition for moves the lifecycle
+// does not allow and ErrConflict if the alert changed underneath.
+type AlertStore interface {
+	ListAlerts(ctx context.Context, status string, limit int64) ([]models.LowStockAlert, error)
+	GetAlert(ctx context.Context, id primitive.ObjectID) (models.LowStockAlert, error)
+	// CurrentAlert returns the part's alert that is not yet resolved.
+	CurrentAlert(ctx context.Context, partID primitive.ObjectID) (models.LowStockAlert, error)
+	UpdateAlertStatus(ctx context.Context, id primitive.ObjectID, status, actor string) (models.LowStockAlert, error)
+	// ListAlertsSince lists the alerts opened after afterID, oldest first,
+	// for resuming an alert stream.
+	ListAlertsSince(ctx context.Context, afterID primitive.ObjectID, limit int64) ([]models.LowStockAlert, error)
+	// SyncLowStockAlert opens, refreshes or resolves the part's alert and
+	// returns the alert if it was just opened.
+	SyncLowStockAlert(ctx context.Context, partID primitive.ObjectID) (*models.LowStockAlert, error)
+}
+
+// OutboxStore is the delivery side of the outbox that stock-changing writes
+// fill. ClaimOutbox leases up to n due events so only one worker delivers
+// each; a delivered event is completed, a failed one retried at a later time
+// or, once out of attempts, moved to the dead letters.
+type OutboxStore interface {
+	ClaimOutbox(ctx context.Context, now time.Time, lease time.Duration, n int) ([]models.OutboxEvent, error)
+	CompleteOutbox(ctx context.Context, id primitive.ObjectID) error
+	RetryOutbox(ctx context.Context, id primitive.ObjectID, lastErr string, at time.Time) error
+	DeadLetterOutbox(ctx context.Context, id primitive.ObjectID, lastErr string) error
+	ListDeadLetters(ctx context.Context, limit int64) ([]models.OutboxEvent, error)
+	RequeueDeadLetter(ctx context.Context, id primitive.ObjectID) (models.OutboxEvent, error)
+	// OutboxSignal fires, without blocking the writer, when events are added.
+	OutboxSignal() <-chan struct{}
+}
+
+// WebhookStore keeps the webhook subscriptions and their deliveries, which
+// double as the retry queue and the delivery log.
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, s models.WebhookSubscription) (models.WebhookSubscription, error)
+	ListWebhooks(ctx context.Context) ([]models.WebhookSubscription, error)
+	GetWebhook(ctx context.Context, id primitive.ObjectID) (models.WebhookSubscription, error)
+	UpdateWebhook(ctx context.Context, id primitive.ObjectID, upd bson.M) (models.WebhookSubscription, error)
+	DeleteWebhook(ctx context.Context, id primitive.ObjectID) error
+
+	// EnqueueWebhookDeliveries queues the event for every active subscription
+	// that wants it, at most once per subscription and eventID.
+	EnqueueWebhookDeliveries(ctx context.Context, eventID, event string, payload []byte) (int, error)
+	CreateWebhookDelivery(ctx context.Context, d models.WebhookDelivery) (models.WebhookDelivery, error)
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, n int) ([]models.WebhookDelivery, error)
+	SaveWebhookDelivery(ctx context.Context, d models.WebhookDelivery) error
+	ListWebhookDeliveries(ctx context.Context, subscriptionID primitive.ObjectID, limit int64) ([]models.WebhookDelivery, error)
+	// WebhookSignal fires when deliveries are queued.
+	WebhookSignal() <-chan struct{}
+}
+
+type SupplierStore interface {
+	CreateSupplier(ctx context.Context, s models.Supplier) (models.Supplier, error)
+	ListSuppliers(ctx context.Context) ([]models.Supplier, error)
+	GetSupplier(ctx context.Context, id primitive.ObjectID) (models.Supplier, error)
+	UpdateSupplier(ctx context.Context, id primitive.ObjectID, upd bson.M) (models.Supplier, error)
+	DeleteSupplier(ctx context.Context, id primitive.ObjectID) error
+	SetSupplierPrice(ctx context.Context, id primitive.ObjectID, p models.SupplierPrice) (models.Supplier, error)
+	RemoveSupplierPrice(ctx context.Context, id, partID primitive.ObjectID) (models.Supplier, error)
+}
+
+type PurchaseOrderStore interface {
+	CreatePurchaseOrder(ctx context.Context, po models.PurchaseOrder) (models.PurchaseOrder, error)
+	GetPurchaseOrder(ctx context.Context, id primitive.ObjectID) (models.PurchaseOrder, error)
+	ListPurchaseOrders(ctx context.Context, status string, supplierID *primitive.ObjectID) ([]models.PurchaseOrder, error)
+	DeletePurchaseOrder(ctx context.Context, id primitive.ObjectID) error
+	SendPurchaseOrder(ctx context.Context, id primitive.ObjectID) (models.PurchaseOrder, error)
+	// ReceivePurchaseOrder books goods into the order's warehouse or, when it
+	// has none, into warehouseID. Parts stocked per warehouse are refused
+	// with ErrReceiptWarehouse if neither is set; a part not yet stocked per
+	// warehouse that is received into one takes its stock there, and is
+	// refused with ErrUnallocatedHolds while some of it is held.
+	ReceivePurchaseOrder(ctx context.Context, id primitive.ObjectID, warehouseID *primitive.ObjectID, received map[primitive.ObjectID]int, actor string) (models.PurchaseOrder, error)
+	// PendingPurchaseAlertIDs are the alerts an open purchase order already
+	// covers.
+	PendingPurchaseAlertIDs(ctx context.Context) (map[primitive.ObjectID]bool, error)
+	// OnOrderByPart sums what open purchase orders still wait for per part.
+	OnOrderByPart(ctx context.Context) (map[primitive.ObjectID]int, error)
+}
+
+// VehicleFilter narrows ListVehicles. Zero fields do not filter; Make and
+// Model match the folded name exactly and Year must fall in the variant's
+// production range.
+type VehicleFilter struct {
+	Make       string
+	Model      string
+	Year       int
+	EngineCode string
+	BodyType   string
+	// IDs, when not nil, keeps only these vehicles; empty matches nothing.
+	IDs []primitive.ObjectID
+}
+
+func (f VehicleFilter) IsZero() bool {
+	return f.Make == "" && f.Model == "" && f.Year == 0 && f.EngineCode == "" && f.BodyType == "" && f.IDs == nil
+}
+
+type VehicleStore interface {
+	CreateVehicle(ctx context.Context, v models.Vehicle) (models.Vehicle, error)
+	GetVehicle(ctx context.Context, id primitive.ObjectID) (models.Vehicle, error)
+	ListVehicles(ctx context.Context, f VehicleFilter) ([]models.Vehicle, error)
+	ReplaceVehicle(ctx context.Context, v models.Vehicle) (models.Vehicle, error)
+	// DeleteVehicle also drops the vehicle's fitments.
+	DeleteVehicle(ctx context.Context, id primitive.ObjectID) error
+	// ListVehicleMakes and ListVehicleModels list distinct names, one per
+	// folded key.
+	ListVehicleMakes(ctx context.Context) ([]string, error)
+	ListVehicleModels(ctx context.Context, make string) ([]string, error)
+
+	// AddFitment creates the fitment or updates its note.
+	AddFitment(ctx context.Context, f models.Fitment) (models.Fitment, error)
+	RemoveFitment(ctx context.Context, partID, vehicleID primitive.ObjectID) error
+	PartFitments(ctx context.Context, partID primitive.ObjectID) ([]models.Fitment, error)
+	// FittingPartIDs are the parts fitted to any vehicle f matches. It is
+	// never nil, so it can go straight into PartFilter.IDs.
+	FittingPartIDs(ctx context.Context, f VehicleFilter) ([]primitive.ObjectID, error)
+}
+
+type CrossReferenceStore interface {
+	CreateCrossReference(ctx context.Context, x models.CrossReference) (models.CrossReference, error)
+	GetCrossReference(ctx context.Context, id primitive.ObjectID) (models.CrossReference, error)
+	// ListCrossReferences lists the references holding any of keys, or all
+	// of them when keys is nil.
+	ListCrossReferences(ctx context.Context, keys []string) ([]models.CrossReference, error)
+	ReplaceCrossReference(ctx context.Context, x models.CrossReference) (models.CrossReference, error)
+	DeleteCrossReference(ctx context.Context, id primitive.ObjectID) error
+}
+
+// SuggestStore serves search-box completions from memory, without a
+// database round trip.
+type SuggestStore interface {
+	Suggest(prefix string, limit int) []Suggestion
+}
+
+// Store is everything the HTTP layer needs. Repo (MongoDB) and MemoryRepo
+// both implement it.
+type Store interface {
+	CategoryStore
+	PartStore
+	OrderStore
+	CustomerStore
+	WarehouseStore
+	TransferStore
+	ReservationStore
+	CartStore
+	SessionStore
+	AlertStore
+	OutboxStore
+	WebhookStore
+	SupplierStore
+	PurchaseOrderStore
+	VehicleStore
+	CrossReferenceStore
+	SuggestStore
+}
+
+var (
+	_ Store = (*Repo)(nil)
+	_ Store = (*MemoryRepo)(nil)
+)
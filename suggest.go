@@ -0,0 +1,280 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of completion.
+const (
+	SuggestBrand      = "brand"
+	SuggestCarModel   = "car_model"
+	SuggestCategory   = "category"
+	SuggestPartNumber = "part_number"
+)
+
+// Suggestion is a completion for the search box. Count is how many active
+// parts it finds.
+type Suggestion struct {
+	Text  string `json:"text"`
+	Kind  string `json:"kind"`
+	Count int    `json:"count"`
+}
+
+type suggestEntry struct {
+	Suggestion
+	id   string   // kind and key
+	keys []string // where the entry sits in the index while it has parts
+}
+
+type suggestKey struct {
+	key   string
+	entry *suggestEntry
+}
+
+// SuggestIndex is an in-process prefix index over the names and numbers the
+// catalog is searched by. The repos keep it current on every part and
+// category write; a process only sees its own writes, so with several
+// instances it is as fresh as their last restart for the others'.
+type SuggestIndex struct {
+	mu      sync.RWMutex
+	entries map[string]*suggestEntry
+	keys    []suggestKey // sorted by key, then entry id
+	parts   map[primitive.ObjectID][]string
+}
+
+func NewSuggestIndex() *SuggestIndex {
+	return &SuggestIndex{
+		entries: map[string]*suggestEntry{},
+		parts:   map[primitive.ObjectID][]string{},
+	}
+}
+
+// suggestNameKey folds a name for prefix matching: lower-case words joined
+// by single spaces.
+func suggestNameKey(s string) string { return strings.Join(tokenize(s), " ") }
+
+func suggestNumberKey(s string) string { return strings.ToLower(models.PartNumberKey(s)) }
+
+// Load replaces the index with the given categories and parts.
+func (x *SuggestIndex) Load(cats []models.Category, parts []models.SparePart) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.entries = map[string]*suggestEntry{}
+	x.keys = nil
+	x.parts = map[primitive.ObjectID][]string{}
+	for _, c := range cats {
+		x.setCategoryLocked(c)
+	}
+	for _, p := range parts {
+		x.setPartLocked(p)
+	}
+}
+
+// SetPart counts p under its brand, car model, category and numbers, in
+// place of whatever it was counted under before. Inactive parts count for
+// nothing.
+func (x *SuggestIndex) SetPart(p models.SparePart) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.setPartLocked(p)
+}
+
+// RemovePart stops counting the part.
+func (x *SuggestIndex) RemovePart(id primitive.ObjectID) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.removePartLocked(id)
+}
+
+// SetCategory names the category's entry.
+func (x *SuggestIndex) SetCategory(c models.Category) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.setCategoryLocked(c)
+}
+
+// RemoveCategory drops the category's name; its parts keep their other
+// entries.
+func (x *SuggestIndex) RemoveCategory(id primitive.ObjectID) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if e := x.entries[SuggestCategory+"\x00"+id.Hex()]; e != nil {
+		e.Text = ""
+		x.placeLocked(e)
+	}
+}
+
+func (x *SuggestIndex) setCategoryLocked(c models.Category) {
+	e := x.entryLocked(SuggestCategory, c.ID.Hex())
+	e.Text = c.Name
+	x.placeLocked(e)
+}
+
+func (x *SuggestIndex) setPartLocked(p models.SparePart) {
+	x.removePartLocked(p.ID)
+	if !p.IsActive {
+		return
+	}
+	var ids []string
+	add := func(kind, key, text string) {
+		if key == "" {
+			return
+		}
+		e := x.entryLocked(kind, key)
+		for _, id := range ids {
+			if id == e.id {
+				return
+			}
+		}
+		if e.Text == "" && kind != SuggestCategory {
+			e.Text = strings.TrimSpace(text)
+		}
+		e.Count++
+		ids = append(ids, e.id)
+		x.placeLocked(e)
+	}
+	add(SuggestBrand, suggestNameKey(p.Brand), p.Brand)
+	add(SuggestCarModel, suggestNameKey(p.CarModel), p.CarModel)
+	add(SuggestCategory, p.CategoryID.Hex(), "")
+	add(SuggestPartNumber, suggestNumberKey(p.PartNumber), p.PartNumber)
+	for _, n := range p.OEMNumbers {
+		add(SuggestPartNumber, suggestNumberKey(n), n)
+	}
+	x.parts[p.ID] = ids
+}
+
+func (x *SuggestIndex) removePartLocked(id primitive.ObjectID) {
+	for _, eid := range x.parts[id] {
+		e := x.entries[eid]
+		e.Count--
+		if e.Count == 0 && e.Kind != SuggestCategory {
+			x.unplaceLocked(e)
+			delete(x.entries, eid)
+			continue
+		}
+		x.placeLocked(e)
+	}
+	delete(x.parts, id)
+}
+
+func (x *SuggestIndex) entryLocked(kind, key string) *suggestEntry {
+	id := kind + "\x00" + key
+	e := x.entries[id]
+	if e == nil {
+		e = &suggestEntry{Suggestion: Suggestion{Kind: kind}, id: id}
+		x.entries[id] = e
+	}
+	return e
+}
+
+// placeLocked files e under the keys its text starts words at, or takes it
+// out of the index while it finds nothing.
+func (x *SuggestIndex) placeLocked(e *suggestEntry) {
+	var keys []string
+	if e.Count > 0 && e.Text != "" {
+		if e.Kind == SuggestPartNumber {
+			keys = []string{suggestNumberKey(e.Text)}
+		} else {
+			ws := tokenize(e.Text)
+			for i := range ws {
+				keys = append(keys, strings.Join(ws[i:], " "))
+			}
+		}
+	}
+	if equalStrings(keys, e.keys) {
+		return
+	}
+	x.unplaceLocked(e)
+	for _, k := range keys {
+		i := x.searchLocked(k, e.id)
+		x.keys = append(x.keys, suggestKey{})
+		copy(x.keys[i+1:], x.keys[i:])
+		x.keys[i] = suggestKey{k, e}
+	}
+	e.keys = keys
+}
+
+func (x *SuggestIndex) unplaceLocked(e *suggestEntry) {
+	for _, k := range e.keys {
+		i := x.searchLocked(k, e.id)
+		if i < len(x.keys) && x.keys[i].entry == e {
+			x.keys = append(x.keys[:i], x.keys[i+1:]...)
+		}
+	}
+	e.keys = nil
+}
+
+// searchLocked finds where key for the entry id sits, or would.
+func (x *SuggestIndex) searchLocked(key, id string) int {
+	return sort.Search(len(x.keys), func(i int) bool {
+		k := x.keys[i]
+		return k.key > key || k.key == key && k.entry.id >= id
+	})
+}
+
+// Suggest returns up to limit completions of prefix: entries with a word
+// starting with it, those whose text starts with it first, then by how many
+// parts they find.
+func (x *SuggestIndex) Suggest(prefix string, limit int) []Suggestion {
+	type hit struct {
+		e    *suggestEntry
+		lead bool
+	}
+	hits := map[*suggestEntry]bool{}
+	x.mu.RLock()
+	for _, p := range []string{suggestNameKey(prefix), suggestNumberKey(prefix)} {
+		if p == "" {
+			continue
+		}
+		for i := x.searchLocked(p, ""); i < len(x.keys) && strings.HasPrefix(x.keys[i].key, p); i++ {
+			k := x.keys[i]
+			hits[k.entry] = hits[k.entry] || k.key == k.entry.keys[0]
+		}
+	}
+	list := make([]hit, 0, len(hits))
+	for e, lead := range hits {
+		list = append(list, hit{e, lead})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		switch {
+		case a.lead != b.lead:
+			return a.lead
+		case a.e.Count != b.e.Count:
+			return a.e.Count > b.e.Count
+		case len(a.e.Text) != len(b.e.Text):
+			return len(a.e.Text) < len(b.e.Text)
+		}
+		return a.e.id < b.e.id
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	out := make([]Suggestion, len(list))
+	for i, h := range list {
+		out[i] = h.e.Suggestion
+	}
+	x.mu.RUnlock()
+	return out
+}
+
+// loadSuggestions fills the index from the store, for a process starting
+// on an existing catalog.
+func loadSuggestions(ctx context.Context, s Store, x *SuggestIndex) error {
+	cats, err := s.ListCategories(ctx)
+	if err != nil {
+		return err
+	}
+	parts, err := s.ListPartsFiltered(ctx, PartFilter{})
+	if err != nil {
+		return err
+	}
+	x.Load(cats, parts)
+	return nil
+}
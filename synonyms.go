@@ -0,0 +1,90 @@
+package main
+
+import "strings"
+
+// synonymGroups lists names that mean the same thing to a customer. Search
+// takes a query word or phrase found here for any name in its group. Names
+// go through the same analysis as queries, so spell them naturally; add to
+// the groups as search logs show what people type.
+var synonymGroups = [][]string{
+	// parts
+	{"колодки", "тормозные колодки", "brake pads", "тежегіш қалыптары"},
+	{"тормозной диск", "brake disc", "brake rotor", "тежегіш диск"},
+	{"фильтр", "filter", "сүзгі"},
+	{"масляный фильтр", "oil filter", "май сүзгісі"},
+	{"воздушный фильтр", "air filter", "ауа сүзгісі"},
+	{"салонный фильтр", "cabin filter", "pollen filter"},
+	{"топливный фильтр", "fuel filter", "отын сүзгісі"},
+	{"свеча зажигания", "свечи", "spark plug", "оталдыру шамы"},
+	{"амортизатор", "shock absorber", "стойка", "strut"},
+	{"ремень грм", "timing belt"},
+	{"аккумулятор", "акб", "battery"},
+	{"шина", "покрышка", "tyre", "tire", "дөңгелек"},
+	{"дворники", "щетки стеклоочистителя", "wiper blades"},
+	{"радиатор", "radiator"},
+	{"сцепление", "clutch"},
+	{"генератор", "alternator"},
+	{"стартер", "starter"},
+	{"подшипник", "bearing"},
+	{"масло", "oil", "май"},
+	{"лампа", "bulb"},
+	// makes
+	{"volkswagen", "vw", "фольксваген"},
+	{"mercedes", "мерседес", "benz"},
+	{"bmw", "бмв"},
+	{"lada", "лада", "ваз", "vaz"},
+	{"chevrolet", "шевроле", "chevy"},
+}
+
+// synonymPhrase is one analyzed name of a synonym group.
+type synonymPhrase struct {
+	terms []string
+	group int
+}
+
+var (
+	synonymPhrases   = map[string]synonymPhrase{} // by strings.Join(terms, " ")
+	synonymGroupAlts [][][]string                 // the analyzed names of each group
+	synonymMaxLen    int                          // most terms in a name
+)
+
+func init() {
+	for g, names := range synonymGroups {
+		var alts [][]string
+		for _, n := range names {
+			terms := analyze(n)
+			if len(terms) == 0 {
+				continue
+			}
+			synonymPhrases[strings.Join(terms, " ")] = synonymPhrase{terms, g}
+			alts = append(alts, terms)
+			if len(terms) > synonymMaxLen {
+				synonymMaxLen = len(terms)
+			}
+		}
+		synonymGroupAlts = append(synonymGroupAlts, alts)
+	}
+}
+
+// synonymAt finds the longest synonym name the terms start with. It returns
+// the alternatives for it, the name itself weighted highest, and how many
+// terms it spans; 0 when none does.
+func synonymAt(terms []string) ([]termAlt, int) {
+	for n := synonymMaxLen; n > 0; n-- {
+		if n > len(terms) {
+			continue
+		}
+		ph, ok := synonymPhrases[strings.Join(terms[:n], " ")]
+		if !ok {
+			continue
+		}
+		alts := []termAlt{{Terms: ph.terms, Weight: weightExact}}
+		for _, t := range synonymGroupAlts[ph.group] {
+			if !equalStrings(t, ph.terms) {
+				alts = append(alts, termAlt{Terms: t, Weight: weightSynonym})
+			}
+		}
+		return alts, n
+	}
+	return nil, 0
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidVIN is wrapped with what is wrong with the VIN.
+var ErrInvalidVIN = errors.New("invalid vin")
+
+// vinYearCodes are the model year codes in position 10, starting at 1980.
+// The cycle repeats every 30 years.
+const vinYearCodes = "ABCDEFGHJKLMNPRSTVWXY123456789"
+
+// vinWeights are the ISO 3779 position weights for the check digit in
+// position 9, which itself weighs nothing.
+var vinWeights = [17]int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+
+// VINInfo is what a VIN says about the vehicle. Make, Country, Model and
+// Plant come from vin_table.go and are empty when the table does not know
+// the code.
+type VINInfo struct {
+	VIN       string `json:"vin"`
+	WMI       string `json:"wmi"` // world manufacturer identifier
+	Region    string `json:"region"`
+	Make      string `json:"make,omitempty"`
+	Country   string `json:"country,omitempty"`
+	Model     string `json:"model,omitempty"`
+	ModelYear int    `json:"model_year"`
+	PlantCode string `json:"plant_code"`
+	Plant     string `json:"plant,omitempty"`
+	Serial    string `json:"serial"`
+	// CheckDigitOK tells whether position 9 is the ISO 3779 check digit.
+	// Only VINs from North America and China must have one; elsewhere the
+	// position is often just another manufacturer's character.
+	CheckDigitOK bool `json:"check_digit_ok"`
+}
+
+// DecodeVIN validates vin and decodes it. A wrong check digit fails only
+// where the region requires one (see vinNeedsCheckDigit); elsewhere it is
+// reported in CheckDigitOK. The model year code is ambiguous across 30-year
+// cycles; the latest year not after next year wins.
+func DecodeVIN(vin string, now time.Time) (VINInfo, error) {
+	vin = strings.ToUpper(strings.TrimSpace(vin))
+	if len(vin) != 17 {
+		return VINInfo{}, fmt.Errorf("%w: it must be 17 characters", ErrInvalidVIN)
+	}
+	sum := 0
+	for i := 0; i < len(vin); i++ {
+		v, ok := vinValue(vin[i])
+		if !ok {
+			return VINInfo{}, fmt.Errorf("%w: %q is not allowed", ErrInvalidVIN, vin[i])
+		}
+		sum += v * vinWeights[i]
+	}
+	check := byte('0' + sum%11)
+	if sum%11 == 10 {
+		check = 'X'
+	}
+	if vin[8] != check && vinNeedsCheckDigit(vin[0]) {
+		return VINInfo{}, fmt.Errorf("%w: check digit is %c, expected %c", ErrInvalidVIN, vin[8], check)
+	}
+	idx := strings.IndexByte(vinYearCodes, vin[9])
+	if idx < 0 {
+		return VINInfo{}, fmt.Errorf("%w: %q is not a model year code", ErrInvalidVIN, vin[9])
+	}
+	year := 1980 + idx
+	for year+30 <= now.Year()+1 {
+		year += 30
+	}
+
+	info := VINInfo{
+		VIN:       vin,
+		WMI:       vin[:3],
+		Region:    vinRegion(vin[0]),
+		ModelYear: year,
+		PlantCode: vin[10:11],
+		Serial:    vin[11:],
+
+		CheckDigitOK: vin[8] == check,
+	}
+	if m, ok := vinManufacturers[info.WMI]; ok {
+		info.Make, info.Country = m.Make, m.Country
+	}
+	vds := vin[3:8]
+	for _, m := range vinModels[info.WMI] {
+		if strings.HasPrefix(vds, m.VDSPrefix) {
+			info.Model = m.Model
+			break
+		}
+	}
+	info.Plant = vinPlants[info.WMI][vin[10]]
+	return info, nil
+}
+
+// vinValue transliterates one VIN character for the check digit. I, O and Q
+// are never used, being too easy to confuse with 1 and 0.
+func vinValue(c byte) (int, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0'), true
+	case c == 'I' || c == 'O' || c == 'Q':
+		return 0, false
+	case c >= 'A' && c <= 'H':
+		return int(c-'A') + 1, true
+	case c >= 'J' && c <= 'R':
+		return int(c-'J') + 1, true
+	case c >= 'S' && c <= 'Z':
+		return int(c-'S') + 2, true
+	}
+	return 0, false
+}
+
+// vinNeedsCheckDigit tells whether VINs whose first character is c must
+// carry a check digit: those of North America (1-5) and China (L).
+func vinNeedsCheckDigit(c byte) bool {
+	return c >= '1' && c <= '5' || c == 'L'
+}
+
+func vinRegion(c byte) string {
+	switch {
+	case c >= 'A' && c <= 'H':
+		return "Africa"
+	case c >= 'J' && c <= 'R':
+		return "Asia"
+	case c >= 'S' && c <= 'Z':
+		return "Europe"
+	case c >= '1' && c <= '5':
+		return "North America"
+	case c == '6' || c == '7':
+		return "Oceania"
+	case c == '8' || c == '9':
+		return "South America"
+	}
+	return ""
+}
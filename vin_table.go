@@ -0,0 +1,80 @@
+package main
+
+// The VIN lookup tables. They only cover the makes we stock parts for; add
+// to them as new ones come in. Make and model names should be spelled as in
+// the vehicle catalog, although matching ignores case, hyphens and spacing.
+
+type vinManufacturer struct {
+	Make    string
+	Country string
+}
+
+// vinManufacturers is keyed by WMI, the first three characters.
+var vinManufacturers = map[string]vinManufacturer{
+	"1FA": {"Ford", "United States"},
+	"1G1": {"Chevrolet", "United States"},
+	"1HG": {"Honda", "United States"},
+	"2T1": {"Toyota", "Canada"},
+	"4T1": {"Toyota", "United States"},
+	"5YJ": {"Tesla", "United States"},
+	"JF1": {"Subaru", "Japan"},
+	"JHM": {"Honda", "Japan"},
+	"JM1": {"Mazda", "Japan"},
+	"JMB": {"Mitsubishi", "Japan"},
+	"JN1": {"Nissan", "Japan"},
+	"JTD": {"Toyota", "Japan"},
+	"JTE": {"Toyota", "Japan"},
+	"JTH": {"Lexus", "Japan"},
+	"JTM": {"Toyota", "Japan"},
+	"JTN": {"Toyota", "Japan"},
+	"KMH": {"Hyundai", "South Korea"},
+	"KNA": {"Kia", "South Korea"},
+	"SAL": {"Land Rover", "United Kingdom"},
+	"TMB": {"Skoda", "Czech Republic"},
+	"VF1": {"Renault", "France"},
+	"VF3": {"Peugeot", "France"},
+	"WAU": {"Audi", "Germany"},
+	"WBA": {"BMW", "Germany"},
+	"WDB": {"Mercedes-Benz", "Germany"},
+	"WDD": {"Mercedes-Benz", "Germany"},
+	"WVW": {"Volkswagen", "Germany"},
+	"XTA": {"Lada", "Russia"},
+	"XW8": {"Volkswagen", "Russia"},
+	"XWB": {"Chevrolet", "Uzbekistan"},
+	"YV1": {"Volvo", "Sweden"},
+	"ZFA": {"Fiat", "Italy"},
+}
+
+// vinModel maps the start of the vehicle descriptor section (positions 4-8)
+// to a model. Descriptors are manufacturer-specific, so this only lists the
+// ones we have confirmed.
+type vinModel struct {
+	VDSPrefix string
+	Model     string
+}
+
+var vinModels = map[string][]vinModel{
+	"5YJ": {
+		{"S", "Model S"},
+		{"3", "Model 3"},
+		{"X", "Model X"},
+		{"Y", "Model Y"},
+	},
+	"XTA": {
+		{"2107", "2107"},
+		{"2121", "Niva"},
+		{"2170", "Priora"},
+		{"2172", "Priora"},
+		{"2190", "Granta"},
+		{"2192", "Kalina"},
+		{"GFL", "Vesta"},
+	},
+}
+
+// vinPlants maps the plant code in position 11 per WMI.
+var vinPlants = map[string]map[byte]string{
+	"1HG": {'A': "Marysville, Ohio", 'L': "East Liberty, Ohio"},
+	"4T1": {'U': "Georgetown, Kentucky"},
+	"5YJ": {'F': "Fremont, California", 'A': "Austin, Texas"},
+	"XTA": {'0': "Togliatti", 'Y': "Izhevsk"},
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDecodeVIN(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name    string
+		vin     string
+		now     time.Time
+		wantErr bool
+		want    VINInfo // the fields compared
+	}{
+		{
+			name: "north american",
+			vin:  "1hgcm82633a004352",
+			want: VINInfo{WMI: "1HG", Region: "North America", Make: "Honda", ModelYear: 2003, Plant: "Marysville, Ohio", CheckDigitOK: true},
+		},
+		{name: "north american, bad check digit", vin: "1HGCM82643A004352", wantErr: true},
+		{name: "chinese, bad check digit", vin: "LVSHCAMB2CE054249", wantErr: true},
+		{
+			// European makers put anything in position 9
+			name: "european",
+			vin:  "WVWZZZ1JZXW000001",
+			want: VINInfo{WMI: "WVW", Region: "Europe", Make: "Volkswagen", ModelYear: 1999},
+		},
+		{
+			name: "lada",
+			vin:  "XTA21099140000001",
+			want: VINInfo{WMI: "XTA", Region: "Europe", Make: "Lada", ModelYear: 2004, Plant: "Togliatti", CheckDigitOK: true},
+		},
+		{
+			// A is 1980 or 2010, and 2010 is not yet next year
+			name: "year cycle rolled over",
+			vin:  "XTA21099AA0000001",
+			now:  time.Date(2009, 6, 1, 0, 0, 0, 0, time.UTC),
+			want: VINInfo{WMI: "XTA", Region: "Europe", Make: "Lada", ModelYear: 2010, Plant: "Togliatti"},
+		},
+		{
+			name: "year cycle not rolled over",
+			vin:  "XTA21099AA0000001",
+			now:  time.Date(2008, 6, 1, 0, 0, 0, 0, time.UTC),
+			want: VINInfo{WMI: "XTA", Region: "Europe", Make: "Lada", ModelYear: 1980, Plant: "Togliatti"},
+		},
+		{name: "too short", vin: "1HGCM82633A00435", wantErr: true},
+		{name: "letter O", vin: "1HGCM82633A0O4352", wantErr: true},
+		{name: "bad year code", vin: "WVWZZZ1JZUW000001", wantErr: true},
+	} {
+		at := tc.now
+		if at.IsZero() {
+			at = now
+		}
+		got, err := DecodeVIN(tc.vin, at)
+		if tc.wantErr {
+			if !errors.Is(err, ErrInvalidVIN) {
+				t.Errorf("%s: error = %v, want ErrInvalidVIN", tc.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got.WMI != tc.want.WMI || got.Region != tc.want.Region || got.Make != tc.want.Make ||
+			got.ModelYear != tc.want.ModelYear || got.Plant != tc.want.Plant || got.CheckDigitOK != tc.want.CheckDigitOK {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
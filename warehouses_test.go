@@ -0,0 +1,97 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemorySetStockTakesOverUnallocatedStock(t *testing.T) {
+	m := NewMemoryRepo()
+	ctx := context.Background()
+	c, _ := m.CreateCategory(ctx, models.Category{Name: "Filters"})
+	wh, _ := m.CreateWarehouse(ctx, models.Warehouse{Name: "Main", City: "Almaty", IsActive: true})
+	p, err := m.CreatePart(ctx, models.SparePart{CategoryID: c.ID, Brand: "Mann", Price: 5, Stock: 3, IsActive: true})
+	if err != nil {
+		t.Fatalf("create part: %v", err)
+	}
+
+	if _, err := m.SetStock(ctx, wh.ID, p.ID, 4); err != nil {
+		t.Fatalf("set stock: %v", err)
+	}
+	if got := snapshotStock(t, m, p.ID); got.Stock != 4 || got.Levels[wh.ID] != [2]int{4, 0} {
+		t.Errorf("after the first level: %+v, want stock 4 all in the warehouse", got)
+	}
+
+	// later levels move the total by their own delta
+	other, _ := m.CreateWarehouse(ctx, models.Warehouse{Name: "North", City: "Astana", IsActive: true})
+	if _, err := m.SetStock(ctx, other.ID, p.ID, 2); err != nil {
+		t.Fatalf("set stock: %v", err)
+	}
+	if got := snapshotStock(t, m, p.ID); got.Stock != 6 {
+		t.Errorf("stock = %d, want 6", got.Stock)
+	}
+}
+
+func TestMemorySetStockRefusesWhileUnallocatedHeld(t *testing.T) {
+	m := NewMemoryRepo()
+	ctx := context.Background()
+	c, _ := m.CreateCategory(ctx, models.Category{Name: "Filters"})
+	wh, _ := m.CreateWarehouse(ctx, models.Warehouse{Name: "Main", City: "Almaty", IsActive: true})
+	p, _ := m.CreatePart(ctx, models.SparePart{CategoryID: c.ID, Brand: "Mann", Price: 5, Stock: 3, IsActive: true})
+	if _, err := m.PlaceOrder(ctx, models.Order{
+		Status: models.StatusCreated,
+		Items:  []models.OrderItem{{PartID: p.ID, Quantity: 1}},
+	}); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+
+	if _, err := m.SetStock(ctx, wh.ID, p.ID, 4); !errors.Is(err, ErrUnallocatedHolds) {
+		t.Fatalf("SetStock error = %v, want ErrUnallocatedHolds", err)
+	}
+	if got := snapshotStock(t, m, p.ID); got.Stock != 3 || got.Reserved != 1 || len(got.Levels) != 0 {
+		t.Errorf("refused SetStock changed the part: %+v", got)
+	}
+}
+
+func TestMemoryPlaceOrderSkipsInactiveWarehouses(t *testing.T) {
+	m := NewMemoryRepo()
+	ctx := context.Background()
+	c, _ := m.CreateCategory(ctx, models.Category{Name: "Filters"})
+	open, _ := m.CreateWarehouse(ctx, models.Warehouse{Name: "Main", City: "Almaty", IsActive: true})
+	closed, _ := m.CreateWarehouse(ctx, models.Warehouse{Name: "Old", City: "Almaty", IsActive: true})
+	p, err := m.CreatePart(ctx, models.SparePart{CategoryID: c.ID, Brand: "Mann", Price: 5, IsActive: true})
+	if err != nil {
+		t.Fatalf("create part: %v", err)
+	}
+	m.SetStock(ctx, open.ID, p.ID, 2)
+	m.SetStock(ctx, closed.ID, p.ID, 10)
+	if _, err := m.UpdateWarehouse(ctx, closed.ID, bson.M{"is_active": false}); err != nil {
+		t.Fatalf("deactivate: %v", err)
+	}
+
+	order := func(qty int, wh *primitive.ObjectID) (models.Order, error) {
+		return m.PlaceOrder(ctx, models.Order{
+			CustomerID: primitive.NewObjectID(),
+			Status:     models.StatusCreated,
+			Items:      []models.OrderItem{{PartID: p.ID, Quantity: qty, WarehouseID: wh}},
+		})
+	}
+	if _, err := order(5, nil); !errors.Is(err, ErrNotEnoughStock) {
+		t.Errorf("5 with only 2 in an active warehouse: error = %v, want ErrNotEnoughStock", err)
+	}
+	if _, err := order(1, &closed.ID); !errors.Is(err, ErrWarehouseInactive) {
+		t.Errorf("naming the inactive warehouse: error = %v, want ErrWarehouseInactive", err)
+	}
+	o, err := order(2, nil)
+	if err != nil {
+		t.Fatalf("2 from the active warehouse: %v", err)
+	}
+	if wh := o.Items[0].WarehouseID; wh == nil || *wh != open.ID {
+		t.Errorf("line fulfilled from %v, want %s", wh, open.ID.Hex())
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"carparts/models"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	webhookBatch       = 20
+	webhookLease       = time.Minute // longer than webhookTimeout
+	webhookPoll        = 5 * time.Second
+	webhookTimeout     = 10 * time.Second
+	webhookMaxAttempts = 10
+	webhookBaseBackoff = 5 * time.Second
+	webhookMaxBackoff  = 30 * time.Minute
+	webhookBodyLimit   = 512 // bytes of the receiver's answer kept in the log
+)
+
+// Headers sent with every webhook. The signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)); receivers
+// should also reject old timestamps to stop replays.
+const (
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookDeliveryHeader  = "X-Webhook-Delivery"
+	webhookTimestampHeader = "X-Webhook-Timestamp"
+	webhookSignatureHeader = "X-Webhook-Signature"
+)
+
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	// a redirect is an answer, not something to follow with the payload
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// webhookEnvelope is the body of every webhook.
+type webhookEnvelope struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// webhookOrder is the data of the order events. Status is the one the event
+// announces; Order is as loaded when the event went out and may be newer.
+type webhookOrder struct {
+	Status string       `json:"status"`
+	Order  models.Order `json:"order"`
+}
+
+func webhookPayload(eventID, event string, at time.Time, data any) ([]byte, error) {
+	return json.Marshal(webhookEnvelope{ID: eventID, Type: event, CreatedAt: at, Data: data})
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(timestamp))
+	m.Write([]byte("."))
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// attemptWebhook posts d to sub once and records the outcome on d: delivered,
+// due again after a backoff, or failed once d.MaxAttempts are used up.
+func attemptWebhook(ctx context.Context, sub models.WebhookSubscription, d *models.WebhookDelivery) {
+	now := time.Now()
+	d.Attempts++
+	d.ResponseCode, d.ResponseBody, d.LastError = 0, "", ""
+
+	code, body, err := postWebhook(ctx, sub, d, now)
+	d.ResponseCode, d.ResponseBody = code, body
+	switch {
+	case err != nil:
+		d.LastError = err.Error()
+	case code < 200 || code > 299:
+		d.LastError = fmt.Sprintf("receiver answered %d", code)
+	default:
+		d.Status = models.DeliverySucceeded
+		d.DeliveredAt = &now
+		return
+	}
+	if d.Attempts >= d.MaxAttempts {
+		d.Status = models.DeliveryFailed
+		return
+	}
+	d.NextAttemptAt = now.Add(retryBackoff(d.Attempts, webhookBaseBackoff, webhookMaxBackoff))
+}
+
+func postWebhook(ctx context.Context, sub models.WebhookSubscription, d *models.WebhookDelivery, at time.Time) (int, string, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	ts := strconv.FormatInt(at.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, d.Event)
+	req.Header.Set(webhookDeliveryHeader, d.ID.Hex())
+	req.Header.Set(webhookTimestampHeader, ts)
+	req.Header.Set(webhookSignatureHeader, signWebhook(sub.Secret, ts, body))
+
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(res.Body, webhookBodyLimit))
+	io.Copy(io.Discard, res.Body) // so the connection can be reused
+	return res.StatusCode, string(b), nil
+}
+
+// WebhookDispatcher sends queued webhook deliveries. Like the outbox worker
+// it is nudged when deliveries are queued and polls for retries coming due.
+type WebhookDispatcher struct {
+	s      WebhookStore
+	ctx    context.Context
+	cancel context.CancelFunc
+	quit   chan struct{}
+	done   chan struct{}
+}
+
+func StartWebhookDispatcher(s WebhookStore) *WebhookDispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &WebhookDispatcher{
+		s:      s,
+		ctx:    ctx,
+		cancel: cancel,
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+func (d *WebhookDispatcher) run() {
+	defer close(d.done)
+	tick := time.NewTicker(webhookPoll)
+	defer tick.Stop()
+	for {
+		d.sendDue(d.ctx)
+		select {
+		case <-d.quit:
+			return
+		case <-d.s.WebhookSignal():
+		case <-tick.C:
+		}
+	}
+}
+
+// Shutdown lets the attempts in flight finish until ctx is done. Deliveries
+// not yet sent stay queued for the next start.
+func (d *WebhookDispatcher) Shutdown(ctx context.Context) error {
+	close(d.quit)
+	defer d.cancel()
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-d.done
+		return ctx.Err()
+	}
+}
+
+func (d *WebhookDispatcher) sendDue(ctx context.Context) {
+	for {
+		select {
+		case <-d.quit:
+			return
+		default:
+		}
+		ds, err := d.s.ClaimWebhookDeliveries(ctx, time.Now(), webhookLease, webhookBatch)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("claiming webhook deliveries: %v", err)
+			}
+			return
+		}
+		if len(ds) == 0 {
+			return
+		}
+		// one slow receiver should not hold up the rest of the batch
+		var wg sync.WaitGroup
+		for _, dl := range ds {
+			wg.Add(1)
+			go func(dl models.WebhookDelivery) {
+				defer wg.Done()
+				d.send(ctx, dl)
+			}(dl)
+		}
+		wg.Wait()
+	}
+}
+
+func (d *WebhookDispatcher) send(ctx context.Context, dl models.WebhookDelivery) {
+	gctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	sub, err := d.s.GetWebhook(gctx, dl.SubscriptionID)
+	cancel()
+	switch {
+	case err == nil && sub.Active:
+		attemptWebhook(ctx, sub, &dl)
+		if ctx.Err() != nil {
+			return // shutting down; the lease runs out and it is sent again
+		}
+	case err == nil:
+		dl.Status, dl.LastError = models.DeliveryFailed, "subscription is inactive"
+	case err == mongo.ErrNoDocuments:
+		dl.Status, dl.LastError = models.DeliveryFailed, "subscription was deleted"
+	default:
+		log.Printf("loading webhook %s: %v", dl.SubscriptionID.Hex(), err)
+		return
+	}
+
+	bctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.s.SaveWebhookDelivery(bctx, dl); err != nil {
+		log.Printf("recording webhook delivery %s: %v", dl.ID.Hex(), err)
+	}
+}
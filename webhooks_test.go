@@ -0,0 +1,201 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// receiver is a webhook endpoint answering with the queued codes in turn,
+// then 200, and keeping what it was sent.
+type receiver struct {
+	*httptest.Server
+	mu    sync.Mutex
+	codes []int
+	got   []receivedHook
+}
+
+type receivedHook struct {
+	header http.Header
+	body   []byte
+}
+
+func newReceiver(t *testing.T, codes ...int) *receiver {
+	rc := &receiver{codes: codes}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rc.mu.Lock()
+		rc.got = append(rc.got, receivedHook{r.Header.Clone(), body})
+		code := 200
+		if len(rc.codes) > 0 {
+			code, rc.codes = rc.codes[0], rc.codes[1:]
+		}
+		rc.mu.Unlock()
+		w.WriteHeader(code)
+		io.WriteString(w, http.StatusText(code))
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) received() []receivedHook {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]receivedHook(nil), rc.got...)
+}
+
+func TestAttemptWebhookSigns(t *testing.T) {
+	rc := newReceiver(t)
+	sub := models.WebhookSubscription{ID: primitive.NewObjectID(), URL: rc.URL, Secret: "s3cret", Active: true}
+	d := models.NewWebhookDelivery(sub.ID, "ev1", models.WebhookOrderCreated, []byte(`{"id":"ev1"}`), 3, time.Now())
+
+	attemptWebhook(context.Background(), sub, &d)
+	if d.Status != models.DeliverySucceeded || d.DeliveredAt == nil || d.ResponseCode != 200 {
+		t.Fatalf("delivery = %+v, want succeeded with 200", d)
+	}
+
+	got := rc.received()
+	if len(got) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(got))
+	}
+	h := got[0].header
+	if string(got[0].body) != d.Payload {
+		t.Errorf("body = %s, want %s", got[0].body, d.Payload)
+	}
+	if h.Get(webhookEventHeader) != models.WebhookOrderCreated || h.Get(webhookDeliveryHeader) != d.ID.Hex() {
+		t.Errorf("event %q, delivery %q", h.Get(webhookEventHeader), h.Get(webhookDeliveryHeader))
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(h.Get(webhookTimestampHeader) + "." + d.Payload))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); h.Get(webhookSignatureHeader) != want {
+		t.Errorf("signature = %q, want %q", h.Get(webhookSignatureHeader), want)
+	}
+}
+
+func TestAttemptWebhookBacksOffOn5xx(t *testing.T) {
+	rc := newReceiver(t, 503, 502, 500)
+	sub := models.WebhookSubscription{ID: primitive.NewObjectID(), URL: rc.URL, Secret: "s3cret", Active: true}
+	d := models.NewWebhookDelivery(sub.ID, "ev1", models.WebhookOrderCreated, []byte(`{}`), 3, time.Now())
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		before := time.Now()
+		attemptWebhook(context.Background(), sub, &d)
+		if d.Status != models.DeliveryPending || d.Attempts != attempt || d.LastError == "" {
+			t.Fatalf("attempt %d: delivery = %+v, want pending with an error", attempt, d)
+		}
+		// base doubles per attempt, plus up to 20% jitter
+		lo := webhookBaseBackoff << (attempt - 1)
+		if wait := d.NextAttemptAt.Sub(before); wait < lo || wait > lo*6/5+time.Second {
+			t.Errorf("attempt %d: next try in %s, want %s to %s", attempt, wait, lo, lo*6/5)
+		}
+	}
+
+	attemptWebhook(context.Background(), sub, &d)
+	if d.Status != models.DeliveryFailed || d.ResponseCode != 500 {
+		t.Errorf("after max attempts: delivery = %+v, want failed with 500", d)
+	}
+}
+
+func TestWebhookDispatcherLogsDeliveries(t *testing.T) {
+	rc := newReceiver(t, 503)
+	m := NewMemoryRepo()
+	ctx := context.Background()
+	sub, err := m.CreateWebhook(ctx, models.WebhookSubscription{
+		URL: rc.URL, Secret: "s3cret", Events: []string{models.WebhookOrderCreated}, Active: true,
+	})
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	if _, err := m.EnqueueWebhookDeliveries(ctx, "ev1", models.WebhookOrderCreated, []byte(`{"id":"ev1"}`)); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	d := &WebhookDispatcher{s: m, quit: make(chan struct{})}
+	d.sendDue(ctx)
+	ds, _ := m.ListWebhookDeliveries(ctx, sub.ID, 10)
+	if len(ds) != 1 {
+		t.Fatalf("%d deliveries logged, want 1", len(ds))
+	}
+	dl := ds[0]
+	if dl.Status != models.DeliveryPending || dl.Attempts != 1 || dl.ResponseCode != 503 ||
+		dl.ResponseBody != http.StatusText(503) || dl.LastError != "receiver answered 503" {
+		t.Fatalf("after a 503: %+v", dl)
+	}
+	if !dl.NextAttemptAt.After(time.Now()) || dl.LockedUntil != nil {
+		t.Fatalf("after a 503 the delivery should wait unleased for its retry: %+v", dl)
+	}
+
+	// not due yet, so nothing is sent
+	d.sendDue(ctx)
+	if n := len(rc.received()); n != 1 {
+		t.Fatalf("receiver got %d requests before the retry was due, want 1", n)
+	}
+
+	dl.NextAttemptAt = time.Now()
+	m.SaveWebhookDelivery(ctx, dl)
+	d.sendDue(ctx)
+	ds, _ = m.ListWebhookDeliveries(ctx, sub.ID, 10)
+	if dl := ds[0]; dl.Status != models.DeliverySucceeded || dl.Attempts != 2 || dl.ResponseCode != 200 || dl.LastError != "" {
+		t.Errorf("after the retry: %+v", dl)
+	}
+	if n := len(rc.received()); n != 2 {
+		t.Errorf("receiver got %d requests, want 2", n)
+	}
+}
+
+func TestWebhookTestFire(t *testing.T) {
+	rc := newReceiver(t)
+	m := NewMemoryRepo()
+	ctx := context.Background()
+	// test-fire works whether or not the subscription is active
+	sub, err := m.CreateWebhook(ctx, models.WebhookSubscription{
+		URL: rc.URL, Secret: "s3cret", Events: []string{models.WebhookOrderCreated}, Active: false,
+	})
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	WebhookByIDHandler(m)(rec, httptest.NewRequest(http.MethodPost, "/webhooks/"+sub.ID.Hex()+"/test", nil))
+	if rec.Code != 200 {
+		t.Fatalf("POST test = %d %s", rec.Code, rec.Body)
+	}
+	var out models.WebhookDelivery
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Event != models.WebhookTest || out.Status != models.DeliverySucceeded || out.ResponseCode != 200 {
+		t.Errorf("answer = %+v, want a succeeded webhook.test delivery", out)
+	}
+
+	got := rc.received()
+	if len(got) != 1 || got[0].header.Get(webhookEventHeader) != models.WebhookTest {
+		t.Fatalf("receiver got %+v, want one webhook.test", got)
+	}
+	var env webhookEnvelope
+	if err := json.Unmarshal(got[0].body, &env); err != nil || env.ID != out.EventID {
+		t.Errorf("envelope = %+v (%v), want id %s", env, err, out.EventID)
+	}
+
+	ds, _ := m.ListWebhookDeliveries(ctx, sub.ID, 10)
+	if len(ds) != 1 || ds[0].ID != out.ID || ds[0].Status != models.DeliverySucceeded || ds[0].LockedUntil != nil {
+		t.Errorf("delivery log = %+v, want the test delivery, succeeded", ds)
+	}
+
+	rec = httptest.NewRecorder()
+	WebhookByIDHandler(m)(rec, httptest.NewRequest(http.MethodPost, "/webhooks/"+primitive.NewObjectID().Hex()+"/test", nil))
+	if rec.Code != 404 {
+		t.Errorf("test-fire of an unknown subscription = %d, want 404", rec.Code)
+	}
+}
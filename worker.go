@@ -1,11 +1,253 @@
 package main
 
-import "context"
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
 
-func StartLowStockWorker(r *Repo) {
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// reservationTTL is how long an unpaid order holds its items. main may
+// override it from RESERVATION_TTL.
+var reservationTTL = 30 * time.Minute
+
+const (
+	outboxBatch       = 50
+	outboxLease       = time.Minute // longer than any single delivery
+	outboxPoll        = 2 * time.Second
+	outboxMaxAttempts = 8
+	outboxBaseBackoff = time.Second
+	outboxMaxBackoff  = 5 * time.Minute
+)
+
+type OutboxDeliverer interface {
+	OutboxStore
+	AlertStore
+	OrderStore
+	WebhookStore
+}
+
+// OutboxWorker delivers outbox events in the background. Writers never wait
+// for it: they only add to the outbox and nudge the worker, which also polls
+// so a missed nudge or a restart loses nothing.
+type OutboxWorker struct {
+	s      OutboxDeliverer
+	events *EventHub
+	ctx    context.Context
+	cancel context.CancelFunc
+	quit   chan struct{}
+	done   chan struct{}
+}
+
+// StartOutboxWorker starts delivering; newly opened alerts are also
+// published on events.
+func StartOutboxWorker(s OutboxDeliverer, events *EventHub) *OutboxWorker {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &OutboxWorker{
+		s:      s,
+		events: events,
+		ctx:    ctx,
+		cancel: cancel,
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *OutboxWorker) run() {
+	defer close(w.done)
+	tick := time.NewTicker(outboxPoll)
+	defer tick.Stop()
+	for {
+		w.deliverDue(w.ctx)
+		select {
+		case <-w.quit:
+			return
+		case <-w.s.OutboxSignal():
+		case <-tick.C:
+		}
+	}
+}
+
+// Shutdown stops the worker and then delivers whatever is already due, until
+// the outbox has nothing due or ctx is done. Events still waiting for a retry
+// stay in the outbox for the next start.
+func (w *OutboxWorker) Shutdown(ctx context.Context) error {
+	close(w.quit)
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		w.cancel()
+		<-w.done
+		return ctx.Err()
+	}
+	defer w.cancel()
+	return w.deliverDue(ctx)
+}
+
+func (w *OutboxWorker) deliverDue(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		evs, err := w.s.ClaimOutbox(ctx, time.Now(), outboxLease, outboxBatch)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("claiming outbox events: %v", err)
+			}
+			return err
+		}
+		if len(evs) == 0 {
+			return nil
+		}
+		for _, ev := range evs {
+			w.deliver(ctx, ev)
+		}
+	}
+}
+
+func (w *OutboxWorker) deliver(ctx context.Context, ev models.OutboxEvent) {
+	dctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	err := w.handle(dctx, ev)
+	cancel()
+	if err != nil && ctx.Err() != nil {
+		return // shutting down; the lease runs out and the event is retried
+	}
+
+	// bookkeeping must land even if ctx is about to end
+	bctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	switch {
+	case err == nil:
+		err = w.s.CompleteOutbox(bctx, ev.ID)
+	case ev.Attempts+1 >= outboxMaxAttempts:
+		log.Printf("outbox event %s failed %d times, moving it to the dead letters: %v", ev.ID.Hex(), ev.Attempts+1, err)
+		err = w.s.DeadLetterOutbox(bctx, ev.ID, err.Error())
+	default:
+		at := time.Now().Add(retryBackoff(ev.Attempts+1, outboxBaseBackoff, outboxMaxBackoff))
+		log.Printf("outbox event %s failed, retrying at %s: %v", ev.ID.Hex(), at.Format(time.RFC3339), err)
+		err = w.s.RetryOutbox(bctx, ev.ID, err.Error(), at)
+	}
+	if err != nil {
+		log.Printf("recording outbox event %s: %v", ev.ID.Hex(), err)
+	}
+}
+
+func (w *OutboxWorker) handle(ctx context.Context, ev models.OutboxEvent) error {
+	switch ev.Topic {
+	case models.TopicStockChanged:
+		for _, id := range ev.PartIDs {
+			a, err := w.s.SyncLowStockAlert(ctx, id)
+			if err != nil {
+				return fmt.Errorf("part %s: %w", id.Hex(), err)
+			}
+			if a != nil {
+				w.events.Publish(Event{ID: a.ID.Hex(), Type: EventAlertOpened, Data: a})
+			} else if ev.Attempts > 0 {
+				// the alert is only returned once: an earlier attempt may
+				// have opened it and then failed to queue its webhooks
+				cur, err := w.s.CurrentAlert(ctx, id)
+				if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+					return fmt.Errorf("part %s: %w", id.Hex(), err)
+				}
+				if err == nil && !cur.At.Before(ev.CreatedAt) {
+					a = &cur
+				}
+			}
+			if a != nil {
+				// queuing is idempotent per alert, so a retry sends nothing twice
+				if err := w.fanOut(ctx, a.ID.Hex(), models.WebhookAlertOpened, a.At, a); err != nil {
+					return fmt.Errorf("queuing webhooks for alert %s: %w", a.ID.Hex(), err)
+				}
+			}
+		}
+		return nil
+	case models.TopicOrderCreated, models.TopicOrderStatusChanged:
+		if ev.OrderID == nil {
+			return fmt.Errorf("%s event without an order", ev.Topic)
+		}
+		o, err := w.s.GetOrder(ctx, *ev.OrderID)
+		if err != nil {
+			return fmt.Errorf("order %s: %w", ev.OrderID.Hex(), err)
+		}
+		event := models.WebhookOrderStatusChanged
+		if ev.Topic == models.TopicOrderCreated {
+			event = models.WebhookOrderCreated
+		}
+		// the outbox event id is stable across retries, so receivers see
+		// one id per change
+		return w.fanOut(ctx, ev.ID.Hex(), event, ev.CreatedAt, webhookOrder{Status: ev.Status, Order: o})
+	default:
+		return fmt.Errorf("unknown topic %q", ev.Topic)
+	}
+}
+
+func (w *OutboxWorker) fanOut(ctx context.Context, eventID, event string, at time.Time, data any) error {
+	payload, err := webhookPayload(eventID, event, at, data)
+	if err != nil {
+		return err
+	}
+	_, err = w.s.EnqueueWebhookDeliveries(ctx, eventID, event, payload)
+	return err
+}
+
+// retryBackoff doubles from base per failed attempt up to limit, with up to 20%
+// jitter so failures do not retry in step.
+func retryBackoff(attempt int, base, limit time.Duration) time.Duration {
+	d := limit
+	if attempt < 20 {
+		if b := base << (attempt - 1); b < d {
+			d = b
+		}
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/5+1))
+}
+
+// StartReservationWorker cancels unpaid orders whose holds have expired,
+// which hands the held stock back to available-to-promise.
+func StartReservationWorker(s ReservationStore, every time.Duration) {
+	go func() {
+		for range time.Tick(every) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			n, err := s.ReleaseExpiredReservations(ctx, time.Now())
+			cancel()
+			if err != nil {
+				log.Printf("releasing expired reservations: %v", err)
+			}
+			if n > 0 {
+				log.Printf("released holds of %d unpaid orders", n)
+			}
+		}
+	}()
+}
+
+// StartReorderWorker drafts purchase orders from the reorder suggestions
+// every interval. Drafts count as on order, so a part is not drafted again
+// while an earlier draft for it is still open.
+func StartReorderWorker(s Store, every time.Duration) {
 	go func() {
-		for a := range r.lowStockCh {
-			_ = r.InsertAlert(context.Background(), a)
+		for range time.Tick(every) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			now := time.Now()
+			opt := ReorderOptions{WindowDays: defaultDemandWindowDays, CoverDays: defaultCoverDays}
+			suggestions, err := ReorderSuggestions(ctx, s, opt, now)
+			if err == nil {
+				var pos []models.PurchaseOrder
+				pos, err = DraftReorderPurchaseOrders(ctx, s, suggestions, models.ActorSystem, now)
+				if len(pos) > 0 {
+					log.Printf("drafted %d purchase orders from reorder suggestions", len(pos))
+				}
+			}
+			cancel()
+			if err != nil {
+				log.Printf("drafting reorder purchase orders: %v", err)
+			}
 		}
 	}()
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"carparts/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// flakyWebhooks fails the first fails calls to EnqueueWebhookDeliveries.
+type flakyWebhooks struct {
+	*MemoryRepo
+	fails int
+}
+
+func (f *flakyWebhooks) EnqueueWebhookDeliveries(ctx context.Context, eventID, event string, payload []byte) (int, error) {
+	if f.fails > 0 {
+		f.fails--
+		return 0, errors.New("webhook store unavailable")
+	}
+	return f.MemoryRepo.EnqueueWebhookDeliveries(ctx, eventID, event, payload)
+}
+
+func TestOutboxRetriesAlertWebhooks(t *testing.T) {
+	m := NewMemoryRepo()
+	ctx := context.Background()
+	sub, err := m.CreateWebhook(ctx, models.WebhookSubscription{
+		URL: "http://example.invalid/hook", Events: []string{models.WebhookAlertOpened}, Active: true,
+	})
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	c, _ := m.CreateCategory(ctx, models.Category{Name: "Filters"})
+	p, err := m.CreatePart(ctx, models.SparePart{CategoryID: c.ID, Brand: "Mann", Price: 5, Stock: 1, IsActive: true})
+	if err != nil {
+		t.Fatalf("create part: %v", err)
+	}
+
+	w := &OutboxWorker{s: &flakyWebhooks{MemoryRepo: m, fails: 1}, events: NewEventHub()}
+	ev := models.NewStockChangedEvent([]primitive.ObjectID{p.ID}, time.Now())
+	if err := w.handle(ctx, ev); err == nil {
+		t.Fatal("handle succeeded although the webhooks could not be queued")
+	}
+	if _, err := m.CurrentAlert(ctx, p.ID); err != nil {
+		t.Fatalf("the first attempt opened no alert: %v", err)
+	}
+
+	// the retry finds the alert the first attempt opened
+	ev.Attempts++
+	if err := w.handle(ctx, ev); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	ds, _ := m.ListWebhookDeliveries(ctx, sub.ID, 10)
+	if len(ds) != 1 || ds[0].Event != models.WebhookAlertOpened {
+		t.Fatalf("deliveries after the retry = %+v, want one alert.opened", ds)
+	}
+
+	// a further retry queues nothing twice
+	ev.Attempts++
+	if err := w.handle(ctx, ev); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if ds, _ := m.ListWebhookDeliveries(ctx, sub.ID, 10); len(ds) != 1 {
+		t.Errorf("%d deliveries after another retry, want 1", len(ds))
+	}
+}